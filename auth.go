@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Credential authenticates the requests of an HTTPFetcher to a host.
+// Its fields can be combined, such as logging in to a site behind basic auth.
+type Credential struct {
+	// Username and Password are sent with basic auth when Username is not empty.
+	Username string
+	Password string
+	// Authorization is sent as the Authorization header when not empty, such as "Bearer <token>".
+	Authorization string
+	// Login, when set, is done once before the first request to the host, to capture its session cookies.
+	Login *Login
+
+	once     sync.Once
+	loginErr error
+}
+
+// Login is a login form, posted to capture the session cookies of a site.
+type Login struct {
+	// URL is where the form is posted to.
+	URL string
+	// Form are the fields of the form, such as the user name and password.
+	Form url.Values
+}
+
+// credential returns the Credential of the host of u, looked up with its port first.
+func (f *HTTPFetcher) credential(u *url.URL) *Credential {
+	if c, ok := f.Credentials[u.Host]; ok {
+		return c
+	}
+	return f.Credentials[u.Hostname()]
+}
+
+// authenticate adds the credentials of the host of req to it, logging in first when needed.
+// The client follows redirects to other hosts without the Authorization header.
+func (f *HTTPFetcher) authenticate(req *http.Request) error {
+	c := f.credential(req.URL)
+	if c == nil {
+		return nil
+	}
+	if c.Login != nil {
+		c.once.Do(func() {
+			c.loginErr = f.login(req.Context(), c)
+		})
+		if c.loginErr != nil {
+			return c.loginErr
+		}
+	}
+	if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+	if c.Authorization != "" {
+		req.Header.Set("Authorization", c.Authorization)
+	}
+	return nil
+}
+
+// login posts the login form of c, its session cookies are kept in the cookie jar of the client.
+func (f *HTTPFetcher) login(ctx context.Context, c *Credential) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.Login.URL, strings.NewReader(c.Login.Form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", f.userAgent())
+	if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+	resp, err := f.HTTPClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("log in to %s: %w", c.Login.URL, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("log in: %w", &HTTPError{URL: c.Login.URL, StatusCode: resp.StatusCode})
+	}
+	return nil
+}
+
+// needsCookies reports whether a credential logs in, and so needs a cookie jar.
+func (f *HTTPFetcher) needsCookies() bool {
+	for _, c := range f.Credentials {
+		if c.Login != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// credentialsFlag is a flag.Value collecting host=value pairs into Credentials, parsed by set.
+type credentialsFlag struct {
+	credentials map[string]*Credential
+	set         func(c *Credential, value string) error
+}
+
+func (f *credentialsFlag) String() string {
+	return ""
+}
+
+func (f *credentialsFlag) Set(s string) error {
+	i := strings.IndexByte(s, '=')
+	if i <= 0 {
+		return fmt.Errorf("%q is not host=value", s)
+	}
+	host := s[:i]
+	c, ok := f.credentials[host]
+	if !ok {
+		c = &Credential{}
+		f.credentials[host] = c
+	}
+	return f.set(c, s[i+1:])
+}
+
+// setBasicAuth sets the basic auth of c from a user:password value.
+func setBasicAuth(c *Credential, value string) error {
+	i := strings.IndexByte(value, ':')
+	if i < 0 {
+		return fmt.Errorf("%q is not user:password", value)
+	}
+	c.Username, c.Password = value[:i], value[i+1:]
+	return nil
+}
+
+// setBearer sets the Authorization of c to the bearer token value.
+func setBearer(c *Credential, value string) error {
+	c.Authorization = "Bearer " + value
+	return nil
+}
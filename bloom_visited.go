@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+	"sync"
+)
+
+// DefaultFalsePositiveRate is the false positive rate of a BloomVisitedSet created with a rate out of (0, 1).
+const DefaultFalsePositiveRate = 0.001
+
+// BloomVisitedSet is a VisitedSet backed by a Bloom filter, for crawls of too many urls to keep them in a map.
+// It takes about 1.8 bytes per url at a false positive rate of 0.1%, whatever the length of the urls.
+// A false positive is a url reported as visited while it was not, so a small share of the pages is never crawled.
+// It does not implement VisitedLister, so checkpoints of crawls using it do not remember the visited urls.
+type BloomVisitedSet struct {
+	lock sync.Mutex
+	bits []uint64
+	// hashes is the number of bits set for each url
+	hashes int
+	n      int
+}
+
+// NewBloomVisitedSet returns an empty BloomVisitedSet sized for expected urls at falsePositiveRate.
+// The false positive rate grows beyond it once more than expected urls are visited.
+func NewBloomVisitedSet(expected int, falsePositiveRate float64) *BloomVisitedSet {
+	if expected < 1 {
+		expected = 1
+	}
+	if falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+		falsePositiveRate = DefaultFalsePositiveRate
+	}
+	// the optimal number of bits and of hashes for a Bloom filter
+	m := math.Ceil(-float64(expected) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2))
+	k := int(math.Round(m / float64(expected) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &BloomVisitedSet{bits: make([]uint64, (int(m)+63)/64), hashes: k}
+}
+
+// Visit is the implementation of VisitedSet.Visit for BloomVisitedSet.
+func (s *BloomVisitedSet) Visit(url URL) bool {
+	h1, h2 := bloomHashes(url)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	visited := true
+	for i := 0; i < s.hashes; i++ {
+		bit := s.bit(h1, h2, i)
+		if s.bits[bit/64]&(1<<(bit%64)) == 0 {
+			visited = false
+			s.bits[bit/64] |= 1 << (bit % 64)
+		}
+	}
+	if !visited {
+		s.n++
+	}
+	return !visited
+}
+
+// Visited is the implementation of VisitedSet.Visited for BloomVisitedSet.
+func (s *BloomVisitedSet) Visited(url URL) bool {
+	h1, h2 := bloomHashes(url)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for i := 0; i < s.hashes; i++ {
+		bit := s.bit(h1, h2, i)
+		if s.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Len returns the number of visited urls, not counting the false positives.
+func (s *BloomVisitedSet) Len() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.n
+}
+
+// bit returns the i-th bit of the url hashed to h1 and h2, combining the two hashes as Kirsch and Mitzenmacher do.
+func (s *BloomVisitedSet) bit(h1, h2 uint64, i int) uint64 {
+	return (h1 + uint64(i)*h2) % uint64(len(s.bits)*64)
+}
+
+// bloomHashes returns two independent hashes of url.
+func bloomHashes(url URL) (uint64, uint64) {
+	h := fnv.New128a()
+	h.Write([]byte(url))
+	sum := h.Sum(nil)
+	return binary.BigEndian.Uint64(sum[:8]), binary.BigEndian.Uint64(sum[8:]) | 1
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// BrokenLink is a crawled url that failed, with an error or a 4xx or 5xx status, and the pages linking to it.
+type BrokenLink struct {
+	URL        URL
+	StatusCode int
+	Err        error
+	// LinkedFrom are the crawled pages linking to URL, in the order they were crawled.
+	LinkedFrom []URL
+}
+
+// BrokenLinkSink collects the broken links of the crawl, and writes a report of them to W when closed:
+// a line per broken url, followed by a line per page linking to it.
+// The pages linking to a broken url are those crawled, wherever they were crawled from.
+type BrokenLinkSink struct {
+	W io.Writer
+
+	// referrers are the pages linking to every url, by url
+	referrers map[URL][]URL
+	broken    []BrokenLink
+}
+
+// Write is the implementation of Sink for BrokenLinkSink.
+func (s *BrokenLinkSink) Write(page PageResult) error {
+	if s.referrers == nil {
+		s.referrers = make(map[URL][]URL)
+	}
+	for _, link := range page.Links {
+		s.referrers[link] = append(s.referrers[link], page.URL)
+	}
+	// a seed found in a sitemap is linked from no page, and could be linked from its parent
+	if page.Parent != "" && !containsURL(s.referrers[page.URL], page.Parent) {
+		s.referrers[page.URL] = append([]URL{page.Parent}, s.referrers[page.URL]...)
+	}
+	if page.Err != nil || page.Meta.StatusCode >= 400 {
+		s.broken = append(s.broken, BrokenLink{URL: page.URL, StatusCode: page.Meta.StatusCode, Err: page.Err})
+	}
+	return nil
+}
+
+// BrokenLinks returns the broken links found so far, in the order they were crawled.
+func (s *BrokenLinkSink) BrokenLinks() []BrokenLink {
+	broken := make([]BrokenLink, len(s.broken))
+	for i, link := range s.broken {
+		link.LinkedFrom = s.referrers[link.URL]
+		broken[i] = link
+	}
+	return broken
+}
+
+// Close is the implementation of Sink for BrokenLinkSink, it writes the report.
+func (s *BrokenLinkSink) Close() error {
+	w := bufio.NewWriter(s.W)
+	for _, link := range s.BrokenLinks() {
+		reason := fmt.Sprintf("%d %s", link.StatusCode, http.StatusText(link.StatusCode))
+		if link.StatusCode < 400 {
+			reason = link.Err.Error()
+		}
+		fmt.Fprintf(w, "broken: %s (%s)\n", DisplayURL(link.URL), reason)
+		for _, referrer := range link.LinkedFrom {
+			fmt.Fprintf(w, "\tlinked from %s\n", DisplayURL(referrer))
+		}
+	}
+	return w.Flush()
+}
+
+func containsURL(urls []URL, url URL) bool {
+	for _, u := range urls {
+		if u == url {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,544 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+//FetchResult is a wrapper over the Fetch result
+type FetchResult struct {
+	body string
+	urls []string
+	err  error
+	meta FetchMeta
+	// expires is when the result goes stale, and is zero when it never does
+	expires time.Time
+}
+
+// expired reports whether r went stale by now.
+func (r *FetchResult) expired(now time.Time) bool {
+	return !r.expires.IsZero() && !now.Before(r.expires)
+}
+
+// size returns the size of r cached for url, in bytes.
+func (r *FetchResult) size(url URL) int64 {
+	n := len(url) + len(r.body)
+	for _, u := range r.urls {
+		n += len(u)
+	}
+	return int64(n)
+}
+
+//FetcherCache is a Cache to Fetch results faster, using the Proxy Pattern
+type FetcherCache struct {
+	//Delegator is the Fetcher that is being cached
+	Delegator Fetcher
+	// Revalidate sends every fetch of a cached url to the Delegator, conditionally when the cached
+	// result has validators, so changes are never missed. Unchanged pages are served from the cache
+	// when the Delegator fails with ErrNotModified.
+	Revalidate bool
+	// lock guards store, calls and stats, it is never held while fetching
+	lock sync.Mutex
+	// calls are the fetches in flight by url, which fetches of the same url wait for and share
+	calls map[URL]*fetchCall
+	// ttl is how long results are kept, forever when 0
+	ttl time.Duration
+	// store holds the results, a MapStore unless set by WithStore
+	store CacheStore
+	// maxEntries and maxBytes bound the default MapStore, compressAbove is its CompressAbove
+	maxEntries    int
+	maxBytes      int64
+	compressAbove int
+	// shards makes the default store a ShardedStore of that many MapStores, when more than 1
+	shards int
+	// httpCaching follows the freshness declared by the responses over ttl
+	httpCaching bool
+	// staleWhileRevalidate serves stale results up to maxStale past their expiry while refreshing them
+	staleWhileRevalidate bool
+	maxStale             time.Duration
+	// refreshing are the urls refreshed in the background, refreshes waits for them
+	refreshing map[URL]bool
+	refreshes  sync.WaitGroup
+	// errorPolicy decides which errors are cached, all of them when nil, SkippedResults are never cached
+	errorPolicy ErrorPolicy
+	// exportFormat is the serialization of SaveTo, FormatJSON when empty
+	exportFormat string
+	// stats are the counters of Stats, but those of the store
+	stats CacheStats
+	// sweepInterval is the interval of the sweeper goroutine, there is none when 0
+	sweepInterval time.Duration
+	// stopSweeper stops the sweeper goroutine, when there is one
+	stopSweeper chan struct{}
+	closeOnce   sync.Once
+	// logger logs the hits and misses of the cache, with the cache component
+	logger *slog.Logger
+}
+
+// CacheOption configures a FetcherCache created with NewFetcherCache.
+type CacheOption func(*FetcherCache)
+
+// NewFetcherCache returns a FetcherCache caching the results of delegate, configured by opts.
+func NewFetcherCache(delegate Fetcher, opts ...CacheOption) *FetcherCache {
+	f := &FetcherCache{Delegator: delegate}
+	for _, opt := range opts {
+		opt(f)
+	}
+	f.logger = componentLogger(f.logger, "cache")
+	f.results()
+	if f.sweepInterval > 0 {
+		f.stopSweeper = make(chan struct{})
+		go f.sweep(f.sweepInterval, f.stopSweeper)
+	}
+	return f
+}
+
+// WithRevalidate sets Revalidate, sending every fetch of a cached url to the Delegator.
+func WithRevalidate() CacheOption {
+	return func(f *FetcherCache) {
+		f.Revalidate = true
+	}
+}
+
+// WithStore keeps the results in store instead of a MapStore, WithMaxEntries, WithMaxBytes, WithCompression and
+// WithShards only apply to the MapStore.
+func WithStore(store CacheStore) CacheOption {
+	return func(f *FetcherCache) {
+		f.store = store
+	}
+}
+
+// WithMaxEntries keeps at most n results, evicting the least recently used ones, so long crawls keep memory flat.
+func WithMaxEntries(n int) CacheOption {
+	return func(f *FetcherCache) {
+		f.maxEntries = n
+	}
+}
+
+// WithMaxBytes keeps results up to a total size of n bytes, evicting the least recently used ones, since the sizes
+// of pages vary too much for WithMaxEntries alone to bound memory. A result larger than n is not kept.
+// The size of a result is the size of its url, body and links.
+func WithMaxBytes(n int64) CacheOption {
+	return func(f *FetcherCache) {
+		f.maxBytes = n
+	}
+}
+
+// WithCompression keeps the bodies larger than threshold bytes compressed in memory, see MapStore.CompressAbove.
+func WithCompression(threshold int) CacheOption {
+	return func(f *FetcherCache) {
+		f.compressAbove = threshold
+	}
+}
+
+// WithShards spreads the results over n MapStores, with a ShardedStore, so many workers fetching at once rarely wait
+// on each other. WithMaxEntries and WithMaxBytes are split between the shards.
+func WithShards(n int) CacheOption {
+	return func(f *FetcherCache) {
+		f.shards = n
+	}
+}
+
+// ErrorPolicy decides whether the error of a failed fetch is cached, and for how long.
+// A ttl of 0 keeps the error as long as successful results.
+type ErrorPolicy func(err error) (cache bool, ttl time.Duration)
+
+// NeverCacheErrors is the ErrorPolicy fetching failed urls again every time.
+func NeverCacheErrors() ErrorPolicy {
+	return func(error) (bool, time.Duration) {
+		return false, 0
+	}
+}
+
+// CacheErrorsFor is the ErrorPolicy caching every error for d, so failed urls are retried after a while.
+func CacheErrorsFor(d time.Duration) ErrorPolicy {
+	return func(error) (bool, time.Duration) {
+		return true, d
+	}
+}
+
+// CacheErrorClasses is the ErrorPolicy caching the errors of the classes of Stats.Errors, such as "not_found"
+// or "http_4xx", for ttl. Errors of other classes, such as timeouts, are not cached.
+func CacheErrorClasses(ttl time.Duration, classes ...string) ErrorPolicy {
+	return func(err error) (bool, time.Duration) {
+		class := errorClass(err)
+		for _, c := range classes {
+			if c == class {
+				return true, ttl
+			}
+		}
+		return false, 0
+	}
+}
+
+// WithErrorPolicy decides which errors are cached with policy, instead of caching all of them like successful results.
+// The SkippedResults, such as those of a CircuitBreakerFetcher, which are no answer of the page, and the fetches
+// given up with their context or after the fetch timeout are never cached, whatever the policy.
+func WithErrorPolicy(policy ErrorPolicy) CacheOption {
+	return func(f *FetcherCache) {
+		f.errorPolicy = policy
+	}
+}
+
+// WithExportFormat sets the serialization of the results written by SaveTo, FormatJSON or the more compact FormatGob.
+// LoadFrom reads either.
+func WithExportFormat(format string) CacheOption {
+	return func(f *FetcherCache) {
+		f.exportFormat = format
+	}
+}
+
+// WithTTL fetches urls again once their result is older than d, conditionally when the result has validators.
+// Stale results are replaced when their url is fetched again, or dropped by the sweeper of WithSweeper.
+func WithTTL(d time.Duration) CacheOption {
+	return func(f *FetcherCache) {
+		f.ttl = d
+	}
+}
+
+// WithHTTPCaching makes the results go stale when their response declares with its Cache-Control max-age or Expires
+// headers, and not caches the responses with Cache-Control no-store. Results whose response declares nothing, and
+// errors, are kept as set by WithTTL and WithErrorPolicy.
+func WithHTTPCaching() CacheOption {
+	return func(f *FetcherCache) {
+		f.httpCaching = true
+	}
+}
+
+// WithStaleWhileRevalidate serves stale results right away while fetching them again in the background, so a
+// popular url going stale neither slows its fetches down nor sends them all to the Delegator at once.
+// Results more than maxStale past their expiry are fetched again as usual, a maxStale of 0 serves them all.
+// It has no effect with Revalidate.
+func WithStaleWhileRevalidate(maxStale time.Duration) CacheOption {
+	return func(f *FetcherCache) {
+		f.staleWhileRevalidate = true
+		f.maxStale = maxStale
+	}
+}
+
+// WithCacheLogger logs the hits and misses of the cache to logger, at debug level.
+func WithCacheLogger(logger *slog.Logger) CacheOption {
+	return func(f *FetcherCache) {
+		f.logger = logger
+	}
+}
+
+// WithSweeper drops the stale results every interval from a background goroutine, until the cache is closed.
+// Without it, stale results of urls that are not fetched again are kept. It only applies to a store that is a CacheRanger.
+func WithSweeper(interval time.Duration) CacheOption {
+	return func(f *FetcherCache) {
+		f.sweepInterval = interval
+	}
+}
+
+// sweep drops stale results every interval until stop is closed.
+func (f *FetcherCache) sweep(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			ranger, ok := f.results().(CacheRanger)
+			if !ok {
+				return
+			}
+			var stale []URL
+			ranger.Range(func(url URL, result *FetchResult) bool {
+				if result.expired(now) {
+					stale = append(stale, url)
+				}
+				return true
+			})
+			for _, url := range stale {
+				ranger.Delete(url)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// CacheStats are counters of a FetcherCache, to tune its size and TTL.
+type CacheStats struct {
+	// Entries is the number of cached results.
+	Entries int
+	// Hits is the number of fetches served from the cache, including pages found unchanged when revalidated
+	// and results shared between concurrent fetches.
+	Hits int
+	// Misses is the number of fetches the Delegator had to serve.
+	Misses int
+	// Bytes is the size of the results cached in memory, as bounded by WithMaxBytes, 0 with a store keeping none.
+	Bytes int64
+	// Evictions is the number of results evicted from memory to stay within WithMaxEntries and WithMaxBytes.
+	Evictions int
+	// ErrorsCached is the number of failed fetches whose error was cached.
+	ErrorsCached int
+	// StaleHits is the number of Hits served stale with WithStaleWhileRevalidate.
+	StaleHits int
+}
+
+// Stats returns the counters of the cache.
+func (f *FetcherCache) Stats() CacheStats {
+	store := f.results()
+	f.lock.Lock()
+	stats := f.stats
+	f.lock.Unlock()
+	stats.Entries = store.Len()
+	if m, ok := store.(memoryStore); ok {
+		stats.Bytes = m.Bytes()
+		stats.Evictions = m.Evictions()
+	}
+	return stats
+}
+
+// memoryStore is a CacheStore keeping results in memory within bounds, like MapStore, ShardedStore and TieredStore.
+type memoryStore interface {
+	Bytes() int64
+	Evictions() int
+}
+
+// count updates the counters of the cache with update.
+func (f *FetcherCache) count(update func(stats *CacheStats)) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	update(&f.stats)
+}
+
+// results returns the store of the cache, creating the default MapStore of a cache created without NewFetcherCache.
+func (f *FetcherCache) results() CacheStore {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.store == nil && f.shards > 1 {
+		sharded := NewShardedStore(f.shards, f.maxEntries, f.maxBytes)
+		for _, shard := range sharded.Shards {
+			shard.CompressAbove = f.compressAbove
+		}
+		f.store = sharded
+	}
+	if f.store == nil {
+		f.store = &MapStore{MaxEntries: f.maxEntries, MaxBytes: f.maxBytes, CompressAbove: f.compressAbove}
+	}
+	return f.store
+}
+
+// load returns the result cached for url.
+func (f *FetcherCache) load(url URL) (*FetchResult, bool) {
+	return f.results().Get(url)
+}
+
+// save caches result for url.
+func (f *FetcherCache) save(url URL, result *FetchResult) {
+	f.results().Set(url, result)
+}
+
+// Close stops the sweeper of the cache, if any, and waits for the background refreshes of WithStaleWhileRevalidate.
+func (f *FetcherCache) Close() {
+	f.closeOnce.Do(func() {
+		if f.stopSweeper != nil {
+			close(f.stopSweeper)
+		}
+	})
+	f.refreshes.Wait()
+}
+
+// fetchCall is a fetch of a FetcherCache in flight.
+type fetchCall struct {
+	// done is closed once result is set
+	done   chan struct{}
+	result *FetchResult
+}
+
+//Fetch is a implementation for FecherCache
+func (f *FetcherCache) Fetch(url string) (body string, urls []string, err error) {
+	return f.FetchContext(context.Background(), url)
+}
+
+// FetchContext is the context aware implementation for FetcherCache.
+// Different urls are fetched concurrently, while concurrent fetches of the same url share a single fetch of the Delegator,
+// served to all but the first as cache hits. A shared fetch cancelled for the first caller is repeated for the others.
+// Results of cancelled and timed out fetches are not cached.
+func (f *FetcherCache) FetchContext(ctx context.Context, url string) (body string, urls []string, err error) {
+	ctx, trace := ensureFetchTrace(ctx)
+	for {
+		f.lock.Lock()
+		if call, ok := f.calls[url]; ok {
+			f.lock.Unlock()
+			select {
+			case <-call.done:
+			case <-ctx.Done():
+				return "", nil, ctx.Err()
+			}
+			if isContextError(call.result.err) {
+				continue
+			}
+			f.count(func(stats *CacheStats) { stats.Hits++ })
+			return call.result.hit(trace)
+		}
+		call := &fetchCall{done: make(chan struct{})}
+		if f.calls == nil {
+			f.calls = make(map[URL]*fetchCall)
+		}
+		f.calls[url] = call
+		f.lock.Unlock()
+
+		// the cache is read by the first fetch of the url only, so a slow store is not read again by the others
+		fetchResult, isCached := f.load(url)
+		// a stale result is not served anymore, but still revalidated
+		now := time.Now()
+		if isCached && !f.Revalidate && !fetchResult.expired(now) {
+			call.result = fetchResult
+			f.count(func(stats *CacheStats) { stats.Hits++ })
+			f.log().Debug("hit", "url", url)
+			body, urls, err = fetchResult.hit(trace)
+		} else if isCached && f.servesStale(fetchResult, now) {
+			call.result = fetchResult
+			f.count(func(stats *CacheStats) {
+				stats.Hits++
+				stats.StaleHits++
+			})
+			f.log().Debug("stale hit", "url", url)
+			f.refresh(url, fetchResult)
+			body, urls, err = fetchResult.hit(trace)
+		} else {
+			call.result = f.fetch(ctx, url, fetchResult, trace)
+			body, urls, err = call.result.body, call.result.urls, call.result.err
+		}
+		f.lock.Lock()
+		delete(f.calls, url)
+		f.lock.Unlock()
+		close(call.done)
+		return body, urls, err
+	}
+}
+
+// log returns the logger of f, which logs nothing for caches not created by NewFetcherCache.
+func (f *FetcherCache) log() *slog.Logger {
+	if f.logger == nil {
+		return discardLogger
+	}
+	return f.logger
+}
+
+// servesStale reports whether the stale result is served while it is refreshed.
+func (f *FetcherCache) servesStale(result *FetchResult, now time.Time) bool {
+	return f.staleWhileRevalidate && !f.Revalidate && (f.maxStale <= 0 || now.Before(result.expires.Add(f.maxStale)))
+}
+
+// refresh fetches url again in the background, unless it already is, revalidating the stale result.
+func (f *FetcherCache) refresh(url URL, stale *FetchResult) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.refreshing[url] {
+		return
+	}
+	if f.refreshing == nil {
+		f.refreshing = make(map[URL]bool)
+	}
+	f.refreshing[url] = true
+	f.refreshes.Add(1)
+	go func() {
+		defer f.refreshes.Done()
+		// the refresh outlives the fetch that started it
+		ctx, trace := withFetchTrace(context.Background())
+		f.fetch(ctx, url, stale, trace)
+		f.lock.Lock()
+		delete(f.refreshing, url)
+		f.lock.Unlock()
+	}()
+}
+
+// fetch fetches url with the Delegator, revalidating cached when it is not nil, and caches the result.
+// A page that did not change is served from cache.
+func (f *FetcherCache) fetch(ctx context.Context, url URL, cached *FetchResult, trace *fetchTrace) *FetchResult {
+	fetchCtx := ctx
+	if cached != nil && cached.err == nil && cached.meta.hasValidators() {
+		fetchCtx = WithValidators(ctx, Validators{ETag: cached.meta.ETag, LastModified: cached.meta.LastModified})
+	}
+	b, urls, err := fetchContext(fetchCtx, f.Delegator, url)
+	if cached != nil && errors.Is(err, ErrNotModified) {
+		f.count(func(stats *CacheStats) { stats.Hits++ })
+		// the headers of the not modified response update the freshness of the cached one
+		header := trace.meta.Header
+		if header == nil {
+			header = cached.meta.Header
+		}
+		trace.cacheHit = true
+		trace.meta = cached.meta
+		f.log().Debug("revalidated", "url", url)
+		expires, cache := f.expiry(header, time.Now())
+		switch {
+		case !cache:
+			f.results().Delete(url)
+		case !expires.IsZero():
+			renewed := *cached
+			renewed.expires = expires
+			f.save(url, &renewed)
+		}
+		return cached
+	}
+	result := &FetchResult{
+		body: b,
+		urls: urls,
+		err:  err,
+		meta: trace.meta,
+	}
+	f.count(func(stats *CacheStats) { stats.Misses++ })
+	f.log().Debug("miss", "url", url, "revalidate", cached != nil)
+	if isContextError(err) || errors.Is(err, ErrFetchTimeout) {
+		return result
+	}
+	if err == nil {
+		expires, cache := f.expiry(trace.meta.Header, time.Now())
+		if !cache {
+			return result
+		}
+		result.expires = expires
+		f.save(url, result)
+		return result
+	}
+	ttl := f.ttl
+	// the skipped results are no answer of the page, such as those of an open circuit, whatever the policy
+	var skip *SkippedResult
+	if errors.As(err, &skip) {
+		return result
+	}
+	if f.errorPolicy != nil {
+		cache, errTTL := f.errorPolicy(err)
+		if !cache {
+			return result
+		}
+		if errTTL > 0 {
+			ttl = errTTL
+		}
+	}
+	f.count(func(stats *CacheStats) { stats.ErrorsCached++ })
+	if ttl > 0 {
+		result.expires = time.Now().Add(ttl)
+	}
+	f.save(url, result)
+	return result
+}
+
+// hit serves r from the cache to the fetch of trace.
+func (r *FetchResult) hit(trace *fetchTrace) (string, []string, error) {
+	trace.cacheHit = true
+	trace.meta = r.meta
+	return r.body, r.urls, r.err
+}
+
+// expiry returns when a result fetched now with a response with header goes stale, zero when it never does,
+// and whether it is cached at all.
+func (f *FetcherCache) expiry(header http.Header, now time.Time) (expires time.Time, cache bool) {
+	if f.httpCaching {
+		if expires, cache, ok := httpExpiry(header, now); ok {
+			return expires, cache
+		}
+	}
+	if f.ttl > 0 {
+		return now.Add(f.ttl), true
+	}
+	return time.Time{}, true
+}
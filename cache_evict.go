@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// Evict drops the result cached for rawURL, so the next fetch of it goes to the Delegator.
+// A fetch of rawURL in flight still caches its result.
+func (f *FetcherCache) Evict(rawURL URL) {
+	f.results().Delete(rawURL)
+}
+
+// EvictHost drops the results cached for the urls of host, and returns their number.
+// It fails when the store of the cache is not a CacheRanger.
+func (f *FetcherCache) EvictHost(host string) (int, error) {
+	host = ToASCIIHost(host)
+	return f.evictIf(func(rawURL URL) bool {
+		u, err := url.Parse(rawURL)
+		return err == nil && ToASCIIHost(u.Hostname()) == host
+	})
+}
+
+// Clear drops every cached result, and returns their number.
+// It fails when the store of the cache is not a CacheRanger.
+func (f *FetcherCache) Clear() (int, error) {
+	return f.evictIf(func(URL) bool { return true })
+}
+
+// evictIf drops the results cached for the urls matching match.
+func (f *FetcherCache) evictIf(match func(rawURL URL) bool) (int, error) {
+	store := f.results()
+	ranger, ok := store.(CacheRanger)
+	if !ok {
+		return 0, fmt.Errorf("cache: %T cannot list its results", store)
+	}
+	var matched []URL
+	ranger.Range(func(rawURL URL, _ *FetchResult) bool {
+		if match(rawURL) {
+			matched = append(matched, rawURL)
+		}
+		return true
+	})
+	for _, rawURL := range matched {
+		store.Delete(rawURL)
+	}
+	return len(matched), nil
+}
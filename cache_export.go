@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// cacheFileVersion is the version of the format written by SaveTo.
+const cacheFileVersion = 1
+
+// cacheFileHeader is the first line of the output of SaveTo, always JSON so the files can be told apart.
+// The results follow it in Format.
+type cacheFileHeader struct {
+	Version int
+	Format  string
+	Saved   time.Time
+	Entries int
+}
+
+// SaveTo writes the cached results to w, to be loaded into another cache with LoadFrom.
+// The output is a header line, followed by the results serialized as set by WithExportFormat.
+// With FormatJSON, the results are a JSON object per line, so they can be analyzed offline with the usual tools.
+// A cache can only be saved when its store is a CacheRanger.
+func (f *FetcherCache) SaveTo(w io.Writer) error {
+	store := f.results()
+	ranger, ok := store.(CacheRanger)
+	if !ok {
+		return fmt.Errorf("cache: %T cannot list its results", store)
+	}
+	var records []*cacheRecord
+	ranger.Range(func(url URL, result *FetchResult) bool {
+		records = append(records, newCacheRecord(url, result))
+		return true
+	})
+	header := cacheFileHeader{
+		Version: cacheFileVersion,
+		Format:  f.exportFormat,
+		Saved:   time.Now().UTC(),
+		Entries: len(records),
+	}
+	if header.Format == "" {
+		header.Format = FormatJSON
+	}
+	if err := json.NewEncoder(w).Encode(header); err != nil {
+		return err
+	}
+	var encode func(interface{}) error
+	switch header.Format {
+	case FormatJSON:
+		encode = json.NewEncoder(w).Encode
+	case FormatGob:
+		encode = gob.NewEncoder(w).Encode
+	default:
+		return fmt.Errorf("cache: unknown format %q", header.Format)
+	}
+	for _, record := range records {
+		if err := encode(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadFrom adds the results written by SaveTo to the cache, so a crawl only fetches the pages an earlier one did not,
+// or whose results expired since. Loaded results replace the cached ones of the same urls.
+// It fails on the output of a version of SaveTo it does not know, without loading anything.
+func (f *FetcherCache) LoadFrom(r io.Reader) error {
+	br := bufio.NewReader(r)
+	line, err := br.ReadBytes('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && len(line) > 0) {
+		return fmt.Errorf("cache: reading header: %w", err)
+	}
+	var header cacheFileHeader
+	if err := json.Unmarshal(line, &header); err != nil || header.Version == 0 {
+		return errors.New("cache: not a cache file")
+	}
+	if header.Version != cacheFileVersion {
+		return fmt.Errorf("cache: unsupported file version %d", header.Version)
+	}
+	var decode func(interface{}) error
+	switch header.Format {
+	case FormatJSON:
+		decode = json.NewDecoder(br).Decode
+	case FormatGob:
+		decode = gob.NewDecoder(br).Decode
+	default:
+		return fmt.Errorf("cache: unknown format %q", header.Format)
+	}
+	now := time.Now()
+	for {
+		var record cacheRecord
+		err := decode(&record)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("cache: %w", err)
+		}
+		result := record.result()
+		if !result.expired(now) {
+			f.save(record.URL, result)
+		}
+	}
+}
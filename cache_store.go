@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// CacheStore holds the results of a FetcherCache, a MapStore unless selected with WithStore.
+// Stores are used concurrently, and are never called with the lock of the FetcherCache held.
+type CacheStore interface {
+	// Get returns the result stored for url, reporting false when there is none.
+	Get(url URL) (*FetchResult, bool)
+	// Set stores result for url, replacing any previous one.
+	Set(url URL, result *FetchResult)
+	// Delete drops the result stored for url, if any.
+	Delete(url URL)
+	// Len returns the number of stored results.
+	Len() int
+}
+
+// CacheRanger is a CacheStore whose results can be listed, so a FetcherCache using it can be exported with SaveTo.
+type CacheRanger interface {
+	CacheStore
+	// Range calls fn with every stored result, until fn returns false.
+	Range(fn func(url URL, result *FetchResult) bool)
+}
+
+// cacheRecord is the serialized form of a FetchResult, for the stores keeping results outside of memory.
+type cacheRecord struct {
+	URL     URL
+	Body    string
+	URLs    []URL        `json:",omitempty"`
+	Err     *errorRecord `json:",omitempty"`
+	Meta    FetchMeta
+	Expires time.Time
+}
+
+// errorRecord is the serialized form of a fetch error. The error types the crawl tells apart survive it,
+// other errors only keep their message and whether they are ErrNotFound.
+type errorRecord struct {
+	Message    string
+	NotFound   bool   `json:",omitempty"`
+	StatusCode int    `json:",omitempty"`
+	Skipped    string `json:",omitempty"`
+}
+
+func newCacheRecord(url URL, r *FetchResult) *cacheRecord {
+	record := &cacheRecord{URL: url, Body: r.body, URLs: r.urls, Meta: r.meta, Expires: r.expires}
+	if r.err != nil {
+		record.Err = &errorRecord{Message: r.err.Error(), NotFound: errors.Is(r.err, ErrNotFound)}
+		var httpErr *HTTPError
+		var skip *SkippedResult
+		if errors.As(r.err, &httpErr) {
+			record.Err.StatusCode = httpErr.StatusCode
+		} else if errors.As(r.err, &skip) {
+			record.Err.Skipped = skip.Reason
+		}
+	}
+	return record
+}
+
+// result returns the FetchResult of the record.
+func (record *cacheRecord) result() *FetchResult {
+	r := &FetchResult{body: record.Body, urls: record.URLs, meta: record.Meta, expires: record.Expires}
+	switch e := record.Err; {
+	case e == nil:
+	case e.StatusCode != 0:
+		r.err = &HTTPError{URL: record.URL, StatusCode: e.StatusCode}
+	case e.Skipped != "":
+		r.err = &SkippedResult{URL: record.URL, Reason: e.Skipped}
+	default:
+		r.err = &storedError{message: e.Message, notFound: e.NotFound}
+	}
+	return r
+}
+
+// storedError is a fetch error read back from a store.
+type storedError struct {
+	message  string
+	notFound bool
+}
+
+func (e *storedError) Error() string {
+	return e.message
+}
+
+// Is makes the errors that were ErrNotFound match it again.
+func (e *storedError) Is(target error) bool {
+	return target == ErrNotFound && e.notFound
+}
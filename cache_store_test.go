@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// storedResults are results covering what a CacheStore keeps of them, by url.
+func storedResults() map[URL]*FetchResult {
+	expires := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	return map[URL]*FetchResult{
+		"https://example.com/": {
+			body: "<html>page</html>",
+			urls: []string{"https://example.com/a", "https://example.com/b"},
+			meta: FetchMeta{StatusCode: 200, ETag: `"v1"`, Header: http.Header{"Content-Type": {"text/html"}}},
+		},
+		"https://example.com/expiring": {body: "expiring", expires: expires},
+		"https://example.com/missing":  {err: fmt.Errorf("%w: https://example.com/missing", ErrNotFound)},
+		"https://example.com/error":    {err: &HTTPError{URL: "https://example.com/error", StatusCode: 503}},
+		"https://example.com/skipped":  {err: &SkippedResult{URL: "https://example.com/skipped", Reason: SkipTooLarge}},
+		"https://example.com/other":    {err: errors.New("connection reset")},
+	}
+}
+
+// sameResult reports how got, read back from a store, differs from want, or returns an empty string.
+func sameResult(got, want *FetchResult) string {
+	switch {
+	case got.body != want.body:
+		return fmt.Sprintf("body = %q, want %q", got.body, want.body)
+	case !reflect.DeepEqual(got.urls, want.urls):
+		return fmt.Sprintf("urls = %q, want %q", got.urls, want.urls)
+	case !reflect.DeepEqual(got.meta, want.meta):
+		return fmt.Sprintf("meta = %+v, want %+v", got.meta, want.meta)
+	case !got.expires.Equal(want.expires):
+		return fmt.Sprintf("expires = %s, want %s", got.expires, want.expires)
+	case (got.err == nil) != (want.err == nil):
+		return fmt.Sprintf("err = %v, want %v", got.err, want.err)
+	case want.err == nil:
+		return ""
+	case got.err.Error() != want.err.Error():
+		return fmt.Sprintf("err = %q, want %q", got.err, want.err)
+	case errors.Is(got.err, ErrNotFound) != errors.Is(want.err, ErrNotFound):
+		return fmt.Sprintf("err = %v, ErrNotFound is not kept", got.err)
+	}
+	var gotHTTP, wantHTTP *HTTPError
+	if errors.As(want.err, &wantHTTP) && (!errors.As(got.err, &gotHTTP) || gotHTTP.StatusCode != wantHTTP.StatusCode) {
+		return fmt.Sprintf("err = %#v, want %#v", got.err, want.err)
+	}
+	var gotSkip, wantSkip *SkippedResult
+	if errors.As(want.err, &wantSkip) && (!errors.As(got.err, &gotSkip) || gotSkip.Reason != wantSkip.Reason) {
+		return fmt.Sprintf("err = %#v, want %#v", got.err, want.err)
+	}
+	return ""
+}
+
+// testCacheStore checks the results set in store, which starts empty, are read back, replaced and deleted.
+func testCacheStore(t *testing.T, store CacheStore) {
+	t.Helper()
+	if _, ok := store.Get("https://example.com/"); ok {
+		t.Error("Get of an empty store found a result")
+	}
+	results := storedResults()
+	for url, result := range results {
+		store.Set(url, result)
+	}
+	for url, want := range results {
+		got, ok := store.Get(url)
+		if !ok {
+			t.Errorf("Get(%s) found nothing", url)
+			continue
+		}
+		if diff := sameResult(got, want); diff != "" {
+			t.Errorf("Get(%s): %s", url, diff)
+		}
+	}
+	if n := store.Len(); n != len(results) {
+		t.Errorf("Len = %d, want %d", n, len(results))
+	}
+	if ranger, ok := store.(CacheRanger); ok {
+		seen := make(map[URL]bool)
+		ranger.Range(func(url URL, result *FetchResult) bool {
+			if diff := sameResult(result, results[url]); diff != "" {
+				t.Errorf("Range(%s): %s", url, diff)
+			}
+			seen[url] = true
+			return true
+		})
+		if len(seen) != len(results) {
+			t.Errorf("Range listed %d results, want %d", len(seen), len(results))
+		}
+		calls := 0
+		ranger.Range(func(URL, *FetchResult) bool {
+			calls++
+			return false
+		})
+		if calls != 1 {
+			t.Errorf("Range called fn %d times after it returned false, want 1", calls)
+		}
+	}
+
+	replaced := &FetchResult{body: "replaced"}
+	store.Set("https://example.com/", replaced)
+	if got, ok := store.Get("https://example.com/"); !ok || got.body != "replaced" {
+		t.Errorf("Get after Set = %v, %t, want the replaced result", got, ok)
+	}
+	store.Delete("https://example.com/")
+	store.Delete("https://example.com/never-set")
+	if _, ok := store.Get("https://example.com/"); ok {
+		t.Error("Get after Delete found a result")
+	}
+	if n := store.Len(); n != len(results)-1 {
+		t.Errorf("Len after Delete = %d, want %d", n, len(results)-1)
+	}
+	if reporter, ok := store.(interface{ Err() error }); ok && reporter.Err() != nil {
+		t.Errorf("Err = %v", reporter.Err())
+	}
+}
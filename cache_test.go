@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingFetcher fails the urls of errs with their error, serves the others, and counts the fetches of every url.
+type countingFetcher struct {
+	errs map[URL]error
+
+	mu      sync.Mutex
+	fetches map[URL]int
+}
+
+func (f *countingFetcher) Fetch(url string) (string, []string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fetches == nil {
+		f.fetches = make(map[URL]int)
+	}
+	f.fetches[url]++
+	if err := f.errs[url]; err != nil {
+		return "", nil, err
+	}
+	return "body of " + url, []string{url + "link"}, nil
+}
+
+func (f *countingFetcher) count(url URL) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.fetches[url]
+}
+
+func TestFetcherCacheErrorPolicy(t *testing.T) {
+	errs := map[URL]error{
+		"https://a/missing":  fmt.Errorf("%w: https://a/missing", ErrNotFound),
+		"https://a/server":   &HTTPError{URL: "https://a/server", StatusCode: 503},
+		"https://a/skipped":  &SkippedResult{URL: "https://a/skipped", Reason: SkipCircuitOpen, Err: ErrCircuitOpen},
+		"https://a/canceled": fmt.Errorf("fetch: %w", context.Canceled),
+		"https://a/timeout":  fmt.Errorf("fetch: %w", ErrFetchTimeout),
+	}
+	tests := []struct {
+		name   string
+		policy ErrorPolicy
+		// cached are the urls fetched once out of two fetches
+		cached map[URL]bool
+	}{
+		{"no policy", nil, map[URL]bool{"https://a/ok": true, "https://a/missing": true, "https://a/server": true}},
+		{"never", NeverCacheErrors(), map[URL]bool{"https://a/ok": true}},
+		{"for a while", CacheErrorsFor(time.Hour), map[URL]bool{"https://a/ok": true, "https://a/missing": true, "https://a/server": true}},
+		{"classes", CacheErrorClasses(time.Hour, "not_found", "other"), map[URL]bool{"https://a/ok": true, "https://a/missing": true}},
+	}
+	for _, test := range tests {
+		delegate := &countingFetcher{errs: errs}
+		var opts []CacheOption
+		if test.policy != nil {
+			opts = append(opts, WithErrorPolicy(test.policy))
+		}
+		cache := NewFetcherCache(delegate, opts...)
+		urls := []URL{"https://a/ok"}
+		for url := range errs {
+			urls = append(urls, url)
+		}
+		for _, url := range urls {
+			first, _, firstErr := cache.Fetch(url)
+			second, _, secondErr := cache.Fetch(url)
+			if first != second || fmt.Sprint(firstErr) != fmt.Sprint(secondErr) {
+				t.Errorf("%s: %s fetched %q, %v then %q, %v", test.name, url, first, firstErr, second, secondErr)
+			}
+			want := 2
+			if test.cached[url] {
+				want = 1
+			}
+			if got := delegate.count(url); got != want {
+				t.Errorf("%s: %s fetched %d times by the delegate, want %d", test.name, url, got, want)
+			}
+		}
+		cache.Close()
+	}
+}
+
+func TestFetcherCacheMaxEntries(t *testing.T) {
+	delegate := &countingFetcher{}
+	cache := NewFetcherCache(delegate, WithMaxEntries(2))
+	defer cache.Close()
+	// https://a/1 is used again before https://a/3 is fetched, so https://a/2 is the least recently used
+	for _, url := range []URL{"https://a/1", "https://a/2", "https://a/1", "https://a/3", "https://a/1", "https://a/2"} {
+		if body, _, err := cache.Fetch(url); err != nil || body != "body of "+url {
+			t.Errorf("Fetch(%s) = %q, %v", url, body, err)
+		}
+	}
+	for url, want := range map[URL]int{"https://a/1": 1, "https://a/2": 2, "https://a/3": 1} {
+		if got := delegate.count(url); got != want {
+			t.Errorf("%s fetched %d times by the delegate, want %d", url, got, want)
+		}
+	}
+	// fetching https://a/2 again evicted https://a/3
+	if stats := cache.Stats(); stats.Entries != 2 || stats.Evictions != 2 {
+		t.Errorf("Entries = %d, Evictions = %d, want 2 and 2", stats.Entries, stats.Evictions)
+	}
+}
+
+func TestFetcherCacheStats(t *testing.T) {
+	delegate := &countingFetcher{errs: map[URL]error{"https://a/missing": fmt.Errorf("%w: https://a/missing", ErrNotFound)}}
+	cache := NewFetcherCache(delegate)
+	defer cache.Close()
+	for _, url := range []URL{"https://a/1", "https://a/1", "https://a/missing", "https://a/missing", "https://a/1", "https://a/2"} {
+		cache.Fetch(url)
+	}
+	stats := cache.Stats()
+	want := CacheStats{Entries: 3, Hits: 3, Misses: 3, ErrorsCached: 1}
+	// Bytes depends on the size of the results
+	if stats.Bytes <= 0 {
+		t.Errorf("Bytes = %d, want the size of the results", stats.Bytes)
+	}
+	stats.Bytes = 0
+	if stats != want {
+		t.Errorf("Stats = %+v, want %+v", stats, want)
+	}
+}
+
+func TestFetcherCacheEvict(t *testing.T) {
+	delegate := &countingFetcher{}
+	cache := NewFetcherCache(delegate)
+	defer cache.Close()
+	urls := []URL{"https://a.example/1", "https://a.example:8080/2", "https://b.example/1", "https://xn--bcher-kva.example/1"}
+	fetchAll := func() {
+		for _, url := range urls {
+			cache.Fetch(url)
+		}
+	}
+	fetchAll()
+
+	cache.Evict("https://b.example/1")
+	if n, err := cache.EvictHost("a.example"); n != 2 || err != nil {
+		t.Errorf("EvictHost(a.example) = %d, %v, want 2", n, err)
+	}
+	if n, err := cache.EvictHost("bücher.example"); n != 1 || err != nil {
+		t.Errorf("EvictHost(bücher.example) = %d, %v, want 1", n, err)
+	}
+	fetchAll()
+	for _, url := range urls {
+		if got := delegate.count(url); got != 2 {
+			t.Errorf("%s fetched %d times by the delegate, want 2", url, got)
+		}
+	}
+
+	if n, err := cache.Clear(); n != len(urls) || err != nil {
+		t.Errorf("Clear = %d, %v, want %d", n, err, len(urls))
+	}
+	if entries := cache.Stats().Entries; entries != 0 {
+		t.Errorf("Entries = %d after Clear, want 0", entries)
+	}
+}
+
+func TestFetcherCacheEvictHostNeedsRanger(t *testing.T) {
+	// the struct hides the Range method of the MapStore
+	cache := NewFetcherCache(&countingFetcher{}, WithStore(struct{ CacheStore }{&MapStore{}}))
+	defer cache.Close()
+	cache.Fetch("https://a.example/1")
+	if _, err := cache.EvictHost("a.example"); err == nil {
+		t.Error("EvictHost succeeded with a store that cannot list its results")
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// checkpointVersion is the version of the checkpoint file format.
+const checkpointVersion = 1
+
+// Checkpoint is the serializable state of an interrupted crawl, enough to resume it with WithResume.
+// Pages crawled before the checkpoint are not part of it, a resumed crawl only returns the pages it fetches itself.
+type Checkpoint struct {
+	Version int
+	// Frontier are the urls still to be fetched, including the ones in flight when the checkpoint was taken.
+	// It is empty when the Scheduler does not implement TaskLister.
+	Frontier []Task
+	// Visited are the urls enqueued so far. It is empty when the VisitedSet does not implement VisitedLister.
+	Visited []URL
+	// Dispatched is the number of pages handed out to workers so far, which counts against the page budget.
+	Dispatched int
+	// HostDispatched is Dispatched by host, or by domain for the domain budgets of domains.
+	HostDispatched map[string]int `json:",omitempty"`
+	// DepthPruned records whether links beyond the maximum depth were left unfetched.
+	DepthPruned bool
+}
+
+// VisitedLister is implemented by VisitedSets that can list their urls, which is needed to checkpoint them.
+type VisitedLister interface {
+	URLs() []URL
+}
+
+// LoadCheckpoint reads a checkpoint written by a crawl configured WithCheckpoint.
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cp := &Checkpoint{}
+	if err := json.Unmarshal(data, cp); err != nil {
+		return nil, fmt.Errorf("checkpoint %s: %w", path, err)
+	}
+	if cp.Version != checkpointVersion {
+		return nil, fmt.Errorf("checkpoint %s: unsupported version %d", path, cp.Version)
+	}
+	return cp, nil
+}
+
+// Save writes cp to path, replacing it atomically so a crash never leaves a truncated checkpoint behind.
+func (cp *Checkpoint) Save(path string) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// checkpoint captures the current state of the run.
+func (r *run) checkpoint() *Checkpoint {
+	cp := &Checkpoint{
+		Version:        checkpointVersion,
+		Dispatched:     r.dispatched - len(r.inFlightTasks),
+		HostDispatched: make(map[string]int),
+		DepthPruned:    r.depthPruned,
+	}
+	for host, n := range r.hostDispatched {
+		cp.HostDispatched[host] = n
+	}
+	for _, t := range r.inFlightTasks {
+		cp.Frontier = append(cp.Frontier, t)
+		cp.HostDispatched[r.budgetKey(t.URL)]--
+	}
+	if lister, ok := r.frontier.(TaskLister); ok {
+		cp.Frontier = append(cp.Frontier, lister.Tasks()...)
+	}
+	if lister, ok := r.visited.(VisitedLister); ok {
+		cp.Visited = lister.URLs()
+	}
+	return cp
+}
+
+// saveCheckpoint writes a checkpoint when one is configured, keeping the first error in the result.
+func (r *run) saveCheckpoint() {
+	if r.c.checkpointPath == "" {
+		return
+	}
+	if err := r.checkpoint().Save(r.c.checkpointPath); err != nil {
+		r.log.Error("checkpoint failed", "path", r.c.checkpointPath, "err", err)
+		if r.result.CheckpointErr == nil {
+			r.result.CheckpointErr = err
+		}
+	}
+}
+
+// resume restores the state saved in cp.
+func (r *run) resume(cp *Checkpoint) {
+	for _, u := range cp.Visited {
+		r.visited.Visit(u)
+	}
+	for _, t := range cp.Frontier {
+		r.visited.Visit(t.URL)
+		r.frontier.Push(t)
+	}
+	r.dispatched = cp.Dispatched
+	for host, n := range cp.HostDispatched {
+		r.hostDispatched[host] = n
+	}
+	r.depthPruned = cp.DepthPruned
+}
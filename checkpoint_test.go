@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckpointResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "crawl.json")
+	first := NewCrawler(fetcher, WithMaxPages(2), WithCheckpoint(path, 0)).Crawl(context.Background(), "https://golang.org/")
+	if first.StopReason != StopMaxPages || first.CheckpointErr != nil {
+		t.Fatalf("StopReason = %s, CheckpointErr = %v, want %s", first.StopReason, first.CheckpointErr, StopMaxPages)
+	}
+	cp, err := LoadCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp.Version != checkpointVersion || cp.Dispatched != 2 || len(cp.Frontier) == 0 || len(cp.Visited) == 0 {
+		t.Errorf("checkpoint = %+v, want 2 pages dispatched and a frontier", cp)
+	}
+
+	// the pages dispatched before the checkpoint count against the page budget
+	limited := NewCrawler(fetcher, WithMaxPages(3), WithResume(cp)).Crawl(context.Background(), "https://golang.org/")
+	if len(limited.Pages) != 1 {
+		t.Errorf("resumed crawl of 3 pages fetched %d, want 1", len(limited.Pages))
+	}
+
+	resumed := NewCrawler(fetcher, WithResume(cp)).Crawl(context.Background(), "https://golang.org/")
+	if resumed.StopReason != StopExhausted {
+		t.Errorf("StopReason = %s, want %s", resumed.StopReason, StopExhausted)
+	}
+	visits := make(map[URL]int)
+	for _, page := range append(first.Pages, resumed.Pages...) {
+		visits[page.URL]++
+	}
+	for url := range fetcher {
+		if visits[url] != 1 {
+			t.Errorf("%s visited %d times by the two crawls, want 1", url, visits[url])
+		}
+	}
+	if len(visits) != len(fetcher)+1 {
+		t.Errorf("visited %d urls, want %d", len(visits), len(fetcher)+1)
+	}
+}
+
+func TestLoadCheckpointErrors(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"malformed", "{not json"},
+		{"unsupported version", `{"Version": 99}`},
+	}
+	for _, test := range tests {
+		path := filepath.Join(dir, test.name)
+		if err := os.WriteFile(path, []byte(test.content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadCheckpoint(path); err == nil {
+			t.Errorf("%s: LoadCheckpoint succeeded", test.name)
+		}
+	}
+	if _, err := LoadCheckpoint(filepath.Join(dir, "missing")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("missing: err = %v, want a not exist error", err)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// DefaultCircuitFailures is the number of failures in a row that open the circuit of a host in a CircuitBreakerFetcher.
+const DefaultCircuitFailures = 5
+
+// DefaultCoolDown is how long the circuit of a host stays open in a CircuitBreakerFetcher without CoolDown.
+const DefaultCoolDown = time.Minute
+
+// SkipCircuitOpen is the Stats.Skipped reason of urls not fetched because the circuit of their host was open.
+const SkipCircuitOpen = "circuit open"
+
+// ErrCircuitOpen is wrapped by the SkippedResult of the fetches CircuitBreakerFetcher refuses.
+var ErrCircuitOpen = errors.New("circuit open")
+
+// CircuitBreakerFetcher stops fetching from a host after it failed MaxFailures times in a row, so a server that is down
+// does not cost a timeout for every url of its site. The urls of the host are skipped until CoolDown has passed,
+// then a single fetch probes the host, closing the circuit again when it succeeds.
+// Timeouts, 5xx responses and network errors are failures of the host, missing pages are not.
+type CircuitBreakerFetcher struct {
+	// Delegate is the Fetcher the fetches are sent to while the circuit of their host is closed.
+	Delegate Fetcher
+	// MaxFailures is the number of failures in a row that open the circuit, DefaultCircuitFailures when 0.
+	MaxFailures int
+	// CoolDown is how long the circuit stays open before probing the host, DefaultCoolDown when 0.
+	CoolDown time.Duration
+
+	lock  sync.Mutex
+	hosts map[string]*circuit
+}
+
+// circuit is the state of the circuit of a host.
+type circuit struct {
+	failures int
+	// openedAt is set while the circuit is open
+	openedAt time.Time
+	probing  bool
+}
+
+// Fetch is the implementation of Fetcher for CircuitBreakerFetcher.
+func (f *CircuitBreakerFetcher) Fetch(url string) (body string, urls []string, err error) {
+	return f.FetchContext(context.Background(), url)
+}
+
+// FetchContext is the implementation of ContextFetcher for CircuitBreakerFetcher.
+// Refused fetches fail with a SkippedResult wrapping ErrCircuitOpen.
+func (f *CircuitBreakerFetcher) FetchContext(ctx context.Context, rawURL string) (body string, urls []string, err error) {
+	host := rawURL
+	if u, err := url.Parse(rawURL); err == nil {
+		host = ToASCIIHost(u.Host)
+	}
+	c, probe := f.allow(host)
+	if c == nil {
+		return "", nil, &SkippedResult{URL: rawURL, Reason: SkipCircuitOpen, Err: ErrCircuitOpen}
+	}
+	body, urls, err = fetchContext(ctx, f.Delegate, rawURL)
+	f.report(c, probe, err)
+	return body, urls, err
+}
+
+// allow returns the circuit of host when a fetch may go through, and whether that fetch probes an open circuit.
+func (f *CircuitBreakerFetcher) allow(host string) (*circuit, bool) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.hosts == nil {
+		f.hosts = make(map[string]*circuit)
+	}
+	c, ok := f.hosts[host]
+	if !ok {
+		c = &circuit{}
+		f.hosts[host] = c
+	}
+	if c.openedAt.IsZero() {
+		return c, false
+	}
+	coolDown := f.CoolDown
+	if coolDown <= 0 {
+		coolDown = DefaultCoolDown
+	}
+	if c.probing || time.Since(c.openedAt) < coolDown {
+		return nil, false
+	}
+	c.probing = true
+	return c, true
+}
+
+// report accounts for a fetch that went through c.
+func (f *CircuitBreakerFetcher) report(c *circuit, probe bool, err error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if probe {
+		c.probing = false
+	}
+	switch {
+	case errors.Is(err, context.Canceled):
+		// the fetch was given up, which tells nothing about the host
+	case isHostFailure(err):
+		c.failures++
+		max := f.MaxFailures
+		if max <= 0 {
+			max = DefaultCircuitFailures
+		}
+		if probe || c.failures >= max {
+			c.openedAt = time.Now()
+		}
+	default:
+		c.failures = 0
+		c.openedAt = time.Time{}
+	}
+}
+
+// isHostFailure reports whether a fetch failing with err shows its host is in trouble.
+func isHostFailure(err error) bool {
+	var netErr net.Error
+	return err != nil && (isTransient(err) || errors.As(err, &netErr))
+}
@@ -0,0 +1,864 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Crawler is a worker pool based crawl engine.
+// A fixed number of workers fetch pages handed out from a frontier,
+// so the number of concurrent fetches stays bounded no matter how many links are found.
+// A Crawler is created with NewCrawler and configured with Options.
+type Crawler struct {
+	fetcher       Fetcher
+	depth         int
+	pathDepths    []pathDepth
+	concurrency   int
+	queueSize     int
+	visited       VisitedSet
+	strategy      Strategy
+	maxPages      int
+	score         ScoreFunc
+	scheduler     Scheduler
+	gracePeriod   time.Duration
+	fetchTimeout  time.Duration
+	crawlDeadline time.Time
+
+	checkpointPath     string
+	checkpointInterval time.Duration
+	resume             *Checkpoint
+
+	middlewares []FetchMiddleware
+
+	domainBudgets map[string]int
+	robots        *Robots
+	sitemaps      *Sitemaps
+	// bodyLimit is the number of bytes kept from streamed bodies, all of them when negative
+	bodyLimit int64
+	// scope limits the links followed to the hosts or domains of the seeds
+	scope Scope
+	// externalDepth is the number of links followed out of the scope, none when 0
+	externalDepth int
+	// include and exclude filter the links followed by their url
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+	// ignoreNofollow follows the links of pages asking not to, and reports them as indexable
+	ignoreNofollow bool
+	// normalizer rewrites the seeds and the links found, urls are crawled as they are when nil
+	normalizer *Normalizer
+	// dedup hashes the bodies of the pages, to find duplicates
+	dedup          bool
+	dedupSkipLinks bool
+	// canonicalDedup takes the pages declaring the same canonical url for one
+	canonicalDedup bool
+	// traps drops the links of suspected crawler traps, when not nil
+	traps *TrapDetector
+	// rewrites map the seeds and the links before they are enqueued, in order
+	rewrites []RewriteFunc
+	// router hands the pages to their handlers, when not nil
+	router *Router
+	// maxLinks is the number of links enqueued from a page, all of them when 0
+	maxLinks int
+	// sinks receive the crawled pages
+	sinks []Sink
+	// logger logs the crawl, nothing is logged when nil
+	logger *slog.Logger
+	// progress receives the progress of the crawl every progressInterval, when not nil
+	progress         func(Progress)
+	progressInterval time.Duration
+	// metrics collect the metrics of the crawl, when not nil
+	metrics *Metrics
+	// tracer exports the spans of the pages, when not nil
+	tracer *Tracer
+	// skipExtensions are the extensions of the links not fetched, checked with HEAD requests with checkSkipped
+	skipExtensions map[string]bool
+	checkSkipped   bool
+
+	recrawlInterval time.Duration
+	recrawlRules    []RecrawlRule
+}
+
+// NewCrawler returns a Crawler fetching pages with fetcher, configured by opts.
+func NewCrawler(fetcher Fetcher, opts ...Option) *Crawler {
+	c := &Crawler{
+		fetcher:     fetcher,
+		depth:       DefaultDepth,
+		concurrency: DefaultConcurrency,
+		bodyLimit:   -1,
+		normalizer:  &Normalizer{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.queueSize <= 0 {
+		c.queueSize = c.concurrency
+	}
+	c.fetcher = Chain(c.fetcher, c.middlewares...)
+	return c
+}
+
+// PageResult is the outcome of crawling a single page.
+type PageResult struct {
+	// URL is the url of the page.
+	URL URL
+	// Body is the body of the page.
+	Body string
+	// Links are the urls found on the page.
+	Links []URL
+	// Err is the error fetching the page, if any.
+	Err error
+	// Depth is the number of links between the seed and the page, the seed is at depth 0.
+	Depth int
+	// Parent is the page the url was first discovered on, and is empty for the seed.
+	Parent URL
+	// Meta are the details of the fetch known to the fetcher.
+	Meta FetchMeta
+	// Duration is the time the fetch took, the body and the links included.
+	Duration time.Duration
+	// ContentHash is the hex SHA-256 of Body, with WithDedup and a non empty body.
+	ContentHash string
+	// DuplicateOf is the page crawled before with the same body, with WithDedup, or with the same canonical url,
+	// with WithCanonicalDedup.
+	DuplicateOf URL
+	// NoIndex is set when the page asks not to be indexed, with a robots meta tag or header.
+	NoIndex bool
+	// Canonical is the canonical url the page declares, normalized, or an empty string.
+	Canonical URL
+	// External is set for the pages outside the scope, crawled with WithExternalDepth.
+	External bool
+	// Route is the name of the route of WithRouter the page was handled by, empty for the Default handler.
+	Route string
+	// Data is what the handler of the page extracted from it, with WithRouter.
+	Data interface{}
+	// HandlerErr is the error of the handler of the page, if any.
+	HandlerErr error
+}
+
+// StopReason is the condition that ended a crawl.
+type StopReason int
+
+const (
+	// StopExhausted means every reachable page was fetched.
+	StopExhausted StopReason = iota
+	// StopDepth means the frontier ran dry, but links beyond the maximum depth were left unfetched.
+	StopDepth
+	// StopMaxPages means the page budget was used up with urls still waiting in the frontier.
+	StopMaxPages
+	// StopCanceled means the crawl context was cancelled before the frontier ran dry.
+	StopCanceled
+	// StopDeadline means the crawl deadline passed before the frontier ran dry.
+	StopDeadline
+)
+
+func (r StopReason) String() string {
+	switch r {
+	case StopExhausted:
+		return "exhausted"
+	case StopDepth:
+		return "max depth"
+	case StopMaxPages:
+		return "max pages"
+	case StopCanceled:
+		return "canceled"
+	case StopDeadline:
+		return "deadline"
+	}
+	return fmt.Sprintf("StopReason(%d)", int(r))
+}
+
+// CrawlResult is the summary of a finished crawl.
+type CrawlResult struct {
+	// Pages are the crawled pages in the order they were fetched, when returned by Crawl.
+	// Pages abandoned because the crawl context was done are not included.
+	Pages []PageResult
+	// StopReason is the condition that ended the crawl.
+	StopReason StopReason
+	// Stats are the counters collected while crawling.
+	Stats Stats
+	// Abandoned is the number of fetches still in flight when the grace period expired.
+	Abandoned int
+	// CheckpointErr is the first error writing a checkpoint, if any.
+	CheckpointErr error
+	// SitemapErr is the first error reading the sitemaps of the seeds, if any.
+	SitemapErr error
+	// SinkErr is the first error writing a page to the sinks of WithSink, if any.
+	SinkErr error
+	// Duplicates are the urls found with the same body, or the same canonical url, as a page crawled before,
+	// by the url of that page, with WithDedup or WithCanonicalDedup.
+	Duplicates map[URL][]URL
+	// Traps are the suspected crawler traps whose links were dropped, with WithTrapDetector.
+	Traps []Trap
+}
+
+// outcome is reported back by a worker once a task has been fetched.
+type outcome struct {
+	task     Task
+	body     string
+	urls     []string
+	err      error
+	cacheHit bool
+	meta     FetchMeta
+	// start is when the fetch started, duration the time it took and parsed the time the links and the router
+	// took afterwards
+	start    time.Time
+	duration time.Duration
+	parsed   time.Duration
+	// canceled is set when the task was abandoned because the crawl is over, rather than fetched
+	canceled bool
+	// skipped is the Stats.Skipped reason when the task was dropped instead of fetched
+	skipped string
+	// contentHash is the hash of body, with dedup
+	contentHash string
+	// follow are the links of urls to follow
+	follow []URL
+	// route, data and handlerErr are those of the handler of the page, with a router
+	route      string
+	data       interface{}
+	handlerErr error
+}
+
+// Crawl crawls pages starting with the seeds, fetching at most concurrency pages at once.
+// All seeds share the same frontier and VisitedSet, so pages reachable from several seeds are fetched once.
+// Crawl blocks until the frontier is exhausted, the page budget is used up or ctx is done.
+// Once ctx is done no new pages are dispatched, and Crawl waits for the fetches in flight,
+// for at most the grace period when one is set.
+func (c *Crawler) Crawl(ctx context.Context, seeds ...URL) *CrawlResult {
+	it := c.Run(ctx, seeds...)
+	var pages []PageResult
+	for page, ok := it.Next(); ok; page, ok = it.Next() {
+		pages = append(pages, page)
+	}
+	result := it.Result()
+	result.Pages = pages
+	return result
+}
+
+// Run starts crawling pages starting with the seeds like Crawl, but streams the pages through an Iterator as they are fetched.
+// The crawl holds off while pages are not consumed. The Iterator must be drained or closed.
+func (c *Crawler) Run(ctx context.Context, seeds ...URL) *Iterator {
+	var cancel context.CancelFunc
+	if c.crawlDeadline.IsZero() {
+		ctx, cancel = context.WithCancel(ctx)
+	} else {
+		ctx, cancel = context.WithDeadline(ctx, c.crawlDeadline)
+	}
+	it := &Iterator{
+		pages:    make(chan PageResult),
+		finished: make(chan struct{}),
+		closed:   make(chan struct{}),
+		cancel:   cancel,
+	}
+	r := c.newRun(ctx)
+	r.pages = it.pages
+	r.closed = it.closed
+	go func() {
+		defer close(it.finished)
+		defer close(it.pages)
+		r.log.Info("crawl started", "seeds", len(seeds), "concurrency", c.concurrency)
+		r.startSinks(seeds)
+		if c.resume != nil {
+			r.resume(c.resume)
+		}
+		for _, url := range seeds {
+			r.seed(url)
+		}
+		if c.sitemaps != nil {
+			for _, url := range r.sitemapSeeds(seeds) {
+				r.seed(url)
+			}
+		}
+		r.loop()
+		it.result = r.finish()
+		cancel()
+	}()
+	return it
+}
+
+// Iterator streams the pages of a crawl started with Run.
+type Iterator struct {
+	pages     chan PageResult
+	finished  chan struct{}
+	closed    chan struct{}
+	closeOnce sync.Once
+	cancel    context.CancelFunc
+	result    *CrawlResult
+}
+
+// Next returns the next crawled page, reporting false once the crawl is over.
+func (it *Iterator) Next() (PageResult, bool) {
+	page, ok := <-it.pages
+	return page, ok
+}
+
+// Result waits for the crawl to end and returns its summary. Pages is always empty, they were handed out by Next.
+func (it *Iterator) Result() *CrawlResult {
+	<-it.finished
+	return it.result
+}
+
+// Close stops the crawl and waits for it to end. Pages not consumed yet are discarded.
+func (it *Iterator) Close() {
+	it.closeOnce.Do(func() {
+		close(it.closed)
+		it.cancel()
+	})
+	<-it.finished
+}
+
+// run is the state of a single crawl, owned by the goroutine dispatching tasks.
+type run struct {
+	c        *Crawler
+	ctx      context.Context
+	visited  VisitedSet
+	frontier Scheduler
+	result   *CrawlResult
+	start    time.Time
+
+	tasks    chan Task
+	outcomes chan outcome
+	// pages receives every crawled page, until closed is closed
+	pages  chan<- PageResult
+	closed <-chan struct{}
+	// quit is closed once the run stops collecting outcomes
+	quit          chan struct{}
+	workers       sync.WaitGroup
+	cancelFetches context.CancelFunc
+
+	inFlight int
+	// inFlightTasks are the dispatched tasks by url, kept for checkpoints
+	inFlightTasks map[URL]Task
+	dispatched    int
+	// hostDispatched counts dispatched tasks by budgetKey, for domain budgets
+	hostDispatched map[string]int
+	stopped        bool
+	abandoned      bool
+	depthPruned    bool
+
+	// contents are the first pages crawled by content hash, with dedup
+	contents map[string]URL
+	// scopes are the hosts or domains of the seeds, with a scope
+	scopes map[string]bool
+	// canonicals are the first pages crawled by canonical url, with canonicalDedup
+	canonicals map[URL]URL
+	// trapVariants counts the links followed by trap pattern, and traps are the suspected traps by pattern,
+	// with traps
+	trapVariants map[string]int
+	traps        map[string]*Trap
+
+	// busy is the number of workers fetching a page, updated atomically
+	busy int32
+
+	// log, fetchLog and frontierLog log the crawl, its fetches and the links it does not follow
+	log, fetchLog, frontierLog *slog.Logger
+}
+
+func (c *Crawler) newRun(ctx context.Context) *run {
+	r := &run{
+		c:        c,
+		ctx:      ctx,
+		visited:  c.visited,
+		frontier: c.scheduler,
+		result:   &CrawlResult{Stats: newStats()},
+		start:    time.Now(),
+		tasks:    make(chan Task, c.queueSize),
+		outcomes: make(chan outcome, c.concurrency),
+		quit:     make(chan struct{}),
+
+		inFlightTasks:  make(map[URL]Task),
+		hostDispatched: make(map[string]int),
+		scopes:         make(map[string]bool),
+
+		log:         componentLogger(c.logger, "crawler"),
+		fetchLog:    componentLogger(c.logger, "fetcher"),
+		frontierLog: componentLogger(c.logger, "frontier"),
+	}
+	if c.dedup {
+		r.contents = make(map[string]URL)
+	}
+	if c.canonicalDedup {
+		r.canonicals = make(map[URL]URL)
+	}
+	if c.traps != nil {
+		r.trapVariants = make(map[string]int)
+		r.traps = make(map[string]*Trap)
+	}
+	if c.dedup || c.canonicalDedup {
+		r.result.Duplicates = make(map[URL][]URL)
+	}
+	if r.visited == nil {
+		r.visited = NewMapVisitedSet()
+	}
+	if r.frontier == nil {
+		r.frontier = newScheduler(c.strategy, c.score)
+	}
+	// with a grace period, fetches in flight outlive the crawl context until the grace period expires
+	fetchCtx := ctx
+	if c.gracePeriod > 0 {
+		fetchCtx = detachedContext{ctx}
+	}
+	fetchCtx, r.cancelFetches = context.WithCancel(fetchCtx)
+	for i := 0; i < c.concurrency; i++ {
+		r.workers.Add(1)
+		go func() {
+			defer r.workers.Done()
+			r.work(fetchCtx)
+		}()
+	}
+	return r
+}
+
+// seed adds url to the frontier at depth 0.
+func (r *run) seed(url URL) {
+	url, ok := r.c.rewrite(r.c.normalize(url))
+	if !ok {
+		return
+	}
+	r.addScope(url)
+	if r.c.depthOf(url) > 0 && r.visited.Visit(url) {
+		r.frontier.Push(Task{URL: url})
+	}
+}
+
+// loop dispatches tasks and collects outcomes until there is nothing left to wait for.
+func (r *run) loop() {
+	// next is the task popped from the frontier waiting to be dispatched
+	var next Task
+	hasNext := false
+	var graceExpired <-chan time.Time
+	var checkpointTick <-chan time.Time
+	if r.c.checkpointPath != "" && r.c.checkpointInterval > 0 {
+		ticker := time.NewTicker(r.c.checkpointInterval)
+		defer ticker.Stop()
+		checkpointTick = ticker.C
+	}
+	var progressTick <-chan time.Time
+	if r.c.progress != nil && r.c.progressInterval > 0 {
+		ticker := time.NewTicker(r.c.progressInterval)
+		defer ticker.Stop()
+		progressTick = ticker.C
+	}
+	done := r.ctx.Done()
+	for {
+		if !hasNext && !r.stopped && r.budgetLeft() {
+			next, hasNext = r.popNext()
+		}
+		if !hasNext && r.inFlight == 0 {
+			return
+		}
+		// sending on a nil channel blocks forever, so nothing is dispatched while the frontier is empty
+		var dispatch chan<- Task
+		if hasNext {
+			dispatch = r.tasks
+		}
+		select {
+		case dispatch <- next:
+			hasNext = false
+			r.inFlight++
+			r.inFlightTasks[next.URL] = next
+			r.dispatched++
+			r.hostDispatched[r.budgetKey(next.URL)]++
+			r.setFrontierMetrics()
+		case o := <-r.outcomes:
+			r.inFlight--
+			delete(r.inFlightTasks, o.task.URL)
+			r.handle(o)
+			r.setFrontierMetrics()
+		case <-checkpointTick:
+			r.saveCheckpoint()
+		case <-progressTick:
+			r.reportProgress(false)
+		case <-done:
+			// stop dispatching, but keep collecting the tasks already handed out
+			if hasNext {
+				r.frontier.Push(next)
+				hasNext = false
+			}
+			r.stopped = true
+			done = nil
+			r.log.Info("crawl stopping", "in_flight", r.inFlight, "err", r.ctx.Err())
+			if r.c.gracePeriod > 0 {
+				timer := time.NewTimer(r.c.gracePeriod)
+				defer timer.Stop()
+				graceExpired = timer.C
+			}
+		case <-graceExpired:
+			r.abandoned = true
+			r.result.Abandoned = r.inFlight
+			return
+		}
+	}
+}
+
+func (r *run) budgetLeft() bool {
+	return r.c.maxPages <= 0 || r.dispatched < r.c.maxPages
+}
+
+// popNext pops the next task from the frontier, skipping tasks whose host used up its domain budget.
+func (r *run) popNext() (Task, bool) {
+	for {
+		t, ok := r.frontier.Pop()
+		if !ok {
+			return t, false
+		}
+		key := r.budgetKey(t.URL)
+		if budget, limited := r.domainBudget(key); limited && r.hostDispatched[key] >= budget {
+			r.result.Stats.Skipped[SkipDomainBudget]++
+			r.frontierLog.Debug("skipped", "url", t.URL, "reason", SkipDomainBudget)
+			continue
+		}
+		return t, true
+	}
+}
+
+// budgetKey returns what the pages of url count against the domain budgets by: the registrable domain of its host
+// when the budgets have an entry for the domain and not for the host, otherwise the host.
+func (r *run) budgetKey(url URL) string {
+	host := hostOf(url)
+	if _, ok := r.c.domainBudgets[host]; ok || len(r.c.domainBudgets) == 0 {
+		return host
+	}
+	name, _ := splitHostPort(host)
+	if domain := registrableDomain(name); domain != host {
+		if _, ok := r.c.domainBudgets[domain]; ok {
+			return domain
+		}
+	}
+	return host
+}
+
+// domainBudget returns the page budget of the host or domain key, falling back to the "*" entry of the domain budgets.
+func (r *run) domainBudget(key string) (int, bool) {
+	if budget, ok := r.c.domainBudgets[key]; ok {
+		return budget, true
+	}
+	budget, ok := r.c.domainBudgets["*"]
+	return budget, ok
+}
+
+// handle records the outcome of a fetch and enqueues the links it found.
+func (r *run) handle(o outcome) {
+	if o.canceled {
+		// keep the task for checkpoints, it was never fetched
+		r.frontier.Push(o.task)
+		r.dispatched--
+		r.hostDispatched[r.budgetKey(o.task.URL)]--
+		return
+	}
+	if o.skipped != "" {
+		// skipped tasks do not count against the budgets
+		r.result.Stats.Skipped[o.skipped]++
+		r.frontierLog.Debug("skipped", "url", o.task.URL, "reason", o.skipped)
+		r.dispatched--
+		r.hostDispatched[r.budgetKey(o.task.URL)]--
+		return
+	}
+	page := PageResult{
+		URL:    o.task.URL,
+		Body:   o.body,
+		Links:  o.urls,
+		Err:    o.err,
+		Depth:  o.task.Depth,
+		Parent: o.task.Parent,
+		Meta:   o.meta,
+
+		Duration: o.duration,
+		External: o.task.External > 0,
+
+		Route:      o.route,
+		Data:       o.data,
+		HandlerErr: o.handlerErr,
+	}
+	if !r.c.ignoreNofollow {
+		page.NoIndex, _ = robotsDirectives(o.meta)
+	}
+	if canonical := canonicalOf(page.URL, o.meta); canonical != "" {
+		page.Canonical = r.c.normalize(canonical)
+	}
+	// the links of a page with the canonical url of another are those of the other
+	canonicalDuplicate := false
+	if r.canonicals != nil && page.Canonical != "" && o.err == nil {
+		if first, ok := r.canonicals[page.Canonical]; ok && first != page.URL {
+			page.DuplicateOf = first
+			canonicalDuplicate = true
+		} else if !ok {
+			r.canonicals[page.Canonical] = page.URL
+			// the canonical url itself is not fetched again
+			r.visited.Visit(page.Canonical)
+		}
+	}
+	if o.contentHash != "" {
+		page.ContentHash = o.contentHash
+		if first, ok := r.contents[o.contentHash]; ok && page.DuplicateOf == "" {
+			page.DuplicateOf = first
+		} else if !ok {
+			r.contents[o.contentHash] = page.URL
+		}
+	}
+	if page.DuplicateOf != "" {
+		r.result.Duplicates[page.DuplicateOf] = append(r.result.Duplicates[page.DuplicateOf], page.URL)
+	}
+	r.result.Stats.record(page, o.cacheHit)
+	if r.c.metrics != nil {
+		r.c.metrics.observe(page, o.cacheHit, o.duration)
+	}
+	r.writeSinks(page)
+	select {
+	case r.pages <- page:
+	case <-r.closed:
+	}
+	if o.err != nil || canonicalDuplicate || page.DuplicateOf != "" && r.c.dedupSkipLinks {
+		r.tracePage(page, o, time.Time{})
+		return
+	}
+	enqueueStart := time.Now()
+	r.enqueue(o)
+	r.tracePage(page, o, enqueueStart)
+}
+
+// enqueue pushes the links of o to follow that were not visited yet to the frontier.
+func (r *run) enqueue(o outcome) {
+	var tasks []Task
+	for _, u := range o.follow {
+		u, ok := r.c.rewrite(u)
+		if !ok || !r.follows(u) {
+			continue
+		}
+		// the external links go as far as the external depth, whatever the depth of the page linking them
+		external := 0
+		if r.c.externalDepth > 0 && !r.internal(u) {
+			external = o.task.External + 1
+		}
+		if external > r.c.externalDepth || external == 0 && o.task.Depth+1 >= r.c.depthOf(u) {
+			r.depthPruned = r.depthPruned || !r.visited.Visited(u)
+			continue
+		}
+		if r.c.skipsExtension(u) && !r.c.checkSkipped {
+			if r.visited.Visit(u) {
+				r.result.Stats.Skipped[SkipExtension]++
+				r.frontierLog.Debug("skipped", "url", u, "reason", SkipExtension)
+			}
+			continue
+		}
+		if r.c.traps != nil && !r.visited.Visited(u) && r.trapped(u) {
+			// dropped links are not counted again
+			r.visited.Visit(u)
+			continue
+		}
+		if !r.visited.Visited(u) {
+			tasks = append(tasks, Task{URL: u, Depth: o.task.Depth + 1, Parent: o.task.URL, External: external})
+		}
+	}
+	if r.c.maxLinks > 0 && len(tasks) > r.c.maxLinks {
+		r.result.Stats.Skipped[SkipLinkCap] += len(tasks) - r.c.maxLinks
+		r.frontierLog.Debug("links capped", "url", o.task.URL, "links", len(tasks), "max_links", r.c.maxLinks)
+		tasks = r.c.bestTasks(tasks, r.c.maxLinks)
+	}
+	for _, t := range tasks {
+		if r.visited.Visit(t.URL) {
+			r.frontier.Push(t)
+		}
+	}
+}
+
+// setFrontierMetrics updates the frontier gauges of the metrics of the crawler, if any.
+func (r *run) setFrontierMetrics() {
+	if r.c.metrics != nil {
+		r.c.metrics.setFrontier(r.frontier.Len(), r.inFlight)
+	}
+}
+
+// bestTasks returns the n tasks with the highest scores, or the first n without a ScoreFunc.
+func (c *Crawler) bestTasks(tasks []Task, n int) []Task {
+	if c.score != nil {
+		scores := make(map[URL]int, len(tasks))
+		for _, t := range tasks {
+			scores[t.URL] = c.score(t.URL, t.Depth, t.Parent)
+		}
+		sort.SliceStable(tasks, func(i, j int) bool {
+			return scores[tasks[i].URL] > scores[tasks[j].URL]
+		})
+	}
+	return tasks[:n]
+}
+
+// follows reports whether the link url is followed, within the scope and the filters of the crawler.
+func (r *run) follows(url URL) bool {
+	return r.inScope(url) && r.c.allowed(url)
+}
+
+// finish stops the workers and completes the result.
+func (r *run) finish() *CrawlResult {
+	close(r.quit)
+	close(r.tasks)
+	r.cancelFetches()
+	if !r.abandoned {
+		r.workers.Wait()
+	}
+	switch {
+	case r.stopped && errors.Is(r.ctx.Err(), context.DeadlineExceeded):
+		r.result.StopReason = StopDeadline
+	case r.stopped:
+		r.result.StopReason = StopCanceled
+	case r.frontier.Len() > 0:
+		r.result.StopReason = StopMaxPages
+	case r.depthPruned:
+		r.result.StopReason = StopDepth
+	default:
+		r.result.StopReason = StopExhausted
+	}
+	if r.traps != nil {
+		r.result.Traps = r.trapReport()
+	}
+	r.saveCheckpoint()
+	r.result.Stats.Duration = time.Since(r.start)
+	r.setFrontierMetrics()
+	r.reportProgress(true)
+	r.finishSinks()
+	r.log.Info("crawl finished", "stop", r.result.StopReason.String(), "pages", r.result.Stats.PagesFetched,
+		"abandoned", r.result.Abandoned, "duration", r.result.Stats.Duration)
+	return r.result
+}
+
+// work fetches tasks until the tasks channel is closed.
+// Tasks still queued once the crawl context is done are reported back without being fetched.
+func (r *run) work(fetchCtx context.Context) {
+	for t := range r.tasks {
+		o := outcome{task: t}
+		if err := r.ctx.Err(); err != nil {
+			o.err = err
+			o.canceled = true
+		} else if r.c.robots != nil && !r.c.robots.Allowed(r.ctx, t.URL) {
+			o.skipped = SkipRobots
+		} else {
+			atomic.AddInt32(&r.busy, 1)
+			o.start = time.Now()
+			r.fetch(fetchCtx, &o)
+			o.duration = time.Since(o.start)
+			r.logFetch(o)
+			o.urls = r.c.normalizeLinks(o.urls)
+			o.follow = r.c.followedLinks(o.urls, o.meta)
+			if r.c.router != nil && o.err == nil {
+				r.route(fetchCtx, &o)
+			}
+			o.parsed = time.Since(o.start) - o.duration
+			atomic.AddInt32(&r.busy, -1)
+			// a fetch timing out is a failed page, the crawl ending is not
+			o.canceled = isContextError(o.err) && fetchCtx.Err() != nil
+			var skip *SkippedResult
+			if errors.As(o.err, &skip) {
+				o.skipped = skip.Reason
+			}
+		}
+		select {
+		case r.outcomes <- o:
+		case <-r.quit:
+			return
+		}
+	}
+}
+
+// logFetch logs the fetch of o, the failures at warn level and the others at debug level.
+func (r *run) logFetch(o outcome) {
+	var skip *SkippedResult
+	switch {
+	case errors.As(o.err, &skip):
+		// logged by the dispatcher
+	case o.err != nil && !isContextError(o.err):
+		r.fetchLog.Warn("fetch failed", "url", o.task.URL, "depth", o.task.Depth, "status", o.meta.StatusCode,
+			"duration", o.duration, "err", o.err)
+	case o.err == nil:
+		r.fetchLog.Debug("fetched", "url", o.task.URL, "depth", o.task.Depth, "status", o.meta.StatusCode,
+			"links", len(o.urls), "cache_hit", o.cacheHit, "duration", o.duration)
+	}
+}
+
+// fetch fetches the task of o into o, giving up after the fetch timeout.
+func (r *run) fetch(ctx context.Context, o *outcome) {
+	if r.c.fetchTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.c.fetchTimeout)
+		defer cancel()
+	}
+	ctx, trace := withFetchTrace(ctx)
+	trace.keepRouteFragments = r.c.normalizer != nil && r.c.normalizer.KeepRouteFragments
+	if r.c.checkSkipped && r.c.skipsExtension(o.task.URL) {
+		ctx = WithHeadOnly(ctx)
+	}
+	if sf, ok := r.c.fetcher.(StreamFetcher); ok {
+		o.body, o.urls, o.err = r.fetchStream(ctx, sf, o.task.URL)
+	} else {
+		o.body, o.urls, o.err = fetchContext(ctx, r.c.fetcher, o.task.URL)
+	}
+	o.cacheHit = trace.cacheHit
+	o.meta = trace.meta
+	if r.c.dedup && o.err == nil && o.body != "" {
+		// hashed by the worker, so large bodies do not hold up the dispatcher
+		sum := sha256.Sum256([]byte(o.body))
+		o.contentHash = hex.EncodeToString(sum[:])
+	}
+	if errors.Is(o.err, context.DeadlineExceeded) && r.c.fetchTimeout > 0 {
+		o.err = fmt.Errorf("fetch %s: timed out after %s: %w", o.task.URL, r.c.fetchTimeout, o.err)
+	}
+}
+
+// fetchStream fetches url with a StreamFetcher, extracting the links from the stream and keeping
+// the start of the body allowed by the body limit.
+func (r *run) fetchStream(ctx context.Context, sf StreamFetcher, url URL) (string, []URL, error) {
+	stream, err := sf.FetchStream(ctx, url)
+	if err != nil {
+		return "", nil, err
+	}
+	defer stream.Close()
+	body := &bodyPrefix{left: r.c.bodyLimit}
+	if stream.HTML {
+		links, err := extractLinks(ctx, io.TeeReader(stream, body), stream.URL)
+		return body.String(), links, err
+	}
+	src := io.Reader(stream)
+	if r.c.bodyLimit >= 0 {
+		// the rest of the body is not even downloaded
+		src = io.LimitReader(stream, r.c.bodyLimit)
+	}
+	_, err = io.Copy(body, src)
+	return body.String(), nil, err
+}
+
+// bodyPrefix keeps the first left bytes written to it, or all of them when left is negative.
+type bodyPrefix struct {
+	strings.Builder
+	left int64
+}
+
+func (b *bodyPrefix) Write(p []byte) (int, error) {
+	n := len(p)
+	if b.left >= 0 {
+		if int64(len(p)) > b.left {
+			p = p[:b.left]
+		}
+		b.left -= int64(len(p))
+	}
+	b.Builder.Write(p)
+	return n, nil
+}
+
+// detachedContext keeps the values of a context but not its cancellation.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+
+func (detachedContext) Done() <-chan struct{} { return nil }
+
+func (detachedContext) Err() error { return nil }
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestCrawlVisitsEveryPageOnce(t *testing.T) {
+	result := NewCrawler(fetcher, WithConcurrency(8)).Crawl(context.Background(), "https://golang.org/")
+	if result.StopReason != StopExhausted {
+		t.Errorf("StopReason = %s, want %s", result.StopReason, StopExhausted)
+	}
+	visits := make(map[URL]int)
+	for _, page := range result.Pages {
+		visits[page.URL]++
+		if _, ok := fetcher[page.URL]; !ok && !errors.Is(page.Err, ErrNotFound) {
+			t.Errorf("%s: err = %v, want ErrNotFound", page.URL, page.Err)
+		}
+	}
+	for url := range fetcher {
+		if visits[url] != 1 {
+			t.Errorf("%s visited %d times, want 1", url, visits[url])
+		}
+	}
+	// the links to a missing page are followed once too
+	if visits["https://golang.org/cmd/"] != 1 {
+		t.Errorf("https://golang.org/cmd/ visited %d times, want 1", visits["https://golang.org/cmd/"])
+	}
+	if len(visits) != len(fetcher)+1 {
+		t.Errorf("visited %d urls, want %d", len(visits), len(fetcher)+1)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// DefaultCSVColumns are the columns written by a CSVSink without columns of its own.
+var DefaultCSVColumns = []string{"url", "status", "depth", "parent", "content-type", "size", "latency", "error"}
+
+// csvColumns return the value of a column of a CSVSink for a page, by column name.
+var csvColumns = map[string]func(page PageResult) string{
+	"url":    func(page PageResult) string { return page.URL },
+	"status": func(page PageResult) string { return formatNonZero(page.Meta.StatusCode) },
+	"depth":  func(page PageResult) string { return strconv.Itoa(page.Depth) },
+	"parent": func(page PageResult) string { return page.Parent },
+	"content-type": func(page PageResult) string {
+		return page.Meta.Header.Get("Content-Type")
+	},
+	// size is the size of the body as transferred, as counted in Stats.BytesDownloaded
+	"size": func(page PageResult) string { return strconv.FormatInt(bodySize(page), 10) },
+	// latency is in milliseconds, which spreadsheets can compute with
+	"latency": func(page PageResult) string {
+		if page.Meta.Latency == 0 {
+			return ""
+		}
+		return strconv.FormatFloat(float64(page.Meta.Latency)/float64(time.Millisecond), 'f', 3, 64)
+	},
+	"error": func(page PageResult) string {
+		if page.Err == nil {
+			return ""
+		}
+		return page.Err.Error()
+	},
+	"title":        func(page PageResult) string { return page.Meta.Title },
+	"links":        func(page PageResult) string { return strconv.Itoa(len(page.Links)) },
+	"duplicate-of": func(page PageResult) string { return page.DuplicateOf },
+	"canonical":    func(page PageResult) string { return page.Canonical },
+}
+
+// CSVSink writes the pages to a CSV file, a row per page under a header row naming the columns.
+type CSVSink struct {
+	w       *csv.Writer
+	columns []string
+	// header is set once the header row is written
+	header bool
+}
+
+// NewCSVSink returns a CSVSink writing columns to w, or DefaultCSVColumns without columns.
+// The columns are those of DefaultCSVColumns, along with title, links for the number of links,
+// duplicate-of and canonical.
+func NewCSVSink(w io.Writer, columns ...string) (*CSVSink, error) {
+	if len(columns) == 0 {
+		columns = DefaultCSVColumns
+	}
+	for _, column := range columns {
+		if csvColumns[column] == nil {
+			return nil, fmt.Errorf("unknown CSV column %q", column)
+		}
+	}
+	return &CSVSink{w: csv.NewWriter(w), columns: columns}, nil
+}
+
+// Write is the implementation of Sink for CSVSink.
+func (s *CSVSink) Write(page PageResult) error {
+	if err := s.writeHeader(); err != nil {
+		return err
+	}
+	record := make([]string, len(s.columns))
+	for i, column := range s.columns {
+		record[i] = csvColumns[column](page)
+	}
+	return s.w.Write(record)
+}
+
+// Close is the implementation of Sink for CSVSink, it flushes the rows, writing the header row of
+// a crawl without pages.
+func (s *CSVSink) Close() error {
+	if err := s.writeHeader(); err != nil {
+		return err
+	}
+	s.w.Flush()
+	return s.w.Error()
+}
+
+func (s *CSVSink) writeHeader() error {
+	if s.header {
+		return nil
+	}
+	s.header = true
+	return s.w.Write(s.columns)
+}
+
+// formatNonZero formats n, or returns an empty string when n is 0.
+func formatNonZero(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
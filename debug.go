@@ -0,0 +1,41 @@
+package main
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"sync"
+)
+
+// handleDebug adds the debug endpoints of the crawler command to mux: the expvars on /debug/vars, with the memory
+// statistics, the number of goroutines and the progress of the crawl once publishProgress was called, and the
+// profiles of net/http/pprof on /debug/pprof/.
+func handleDebug(mux *http.ServeMux) {
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+}
+
+// publishProgress publishes the goroutines expvar, and the crawl one with the last Progress given to the function
+// it returns, for WithProgress. It must be called once.
+func publishProgress() func(Progress) {
+	var mu sync.Mutex
+	var last Progress
+	expvar.Publish("goroutines", expvar.Func(func() interface{} {
+		return runtime.NumGoroutine()
+	}))
+	expvar.Publish("crawl", expvar.Func(func() interface{} {
+		mu.Lock()
+		defer mu.Unlock()
+		return last
+	}))
+	return func(p Progress) {
+		mu.Lock()
+		defer mu.Unlock()
+		last = p
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// DiskStore is a CacheStore keeping every result in a JSON file of its own in Dir, so results survive restarts
+// and large crawls are not limited by memory. The files are named after the sha256 of their url.
+// Failing to read or write a file makes the result a miss, the first such error is reported by Err.
+//
+// It is a file per entry rather than an embedded key-value store such as bbolt or badger, which the standard
+// library has none of: a crawl of millions of pages takes millions of inodes, a file system call or more per Get
+// and Set, and a temporary file and a rename per Set. Results are replaced one at a time, there is no batch of
+// writes applied atomically, and Len and Range walk the whole directory.
+type DiskStore struct {
+	// Dir is the directory of the files, it is created when missing.
+	Dir string
+
+	lock sync.Mutex
+	err  error
+}
+
+// path returns the file of the result of url, spread over 256 subdirectories.
+func (d *DiskStore) path(url URL) string {
+	sum := sha256.Sum256([]byte(url))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(d.Dir, name[:2], name+".json")
+}
+
+// Get is the implementation of CacheStore for DiskStore.
+func (d *DiskStore) Get(url URL) (*FetchResult, bool) {
+	data, err := os.ReadFile(d.path(url))
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			d.fail(err)
+		}
+		return nil, false
+	}
+	var record cacheRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		d.fail(err)
+		return nil, false
+	}
+	// a hash collision is a miss
+	if record.URL != url {
+		return nil, false
+	}
+	return record.result(), true
+}
+
+// Set is the implementation of CacheStore for DiskStore, the file is replaced atomically.
+func (d *DiskStore) Set(url URL, result *FetchResult) {
+	data, err := json.Marshal(newCacheRecord(url, result))
+	if err != nil {
+		d.fail(err)
+		return
+	}
+	path := d.path(url)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		d.fail(err)
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		d.fail(err)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		d.fail(err)
+		return
+	}
+	if err := tmp.Close(); err != nil {
+		d.fail(err)
+		return
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		d.fail(err)
+	}
+}
+
+// Delete is the implementation of CacheStore for DiskStore.
+func (d *DiskStore) Delete(url URL) {
+	if err := os.Remove(d.path(url)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		d.fail(err)
+	}
+}
+
+// Len is the implementation of CacheStore for DiskStore, it counts the files of Dir.
+func (d *DiskStore) Len() int {
+	n := 0
+	filepath.WalkDir(d.Dir, func(path string, entry fs.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() && strings.HasSuffix(path, ".json") {
+			n++
+		}
+		return nil
+	})
+	return n
+}
+
+// Range is the implementation of CacheRanger for DiskStore.
+func (d *DiskStore) Range(fn func(url URL, result *FetchResult) bool) {
+	filepath.WalkDir(d.Dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || !strings.HasSuffix(path, ".json") {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			d.fail(err)
+			return nil
+		}
+		var record cacheRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			d.fail(err)
+			return nil
+		}
+		if !fn(record.URL, record.result()) {
+			return errStopRange
+		}
+		return nil
+	})
+}
+
+// errStopRange stops the walk of Range.
+var errStopRange = errors.New("stop range")
+
+// Err returns the first error reading or writing the files of the store, if any.
+func (d *DiskStore) Err() error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.err
+}
+
+func (d *DiskStore) fail(err error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.err == nil {
+		d.err = err
+	}
+}
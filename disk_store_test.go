@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiskStore(t *testing.T) {
+	// the directory is created when missing
+	testCacheStore(t, &DiskStore{Dir: filepath.Join(t.TempDir(), "cache")})
+}
+
+func TestDiskStoreSurvivesRestarts(t *testing.T) {
+	dir := t.TempDir()
+	first := &countingFetcher{}
+	cache := NewFetcherCache(first, WithStore(&DiskStore{Dir: dir}))
+	cache.Fetch("https://example.com/")
+	cache.Close()
+
+	second := &countingFetcher{}
+	cache = NewFetcherCache(second, WithStore(&DiskStore{Dir: dir}))
+	defer cache.Close()
+	body, _, err := cache.Fetch("https://example.com/")
+	if err != nil || body != "body of https://example.com/" {
+		t.Errorf("Fetch = %q, %v, want the body of the first crawl", body, err)
+	}
+	if n := second.count("https://example.com/"); n != 0 {
+		t.Errorf("fetched %d times after the restart, want 0", n)
+	}
+}
+
+func TestDiskStoreCorruptFile(t *testing.T) {
+	store := &DiskStore{Dir: t.TempDir()}
+	store.Set("https://example.com/", &FetchResult{body: "page"})
+	if err := os.WriteFile(store.path("https://example.com/"), []byte("{not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.Get("https://example.com/"); ok {
+		t.Error("Get of a corrupt file found a result")
+	}
+	if store.Err() == nil {
+		t.Error("Err = nil, want the error reading the corrupt file")
+	}
+}
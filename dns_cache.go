@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// DefaultDNSTTL is how long a DNSCache without TTL keeps the addresses of a host.
+const DefaultDNSTTL = 5 * time.Minute
+
+// DNSCache resolves host names once per TTL, so a crawl of many pages of the same hosts does not ask the resolver every
+// time a connection is opened. It is plugged into an HTTPFetcher with TransportConfig.DNSCache.
+// Concurrent lookups of a host wait for the same answer, failed lookups are not cached.
+type DNSCache struct {
+	// Resolver looks up the hosts, net.DefaultResolver when nil.
+	Resolver *net.Resolver
+	// TTL is how long the addresses of a host are kept, DefaultDNSTTL when 0.
+	TTL time.Duration
+
+	lock  sync.Mutex
+	hosts map[string]*dnsEntry
+}
+
+type dnsEntry struct {
+	// ready is closed once addrs and err are set
+	ready   chan struct{}
+	addrs   []string
+	err     error
+	expires time.Time
+}
+
+// LookupHost returns the addresses of host, from the cache when they are fresh.
+func (d *DNSCache) LookupHost(ctx context.Context, host string) ([]string, error) {
+	d.lock.Lock()
+	if d.hosts == nil {
+		d.hosts = make(map[string]*dnsEntry)
+	}
+	entry, ok := d.hosts[host]
+	if ok && !entry.expired() {
+		d.lock.Unlock()
+		select {
+		case <-entry.ready:
+			return entry.addrs, entry.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	entry = &dnsEntry{ready: make(chan struct{})}
+	d.hosts[host] = entry
+	d.lock.Unlock()
+
+	resolver := d.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	// the lookup is shared by the fetches waiting for it, so it is not cancelled with the first of them
+	entry.addrs, entry.err = resolver.LookupHost(detachedContext{ctx}, host)
+	ttl := d.TTL
+	if ttl <= 0 {
+		ttl = DefaultDNSTTL
+	}
+	d.lock.Lock()
+	entry.expires = time.Now().Add(ttl)
+	if entry.err != nil && d.hosts[host] == entry {
+		delete(d.hosts, host)
+	}
+	d.lock.Unlock()
+	close(entry.ready)
+	return entry.addrs, entry.err
+}
+
+// expired reports whether the addresses of e are stale, lookups in progress are not.
+func (e *dnsEntry) expired() bool {
+	select {
+	case <-e.ready:
+		return time.Now().After(e.expires)
+	default:
+		return false
+	}
+}
+
+// DialContext dials address like net.Dialer, resolving its host with the cache and trying its addresses in turn.
+func (d *DNSCache) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if net.ParseIP(host) != nil {
+		return dialer.DialContext(ctx, network, address)
+	}
+	addrs, err := d.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	// the error of the first address is the one reported, like net.Dialer does
+	var firstErr error
+	for _, addr := range addrs {
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(addr, port))
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if firstErr == nil {
+		firstErr = &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return nil, firstErr
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultBulkSize is the number of pages an ElasticsearchSink without BulkSize indexes per bulk request.
+const DefaultBulkSize = 500
+
+// SearchDocument is the document an ElasticsearchSink indexes for a page, with the field names of search indexes.
+type SearchDocument struct {
+	URL   URL    `json:"url"`
+	Title string `json:"title,omitempty"`
+	// Text is the text of the page, without its markup for HTML ones.
+	Text   string `json:"text,omitempty"`
+	Status int    `json:"status,omitempty"`
+	Depth  int    `json:"depth"`
+	// Headers are the headers of the response, the values of repeated ones joined with commas.
+	Headers   map[string]string `json:"headers,omitempty"`
+	FetchedAt time.Time         `json:"fetched_at"`
+}
+
+// NewSearchDocument returns the SearchDocument of page, fetched at t.
+func NewSearchDocument(page PageResult, t time.Time) SearchDocument {
+	doc := SearchDocument{
+		URL:       page.URL,
+		Title:     page.Meta.Title,
+		Status:    page.Meta.StatusCode,
+		Depth:     page.Depth,
+		FetchedAt: t.UTC(),
+	}
+	if isHTML(page.Meta.Header.Get("Content-Type")) {
+		doc.Text = htmlText(page.Body)
+	} else {
+		doc.Text = strings.Join(strings.Fields(page.Body), " ")
+	}
+	if len(page.Meta.Header) > 0 {
+		doc.Headers = make(map[string]string, len(page.Meta.Header))
+		for name, values := range page.Meta.Header {
+			doc.Headers[name] = strings.Join(values, ", ")
+		}
+	}
+	return doc
+}
+
+// ElasticsearchSink indexes the pages crawled without error into an Elasticsearch or OpenSearch index with the
+// bulk API, as SearchDocuments, so a crawl can feed a search engine. Documents are identified by the SHA-256
+// of their url, a page crawled again replaces its document.
+type ElasticsearchSink struct {
+	// URL is the url of the cluster, such as http://localhost:9200.
+	URL string
+	// Index is the index the documents are indexed into, created by the cluster when it does not exist.
+	Index string
+	// Username and Password, when set, authenticate the requests with basic auth.
+	Username, Password string
+	// APIKey, when set, authenticates the requests with an API key instead.
+	APIKey string
+	// BulkSize is the number of pages indexed per bulk request, DefaultBulkSize when not positive.
+	BulkSize int
+	// Client sends the requests, http.DefaultClient when nil.
+	Client *http.Client
+
+	// bulk is the body of the next bulk request
+	bulk bytes.Buffer
+	// pending is the number of pages in bulk
+	pending int
+}
+
+// Write is the implementation of Sink for ElasticsearchSink.
+func (s *ElasticsearchSink) Write(page PageResult) error {
+	if page.Err != nil {
+		return nil
+	}
+	sum := sha256.Sum256([]byte(page.URL))
+	action := map[string]interface{}{"index": map[string]string{"_index": s.Index, "_id": hex.EncodeToString(sum[:])}}
+	for _, v := range []interface{}{action, NewSearchDocument(page, time.Now())} {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		s.bulk.Write(data)
+		s.bulk.WriteByte('\n')
+	}
+	s.pending++
+	bulkSize := s.BulkSize
+	if bulkSize <= 0 {
+		bulkSize = DefaultBulkSize
+	}
+	if s.pending < bulkSize {
+		return nil
+	}
+	return s.flush()
+}
+
+// Close is the implementation of Sink for ElasticsearchSink, it indexes the pages left.
+func (s *ElasticsearchSink) Close() error {
+	return s.flush()
+}
+
+// bulkResponse is the part of the response of the bulk API telling the failed items apart.
+type bulkResponse struct {
+	Errors bool
+	Items  []map[string]struct {
+		Status int
+		Error  json.RawMessage
+	}
+}
+
+// flush sends the pending pages in a bulk request, failing with the error of the first page that was not indexed.
+func (s *ElasticsearchSink) flush() error {
+	if s.pending == 0 {
+		return nil
+	}
+	pending := s.pending
+	s.pending = 0
+	defer s.bulk.Reset()
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(s.URL, "/")+"/_bulk", bytes.NewReader(s.bulk.Bytes()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	switch {
+	case s.APIKey != "":
+		req.Header.Set("Authorization", "ApiKey "+s.APIKey)
+	case s.Username != "":
+		req.SetBasicAuth(s.Username, s.Password)
+	}
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("bulk index %d pages: %s: %s", pending, resp.Status, strings.TrimSpace(lastLine(string(body))))
+	}
+	var result bulkResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return fmt.Errorf("bulk index %d pages: %w", pending, err)
+	}
+	if !result.Errors {
+		return nil
+	}
+	failed := 0
+	var first json.RawMessage
+	for _, item := range result.Items {
+		for _, status := range item {
+			if status.Status >= 300 {
+				if failed == 0 {
+					first = status.Error
+				}
+				failed++
+			}
+		}
+	}
+	return fmt.Errorf("bulk index %d pages: %d failed: %s", pending, failed, first)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// SkipExtension is the Stats.Skipped reason of the links not fetched because of their extension,
+// see WithSkipExtensions.
+const SkipExtension = "extension"
+
+// DefaultSkipExtensions are the extensions of the files that are not pages: archives, documents, images, media,
+// executables, fonts, style sheets and scripts.
+var DefaultSkipExtensions = []string{
+	".7z", ".bz2", ".gz", ".rar", ".tar", ".tgz", ".xz", ".zip",
+	".doc", ".docx", ".odp", ".ods", ".odt", ".pdf", ".ppt", ".pptx", ".xls", ".xlsx",
+	".bmp", ".gif", ".ico", ".jpeg", ".jpg", ".png", ".svg", ".tif", ".tiff", ".webp",
+	".avi", ".flac", ".m4a", ".mkv", ".mov", ".mp3", ".mp4", ".ogg", ".wav", ".webm", ".wmv",
+	".apk", ".bin", ".deb", ".dmg", ".exe", ".iso", ".msi", ".rpm",
+	".eot", ".otf", ".ttf", ".woff", ".woff2",
+	".css", ".js",
+}
+
+// extensionOf returns the extension of the path of rawURL lowercased, such as ".pdf", or an empty string.
+func extensionOf(rawURL URL) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(path.Ext(u.Path))
+}
+
+// skipsExtension reports whether the link url is not fetched because of its extension.
+func (c *Crawler) skipsExtension(url URL) bool {
+	return len(c.skipExtensions) > 0 && c.skipExtensions[extensionOf(url)]
+}
+
+type headOnlyKey struct{}
+
+// WithHeadOnly returns a context asking the fetcher to only check that the page exists, with a HEAD request
+// for HTTPFetcher, returning an empty body and no links. Other fetchers fetch the page as usual.
+func WithHeadOnly(ctx context.Context) context.Context {
+	return context.WithValue(ctx, headOnlyKey{}, true)
+}
+
+// HeadOnlyFromContext reports whether ctx asks for a check without the body, see WithHeadOnly.
+func HeadOnlyFromContext(ctx context.Context) bool {
+	headOnly, _ := ctx.Value(headOnlyKey{}).(bool)
+	return headOnly
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// FileFetcher is a Fetcher for file:// urls, which crawls exported static sites or documentation builds
+// without a web server. HTML files have their links extracted, directories are listed as pages linking to their entries.
+type FileFetcher struct {
+	// Root, when set, is the only directory tree files are read from.
+	Root string
+}
+
+// Fetch is the implementation of Fetcher for FileFetcher.
+func (f *FileFetcher) Fetch(url string) (body string, urls []string, err error) {
+	return f.FetchContext(context.Background(), url)
+}
+
+// FetchContext is the implementation of ContextFetcher for FileFetcher.
+func (f *FileFetcher) FetchContext(ctx context.Context, rawURL string) (body string, urls []string, err error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", nil, err
+	}
+	if u.Scheme != "file" {
+		return "", nil, fmt.Errorf("%s: not a file url", rawURL)
+	}
+	name := filepath.FromSlash(u.Path)
+	if f.Root != "" && !withinDir(f.Root, name) {
+		return "", nil, fmt.Errorf("%s: outside of %s", rawURL, f.Root)
+	}
+	info, err := os.Stat(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil, fmt.Errorf("%w: %s", ErrNotFound, rawURL)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	if info.IsDir() {
+		return listDir(u, name)
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return "", nil, err
+	}
+	body = string(data)
+	switch strings.ToLower(path.Ext(u.Path)) {
+	case ".html", ".htm", ".xhtml":
+		urls, err = extractLinks(ctx, strings.NewReader(body), rawURL)
+	}
+	return body, urls, err
+}
+
+// listDir returns a listing of the directory name, one entry per line, linking to every entry.
+func listDir(u *url.URL, name string) (body string, urls []string, err error) {
+	entries, err := os.ReadDir(name)
+	if err != nil {
+		return "", nil, err
+	}
+	names := make([]string, len(entries))
+	isDir := make(map[string]bool)
+	for i, entry := range entries {
+		names[i] = entry.Name()
+		isDir[entry.Name()] = entry.IsDir()
+	}
+	body, urls = listingLinks(u, names, isDir)
+	return body, urls, nil
+}
+
+// withinDir reports whether name is root or inside of it.
+func withinDir(root, name string) bool {
+	rel, err := filepath.Rel(root, name)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// FileURL returns the file:// url of the local path name.
+func FileURL(name string) (URL, error) {
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return "", err
+	}
+	u := url.URL{Scheme: "file", Path: filepath.ToSlash(abs)}
+	if info, err := os.Stat(abs); err == nil && info.IsDir() && !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	return u.String(), nil
+}
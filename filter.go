@@ -0,0 +1,75 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// CompileGlob returns the regexp matching the urls matched by glob, to be given to WithInclude or WithExclude.
+// In glob, * matches any run of characters but /, ** any run of characters and ? any character but /.
+// A glob starting with / is matched against the path of the urls, such as /docs/**, others against the whole url,
+// such as https://*.golang.org/**.
+func CompileGlob(glob string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	if strings.HasPrefix(glob, "/") {
+		// any scheme and host, and any query after the path
+		b.WriteString(`^[^:/?#]+://[^/?#]*`)
+	} else {
+		b.WriteString("^")
+	}
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; {
+		case c == '*' && i+1 < len(glob) && glob[i+1] == '*':
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	if strings.HasPrefix(glob, "/") {
+		b.WriteString(`(\?.*)?`)
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// allowed reports whether the link url passes the include and exclude patterns of the crawler.
+func (c *Crawler) allowed(url URL) bool {
+	for _, pattern := range c.exclude {
+		if pattern.MatchString(url) {
+			return false
+		}
+	}
+	if len(c.include) == 0 {
+		return true
+	}
+	for _, pattern := range c.include {
+		if pattern.MatchString(url) {
+			return true
+		}
+	}
+	return false
+}
+
+// patternsFlag is a flag.Value collecting patterns compiled by compile, it can be repeated.
+type patternsFlag struct {
+	patterns *[]*regexp.Regexp
+	compile  func(pattern string) (*regexp.Regexp, error)
+}
+
+func (f *patternsFlag) String() string {
+	return ""
+}
+
+func (f *patternsFlag) Set(s string) error {
+	pattern, err := f.compile(s)
+	if err != nil {
+		return err
+	}
+	*f.patterns = append(*f.patterns, pattern)
+	return nil
+}
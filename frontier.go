@@ -0,0 +1,206 @@
+package main
+
+import "container/heap"
+
+// Strategy decides the order in which the default Schedulers hand out urls.
+type Strategy int
+
+const (
+	// BreadthFirst fetches the closest pages to the seed first.
+	BreadthFirst Strategy = iota
+	// DepthFirst follows the most recently discovered links first.
+	DepthFirst
+)
+
+// Task is a url waiting in the frontier of a crawl.
+type Task struct {
+	// URL is the url to fetch.
+	URL URL
+	// Depth is the number of links between the seed and URL, the seed is at depth 0.
+	Depth int
+	// Parent is the page URL was discovered on, and is empty for the seed.
+	Parent URL `json:",omitempty"`
+	// External is the number of links between the last page within the scope and URL, with WithExternalDepth,
+	// and 0 for the pages within the scope.
+	External int `json:",omitempty"`
+}
+
+// Scheduler manages the frontier, the tasks waiting to be fetched.
+// A Scheduler is only used by the goroutine dispatching tasks, so it does not need to be safe for concurrent use,
+// but it holds the frontier of a single crawl at a time.
+type Scheduler interface {
+	// Push adds a task to the frontier.
+	Push(t Task)
+	// Pop removes the next task, reporting false when the frontier is empty.
+	Pop() (Task, bool)
+	// Len returns the number of waiting tasks.
+	Len() int
+}
+
+// TaskLister is implemented by Schedulers that can list their tasks, which is needed to checkpoint them.
+type TaskLister interface {
+	// Tasks returns the waiting tasks without removing them, pushing them in order rebuilds the frontier.
+	Tasks() []Task
+}
+
+// ScoreFunc scores a discovered url, higher scores are fetched first.
+// parent is the page url was found on, and is empty for the seed.
+type ScoreFunc func(url URL, depth int, parent URL) int
+
+// newScheduler returns the default Scheduler implementing strategy, or a priority Scheduler when score is set.
+func newScheduler(strategy Strategy, score ScoreFunc) Scheduler {
+	if score != nil {
+		return NewPriorityScheduler(score)
+	}
+	if strategy == DepthFirst {
+		return NewLIFOScheduler()
+	}
+	return NewFIFOScheduler()
+}
+
+// FIFOScheduler is an in memory first in first out Scheduler, used for BreadthFirst.
+type FIFOScheduler struct {
+	queue []Task
+	head  int
+}
+
+// NewFIFOScheduler returns an empty FIFOScheduler.
+func NewFIFOScheduler() *FIFOScheduler {
+	return &FIFOScheduler{}
+}
+
+// Push is the implementation of Scheduler.Push for FIFOScheduler.
+func (q *FIFOScheduler) Push(t Task) {
+	q.queue = append(q.queue, t)
+}
+
+// Pop is the implementation of Scheduler.Pop for FIFOScheduler.
+func (q *FIFOScheduler) Pop() (Task, bool) {
+	if q.head == len(q.queue) {
+		return Task{}, false
+	}
+	t := q.queue[q.head]
+	q.queue[q.head] = Task{}
+	q.head++
+	if q.head == len(q.queue) {
+		// reuse the backing array once drained
+		q.queue = q.queue[:0]
+		q.head = 0
+	}
+	return t, true
+}
+
+// Len is the implementation of Scheduler.Len for FIFOScheduler.
+func (q *FIFOScheduler) Len() int {
+	return len(q.queue) - q.head
+}
+
+// Tasks is the implementation of TaskLister for FIFOScheduler.
+func (q *FIFOScheduler) Tasks() []Task {
+	return append([]Task(nil), q.queue[q.head:]...)
+}
+
+// LIFOScheduler is an in memory last in first out Scheduler, used for DepthFirst.
+type LIFOScheduler struct {
+	stack []Task
+}
+
+// NewLIFOScheduler returns an empty LIFOScheduler.
+func NewLIFOScheduler() *LIFOScheduler {
+	return &LIFOScheduler{}
+}
+
+// Push is the implementation of Scheduler.Push for LIFOScheduler.
+func (s *LIFOScheduler) Push(t Task) {
+	s.stack = append(s.stack, t)
+}
+
+// Pop is the implementation of Scheduler.Pop for LIFOScheduler.
+func (s *LIFOScheduler) Pop() (Task, bool) {
+	if len(s.stack) == 0 {
+		return Task{}, false
+	}
+	t := s.stack[len(s.stack)-1]
+	s.stack = s.stack[:len(s.stack)-1]
+	return t, true
+}
+
+// Len is the implementation of Scheduler.Len for LIFOScheduler.
+func (s *LIFOScheduler) Len() int {
+	return len(s.stack)
+}
+
+// Tasks is the implementation of TaskLister for LIFOScheduler.
+func (s *LIFOScheduler) Tasks() []Task {
+	return append([]Task(nil), s.stack...)
+}
+
+// PriorityScheduler hands out the task with the highest score first,
+// tasks with equal scores are handed out in the order they were pushed.
+type PriorityScheduler struct {
+	score ScoreFunc
+	heap  taskHeap
+	seq   int
+}
+
+// NewPriorityScheduler returns an empty PriorityScheduler scoring tasks with score.
+func NewPriorityScheduler(score ScoreFunc) *PriorityScheduler {
+	return &PriorityScheduler{score: score}
+}
+
+// Push is the implementation of Scheduler.Push for PriorityScheduler.
+func (p *PriorityScheduler) Push(t Task) {
+	heap.Push(&p.heap, scoredTask{task: t, score: p.score(t.URL, t.Depth, t.Parent), seq: p.seq})
+	p.seq++
+}
+
+// Pop is the implementation of Scheduler.Pop for PriorityScheduler.
+func (p *PriorityScheduler) Pop() (Task, bool) {
+	if p.heap.Len() == 0 {
+		return Task{}, false
+	}
+	return heap.Pop(&p.heap).(scoredTask).task, true
+}
+
+// Len is the implementation of Scheduler.Len for PriorityScheduler.
+func (p *PriorityScheduler) Len() int {
+	return p.heap.Len()
+}
+
+// Tasks is the implementation of TaskLister for PriorityScheduler.
+func (p *PriorityScheduler) Tasks() []Task {
+	tasks := make([]Task, len(p.heap))
+	for i, st := range p.heap {
+		tasks[i] = st.task
+	}
+	return tasks
+}
+
+type scoredTask struct {
+	task  Task
+	score int
+	seq   int
+}
+
+// taskHeap implements heap.Interface for PriorityScheduler.
+type taskHeap []scoredTask
+
+func (h taskHeap) Len() int { return len(h) }
+
+func (h taskHeap) Less(i, j int) bool {
+	if h[i].score != h[j].score {
+		return h[i].score > h[j].score
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h taskHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *taskHeap) Push(x interface{}) { *h = append(*h, x.(scoredTask)) }
+
+func (h *taskHeap) Pop() interface{} {
+	old := *h
+	t := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return t
+}
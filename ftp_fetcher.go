@@ -0,0 +1,366 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// FTPFetcher is a Fetcher for ftp:// urls. Directories are listed as pages linking to their entries,
+// files are returned as bodies. Every fetch uses its own passive mode connection,
+// logging in anonymously unless the url carries credentials.
+type FTPFetcher struct {
+	// Dialer opens the control and data connections, a zero net.Dialer when nil.
+	Dialer *net.Dialer
+}
+
+// Fetch is the implementation of Fetcher for FTPFetcher.
+func (f *FTPFetcher) Fetch(url string) (body string, urls []string, err error) {
+	return f.FetchContext(context.Background(), url)
+}
+
+// FetchContext is the implementation of ContextFetcher for FTPFetcher.
+func (f *FTPFetcher) FetchContext(ctx context.Context, rawURL string) (body string, urls []string, err error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", nil, err
+	}
+	if u.Scheme != "ftp" {
+		return "", nil, fmt.Errorf("%s: not an ftp url", rawURL)
+	}
+	if err := checkFTPURL(u); err != nil {
+		return "", nil, fmt.Errorf("ftp %s: %w", rawURL, err)
+	}
+	c, err := f.dial(ctx, u)
+	if err != nil {
+		return "", nil, fmt.Errorf("ftp %s: %w", rawURL, err)
+	}
+	defer c.close()
+	name := u.Path
+	if name == "" {
+		name = "/"
+	}
+	// only directories can be changed into
+	if _, _, err := c.cmd(250, "CWD %s", name); err == nil {
+		names, err := c.list()
+		if err != nil {
+			return "", nil, fmt.Errorf("ftp %s: %w", rawURL, err)
+		}
+		body, urls = listingLinks(u, names, nil)
+		return body, urls, nil
+	}
+	data, err := c.retrieve(name)
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) && protoErr.Code == 550 {
+		return "", nil, fmt.Errorf("%w: %s", ErrNotFound, rawURL)
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("ftp %s: %w", rawURL, err)
+	}
+	return string(data), nil, nil
+}
+
+// checkFTPURL fails when the path or the credentials of u, which are sent as they are in the commands of FTP and
+// of sftp batches, have control characters: a decoded %0d%0a would end the command and start another one.
+func checkFTPURL(u *url.URL) error {
+	fields := []string{u.Path}
+	if u.User != nil {
+		password, _ := u.User.Password()
+		fields = append(fields, u.User.Username(), password)
+	}
+	for _, field := range fields {
+		for i := 0; i < len(field); i++ {
+			if field[i] < 0x20 || field[i] == 0x7f {
+				return errors.New("control character in the path or credentials")
+			}
+		}
+	}
+	return nil
+}
+
+// ftpConn is a logged in FTP control connection.
+type ftpConn struct {
+	ctx    context.Context
+	dialer *net.Dialer
+	host   string
+	conn   net.Conn
+	text   *textproto.Conn
+	// done stops the goroutine closing conn once ctx is done
+	done chan struct{}
+}
+
+func (f *FTPFetcher) dial(ctx context.Context, u *url.URL) (*ftpConn, error) {
+	dialer := f.Dialer
+	if dialer == nil {
+		dialer = &net.Dialer{}
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "21")
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &ftpConn{ctx: ctx, dialer: dialer, host: u.Hostname(), conn: conn, text: textproto.NewConn(conn), done: make(chan struct{})}
+	// closing the connection unblocks whatever is waiting on it once ctx is done
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-c.done:
+		}
+	}()
+	if _, _, err := c.text.ReadResponse(220); err != nil {
+		c.close()
+		return nil, err
+	}
+	user, password := "anonymous", "anonymous@"
+	if u.User != nil {
+		user = u.User.Username()
+		password, _ = u.User.Password()
+	}
+	code, _, err := c.cmd(0, "USER %s", user)
+	if err == nil && code == 331 {
+		code, _, err = c.cmd(230, "PASS %s", password)
+	}
+	if err == nil && code != 230 && code != 202 {
+		err = fmt.Errorf("login refused with %d", code)
+	}
+	if err == nil {
+		_, _, err = c.cmd(200, "TYPE I")
+	}
+	if err != nil {
+		c.close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// cmd sends a command and reads its response, failing unless it has the code expected, when not 0.
+func (c *ftpConn) cmd(expected int, format string, args ...interface{}) (int, string, error) {
+	if _, err := c.text.Cmd(format, args...); err != nil {
+		return 0, "", err
+	}
+	return c.text.ReadResponse(expected)
+}
+
+// passive opens a data connection in extended passive mode, falling back to passive mode.
+func (c *ftpConn) passive() (net.Conn, error) {
+	var addr string
+	if _, msg, err := c.cmd(229, "EPSV"); err == nil {
+		// 229 Entering Extended Passive Mode (|||port|)
+		start, end := strings.Index(msg, "(|||"), strings.LastIndex(msg, "|)")
+		if start < 0 || end < start+4 {
+			return nil, fmt.Errorf("malformed EPSV response %q", msg)
+		}
+		addr = net.JoinHostPort(c.host, msg[start+4:end])
+	} else {
+		_, msg, err := c.cmd(227, "PASV")
+		if err != nil {
+			return nil, err
+		}
+		// 227 Entering Passive Mode (h1,h2,h3,h4,p1,p2)
+		start, end := strings.IndexByte(msg, '('), strings.IndexByte(msg, ')')
+		if start < 0 || end < start {
+			return nil, fmt.Errorf("malformed PASV response %q", msg)
+		}
+		fields := strings.Split(msg[start+1:end], ",")
+		if len(fields) != 6 {
+			return nil, fmt.Errorf("malformed PASV response %q", msg)
+		}
+		p1, err1 := strconv.Atoi(fields[4])
+		p2, err2 := strconv.Atoi(fields[5])
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("malformed PASV response %q", msg)
+		}
+		// the advertised host is often a private address, the control connection host is used instead
+		addr = net.JoinHostPort(c.host, strconv.Itoa(p1<<8|p2))
+	}
+	return c.dialer.DialContext(c.ctx, "tcp", addr)
+}
+
+// transfer runs a command transferring data over a passive connection, and returns the data.
+func (c *ftpConn) transfer(format string, args ...interface{}) ([]byte, error) {
+	data, err := c.passive()
+	if err != nil {
+		return nil, err
+	}
+	defer data.Close()
+	code, msg, err := c.cmd(0, format, args...)
+	if err != nil {
+		return nil, err
+	}
+	if code != 125 && code != 150 {
+		return nil, &textproto.Error{Code: code, Msg: msg}
+	}
+	body, err := io.ReadAll(data)
+	if err != nil {
+		return nil, err
+	}
+	data.Close()
+	if _, _, err := c.text.ReadResponse(226); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// list returns the names of the entries of the current directory.
+func (c *ftpConn) list() ([]string, error) {
+	data, err := c.transfer("NLST")
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) && (protoErr.Code == 450 || protoErr.Code == 550) {
+		// some servers refuse to list empty directories
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, line := range strings.Split(string(data), "\n") {
+		name := path.Base(strings.TrimRight(line, "\r"))
+		if name != "" && name != "." && name != ".." && name != "/" {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// retrieve returns the content of the file name.
+func (c *ftpConn) retrieve(name string) ([]byte, error) {
+	return c.transfer("RETR %s", name)
+}
+
+func (c *ftpConn) close() {
+	close(c.done)
+	c.text.Cmd("QUIT")
+	c.text.Close()
+}
+
+// listingLinks returns the body and links of a directory listing of the entries names of the directory u,
+// where isDir tells which entries are directories when known.
+func listingLinks(u *url.URL, names []string, isDir map[string]bool) (body string, urls []string) {
+	dir := *u
+	if !strings.HasSuffix(dir.Path, "/") {
+		dir.Path += "/"
+	}
+	dir.RawPath = ""
+	var listing strings.Builder
+	for _, name := range names {
+		if isDir[name] {
+			name += "/"
+		}
+		listing.WriteString(name)
+		listing.WriteByte('\n')
+		link := dir
+		link.Path = dir.Path + name
+		urls = append(urls, link.String())
+	}
+	return listing.String(), urls
+}
+
+// SFTPFetcher is a Fetcher for sftp:// urls, run through the OpenSSH sftp client in batch mode since
+// the module has no SSH implementation. Authentication must work without a prompt, with keys or an agent.
+// Directories are listed as pages linking to their entries, files are returned as bodies.
+type SFTPFetcher struct {
+	// Command is the sftp binary, "sftp" from PATH when empty.
+	Command string
+	// Args are extra command line flags, such as "-i" and a key file.
+	Args []string
+}
+
+// Fetch is the implementation of Fetcher for SFTPFetcher.
+func (f *SFTPFetcher) Fetch(url string) (body string, urls []string, err error) {
+	return f.FetchContext(context.Background(), url)
+}
+
+// FetchContext is the implementation of ContextFetcher for SFTPFetcher.
+func (f *SFTPFetcher) FetchContext(ctx context.Context, rawURL string) (body string, urls []string, err error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", nil, err
+	}
+	if u.Scheme != "sftp" {
+		return "", nil, fmt.Errorf("%s: not an sftp url", rawURL)
+	}
+	if err := checkFTPURL(u); err != nil {
+		return "", nil, fmt.Errorf("sftp %s: %w", rawURL, err)
+	}
+	// the target is passed after --, a user or host starting with a dash is refused as well since sftp hands it to ssh
+	if strings.HasPrefix(u.Hostname(), "-") || u.User != nil && strings.HasPrefix(u.User.Username(), "-") {
+		return "", nil, fmt.Errorf("sftp %s: user or host starting with a dash", rawURL)
+	}
+	name := u.Path
+	if name == "" {
+		name = "/"
+	}
+	// a batch aborts on the first failing command, so cd fails the listing of files
+	out, err := f.batch(ctx, u, fmt.Sprintf("cd %s\nls -1\n", sftpQuote(name)))
+	if err == nil {
+		var names []string
+		for _, line := range strings.Split(out, "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" && !strings.HasPrefix(line, "sftp>") {
+				names = append(names, path.Base(line))
+			}
+		}
+		body, urls = listingLinks(u, names, nil)
+		return body, urls, nil
+	}
+	if ctx.Err() != nil {
+		return "", nil, ctx.Err()
+	}
+	tmp, err := os.CreateTemp("", "sftp-fetch-*")
+	if err != nil {
+		return "", nil, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	if _, err := f.batch(ctx, u, fmt.Sprintf("get %s %s\n", sftpQuote(name), sftpQuote(tmp.Name()))); err != nil {
+		return "", nil, fmt.Errorf("sftp %s: %w", rawURL, err)
+	}
+	data, err := os.ReadFile(tmp.Name())
+	return string(data), nil, err
+}
+
+// batch runs the sftp batch commands against the host of u and returns the output.
+func (f *SFTPFetcher) batch(ctx context.Context, u *url.URL, commands string) (string, error) {
+	command := f.Command
+	if command == "" {
+		command = "sftp"
+	}
+	args := []string{"-b", "-", "-q", "-o", "BatchMode=yes"}
+	if port := u.Port(); port != "" {
+		args = append(args, "-P", port)
+	}
+	args = append(args, f.Args...)
+	target := u.Hostname()
+	if u.User != nil {
+		target = u.User.Username() + "@" + target
+	}
+	args = append(args, "--", target)
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, command, args...)
+	cmd.Stdin = strings.NewReader(commands)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%w: %s", err, strings.TrimSpace(lastLine(stderr.String())))
+	}
+	return stdout.String(), nil
+}
+
+// sftpQuote quotes a path for an sftp batch command.
+func sftpQuote(name string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(name) + `"`
+}
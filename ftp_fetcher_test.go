@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeFTPServer serves files over FTP in passive mode, the directories being the prefixes of their paths.
+type fakeFTPServer struct {
+	files map[string]string
+
+	listener net.Listener
+	mu       sync.Mutex
+	// commands are the commands received, conns the number of control connections
+	commands []string
+	conns    int
+}
+
+func newFakeFTPServer(t *testing.T, files map[string]string) *fakeFTPServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeFTPServer{files: files, listener: l}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeFTPServer) isDir(name string) bool {
+	for file := range s.files {
+		if strings.HasPrefix(file, strings.TrimSuffix(name, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *fakeFTPServer) serve(conn net.Conn) {
+	defer conn.Close()
+	s.mu.Lock()
+	s.conns++
+	s.mu.Unlock()
+	r := bufio.NewReader(conn)
+	reply := func(format string, args ...interface{}) { fmt.Fprintf(conn, format+"\r\n", args...) }
+	reply("220 ready")
+	dir := "/"
+	var data net.Listener
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		s.mu.Lock()
+		s.commands = append(s.commands, line)
+		s.mu.Unlock()
+		cmd, arg, _ := strings.Cut(line, " ")
+		switch cmd {
+		case "USER":
+			reply("331 password")
+		case "PASS":
+			reply("230 logged in")
+		case "TYPE":
+			reply("200 ok")
+		case "CWD":
+			if !s.isDir(arg) {
+				reply("550 not a directory")
+				continue
+			}
+			dir = arg
+			reply("250 ok")
+		case "EPSV":
+			data, _ = net.Listen("tcp", "127.0.0.1:0")
+			reply("229 Entering Extended Passive Mode (|||%d|)", data.Addr().(*net.TCPAddr).Port)
+		case "NLST", "RETR":
+			var content string
+			if cmd == "NLST" {
+				seen := make(map[string]bool)
+				for file := range s.files {
+					if rest, ok := strings.CutPrefix(file, strings.TrimSuffix(dir, "/")+"/"); ok {
+						name, _, _ := strings.Cut(rest, "/")
+						if !seen[name] {
+							seen[name] = true
+							content += name + "\r\n"
+						}
+					}
+				}
+			} else if file, ok := s.files[arg]; ok {
+				content = file
+			} else {
+				data.Close()
+				reply("550 no such file")
+				continue
+			}
+			reply("150 sending")
+			c, err := data.Accept()
+			data.Close()
+			if err != nil {
+				return
+			}
+			fmt.Fprint(c, content)
+			c.Close()
+			reply("226 done")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func TestFTPFetcher(t *testing.T) {
+	s := newFakeFTPServer(t, map[string]string{"/pub/a.txt": "file a", "/pub/sub/b.txt": "file b"})
+	root := "ftp://" + s.listener.Addr().String()
+	f := &FTPFetcher{}
+
+	body, urls, err := f.Fetch(root + "/pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(body, "a.txt\n") || !strings.Contains(body, "sub\n") {
+		t.Errorf("listing = %q, want a.txt and sub", body)
+	}
+	for _, want := range []URL{root + "/pub/a.txt", root + "/pub/sub"} {
+		found := false
+		for _, link := range urls {
+			found = found || link == want
+		}
+		if !found {
+			t.Errorf("links = %q, want %s", urls, want)
+		}
+	}
+
+	if body, _, err := f.Fetch(root + "/pub/sub/b.txt"); err != nil || body != "file b" {
+		t.Errorf("Fetch(b.txt) = %q, %v, want %q", body, err, "file b")
+	}
+	if _, _, err := f.Fetch(root + "/pub/missing.txt"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Fetch(missing.txt) = %v, want ErrNotFound", err)
+	}
+	s.mu.Lock()
+	logins := s.commands[:2]
+	s.mu.Unlock()
+	if !reflect.DeepEqual(logins, []string{"USER anonymous", "PASS anonymous@"}) {
+		t.Errorf("login = %q, want anonymous", logins)
+	}
+}
+
+func TestFTPFetcherRefusesControlCharacters(t *testing.T) {
+	s := newFakeFTPServer(t, map[string]string{"/a.txt": "file a"})
+	host := s.listener.Addr().String()
+	for _, rawURL := range []string{
+		"ftp://" + host + "/a.txt%0d%0aDELE%20a.txt",
+		"ftp://" + host + "/a%00.txt",
+		"ftp://user%0d%0aDELE%20a.txt:secret@" + host + "/a.txt",
+		"ftp://user:secret%0aDELE%20a.txt@" + host + "/a.txt",
+	} {
+		if _, _, err := (&FTPFetcher{}).Fetch(rawURL); err == nil {
+			t.Errorf("Fetch(%q) succeeded", rawURL)
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conns != 0 {
+		t.Errorf("%d connections to the server, want none", s.conns)
+	}
+}
+
+// fakeSFTP returns an SFTPFetcher running a script in place of sftp, which records its arguments and batch
+// into dir and prints out.
+func fakeSFTP(t *testing.T, out string) (*SFTPFetcher, string) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a shell")
+	}
+	dir := t.TempDir()
+	script := filepath.Join(dir, "sftp")
+	content := fmt.Sprintf("#!/bin/sh\nfor arg in \"$@\"; do echo \"$arg\"; done > %s/args\ncat > %s/batch\nprintf '%%s' '%s'\n",
+		dir, dir, out)
+	if err := os.WriteFile(script, []byte(content), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return &SFTPFetcher{Command: script}, dir
+}
+
+func TestSFTPFetcher(t *testing.T) {
+	f, dir := fakeSFTP(t, "sftp> ls -1\na.txt\nsub\n")
+	body, urls, err := f.Fetch("sftp://user@example.com:2222/pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "a.txt\nsub\n" {
+		t.Errorf("listing = %q", body)
+	}
+	if want := []string{"sftp://user@example.com:2222/pub/a.txt", "sftp://user@example.com:2222/pub/sub"}; !reflect.DeepEqual(urls, want) {
+		t.Errorf("links = %q, want %q", urls, want)
+	}
+	args, _ := os.ReadFile(filepath.Join(dir, "args"))
+	if want := "-b\n-\n-q\n-o\nBatchMode=yes\n-P\n2222\n--\nuser@example.com\n"; string(args) != want {
+		t.Errorf("args = %q, want %q", args, want)
+	}
+	batch, _ := os.ReadFile(filepath.Join(dir, "batch"))
+	if want := "cd \"/pub\"\nls -1\n"; string(batch) != want {
+		t.Errorf("batch = %q, want %q", batch, want)
+	}
+}
+
+func TestSFTPFetcherRefusesInjections(t *testing.T) {
+	f, dir := fakeSFTP(t, "")
+	for _, rawURL := range []string{
+		"sftp://example.com/a%0a!touch%20pwned%0a",
+		"sftp://example.com/a%0dget%20/etc/passwd",
+		"sftp://user%0a@example.com/",
+		"sftp://-oProxyCommand=pwned/",
+		"sftp://-oProxyCommand=touch%20pwned@example.com/",
+	} {
+		if _, err := url.Parse(rawURL); err != nil {
+			t.Fatalf("%s does not parse: %v", rawURL, err)
+		}
+		if _, _, err := f.Fetch(rawURL); err == nil {
+			t.Errorf("Fetch(%q) succeeded", rawURL)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "args")); err == nil {
+		t.Error("sftp was run")
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// linkGraph is the link graph of the crawled pages collected by the graph sinks, the pages being the nodes
+// and their links to other crawled pages the edges. Links to urls that were not crawled are left out.
+type linkGraph struct {
+	nodes []graphNode
+	// index is the index of the node of every url in nodes
+	index map[URL]int
+}
+
+// graphNode is a page of a linkGraph.
+type graphNode struct {
+	URL    URL
+	Depth  int
+	Status int
+	Err    error
+	Size   int64
+	Links  []URL
+}
+
+// add adds the node of page, the first page of an url wins.
+func (g *linkGraph) add(page PageResult) {
+	if _, ok := g.index[page.URL]; ok {
+		return
+	}
+	if g.index == nil {
+		g.index = make(map[URL]int)
+	}
+	g.index[page.URL] = len(g.nodes)
+	g.nodes = append(g.nodes, graphNode{
+		URL:    page.URL,
+		Depth:  page.Depth,
+		Status: page.Meta.StatusCode,
+		Err:    page.Err,
+		Size:   bodySize(page),
+		Links:  page.Links,
+	})
+}
+
+// edges calls edge with the indexes of the nodes of every link between crawled pages, once per pair.
+func (g *linkGraph) edges(edge func(from, to int) error) error {
+	for i, node := range g.nodes {
+		seen := make(map[int]bool, len(node.Links))
+		for _, link := range node.Links {
+			j, ok := g.index[link]
+			if !ok || seen[j] {
+				continue
+			}
+			seen[j] = true
+			if err := edge(i, j); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// status returns the class of the status of the page of node: ok, redirect, client error, server error,
+// or error for the failures without a status code.
+func (n *graphNode) status() string {
+	switch {
+	case n.Status >= 500:
+		return "server error"
+	case n.Status >= 400:
+		return "client error"
+	case n.Status >= 300:
+		return "redirect"
+	case n.Err != nil:
+		return "error"
+	}
+	return "ok"
+}
+
+// dotStatusColors are the fill colors of the nodes of a DOTSink by the class of their status.
+var dotStatusColors = map[string]string{
+	"ok":           "palegreen",
+	"redirect":     "lightblue",
+	"client error": "orange",
+	"server error": "tomato",
+	"error":        "gray",
+}
+
+// DOTSink writes the link graph of the crawl to W in the DOT language of Graphviz when closed, with a node
+// per page, filled by the class of its status, and an edge per link between crawled pages.
+type DOTSink struct {
+	W io.Writer
+	// ColorByDepth fills the nodes by their depth instead, from light to dark blue.
+	ColorByDepth bool
+
+	graph linkGraph
+}
+
+// Write is the implementation of Sink for DOTSink.
+func (s *DOTSink) Write(page PageResult) error {
+	s.graph.add(page)
+	return nil
+}
+
+// Close is the implementation of Sink for DOTSink, it writes the graph.
+func (s *DOTSink) Close() error {
+	w := bufio.NewWriter(s.W)
+	fmt.Fprintln(w, "digraph crawl {")
+	fmt.Fprintln(w, "\tnode [shape=box, style=filled];")
+	for _, node := range s.graph.nodes {
+		color := dotStatusColors[node.status()]
+		if s.ColorByDepth {
+			// the blues9 scheme has 9 shades, the deeper pages share the darkest
+			shade := node.Depth + 1
+			if shade > 9 {
+				shade = 9
+			}
+			color = fmt.Sprintf("/blues9/%d", shade)
+		}
+		tooltip := fmt.Sprintf("%s, depth %d", node.status(), node.Depth)
+		if node.Status != 0 {
+			tooltip = fmt.Sprintf("%d, depth %d", node.Status, node.Depth)
+		}
+		fmt.Fprintf(w, "\t%s [label=%s, fillcolor=%s, tooltip=%s];\n", dotQuote(node.URL),
+			dotQuote(DisplayURL(node.URL)), dotQuote(color), dotQuote(tooltip))
+	}
+	// the errors of w are sticky, Flush reports them
+	s.graph.edges(func(from, to int) error {
+		_, err := fmt.Fprintf(w, "\t%s -> %s;\n", dotQuote(s.graph.nodes[from].URL), dotQuote(s.graph.nodes[to].URL))
+		return err
+	})
+	fmt.Fprintln(w, "}")
+	return w.Flush()
+}
+
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// dotQuote returns s as a quoted DOT string.
+func dotQuote(s string) string {
+	return `"` + dotEscaper.Replace(s) + `"`
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// GraphMLSink writes the link graph of the crawl to W in GraphML when closed, for tools such as NetworkX,
+// with the url, depth, status code, size and error of the pages as node attributes.
+type GraphMLSink struct {
+	W io.Writer
+
+	graph linkGraph
+}
+
+// Write is the implementation of Sink for GraphMLSink.
+func (s *GraphMLSink) Write(page PageResult) error {
+	s.graph.add(page)
+	return nil
+}
+
+// Close is the implementation of Sink for GraphMLSink, it writes the graph.
+func (s *GraphMLSink) Close() error {
+	w := bufio.NewWriter(s.W)
+	w.WriteString(xml.Header)
+	fmt.Fprintln(w, `<graphml xmlns="http://graphml.graphdrawing.org/xmlns">`)
+	fmt.Fprintln(w, `  <key id="url" for="node" attr.name="url" attr.type="string"/>`)
+	fmt.Fprintln(w, `  <key id="depth" for="node" attr.name="depth" attr.type="int"/>`)
+	fmt.Fprintln(w, `  <key id="status" for="node" attr.name="status" attr.type="int"/>`)
+	fmt.Fprintln(w, `  <key id="size" for="node" attr.name="size" attr.type="long"/>`)
+	fmt.Fprintln(w, `  <key id="error" for="node" attr.name="error" attr.type="string"/>`)
+	fmt.Fprintln(w, `  <graph id="crawl" edgedefault="directed">`)
+	for i, node := range s.graph.nodes {
+		fmt.Fprintf(w, `    <node id="n%d"><data key="url">%s</data><data key="depth">%d</data>`, i, xmlEscape(node.URL), node.Depth)
+		if node.Status != 0 {
+			fmt.Fprintf(w, `<data key="status">%d</data>`, node.Status)
+		}
+		fmt.Fprintf(w, `<data key="size">%d</data>`, node.Size)
+		if node.Err != nil {
+			fmt.Fprintf(w, `<data key="error">%s</data>`, xmlEscape(node.Err.Error()))
+		}
+		fmt.Fprintln(w, "</node>")
+	}
+	// the errors of w are sticky, Flush reports them
+	s.graph.edges(func(from, to int) error {
+		_, err := fmt.Fprintf(w, "    <edge source=\"n%d\" target=\"n%d\"/>\n", from, to)
+		return err
+	})
+	fmt.Fprintln(w, "  </graph>")
+	fmt.Fprintln(w, "</graphml>")
+	return w.Flush()
+}
+
+// GEXFSink writes the link graph of the crawl to W in GEXF 1.3 when closed, for Gephi, with the pages labeled
+// by their url and their depth, status code, size and error as node attributes.
+type GEXFSink struct {
+	W io.Writer
+
+	graph linkGraph
+}
+
+// Write is the implementation of Sink for GEXFSink.
+func (s *GEXFSink) Write(page PageResult) error {
+	s.graph.add(page)
+	return nil
+}
+
+// Close is the implementation of Sink for GEXFSink, it writes the graph.
+func (s *GEXFSink) Close() error {
+	w := bufio.NewWriter(s.W)
+	w.WriteString(xml.Header)
+	fmt.Fprintln(w, `<gexf xmlns="http://gexf.net/1.3" version="1.3">`)
+	fmt.Fprintln(w, `  <graph defaultedgetype="directed">`)
+	fmt.Fprintln(w, `    <attributes class="node">`)
+	fmt.Fprintln(w, `      <attribute id="depth" title="depth" type="integer"/>`)
+	fmt.Fprintln(w, `      <attribute id="status" title="status" type="integer"/>`)
+	fmt.Fprintln(w, `      <attribute id="size" title="size" type="long"/>`)
+	fmt.Fprintln(w, `      <attribute id="error" title="error" type="string"/>`)
+	fmt.Fprintln(w, `    </attributes>`)
+	fmt.Fprintln(w, `    <nodes>`)
+	for i, node := range s.graph.nodes {
+		fmt.Fprintf(w, `      <node id="%d" label="%s"><attvalues><attvalue for="depth" value="%d"/>`, i, xmlEscape(DisplayURL(node.URL)), node.Depth)
+		if node.Status != 0 {
+			fmt.Fprintf(w, `<attvalue for="status" value="%d"/>`, node.Status)
+		}
+		fmt.Fprintf(w, `<attvalue for="size" value="%d"/>`, node.Size)
+		if node.Err != nil {
+			fmt.Fprintf(w, `<attvalue for="error" value="%s"/>`, xmlEscape(node.Err.Error()))
+		}
+		fmt.Fprintln(w, "</attvalues></node>")
+	}
+	fmt.Fprintln(w, `    </nodes>`)
+	fmt.Fprintln(w, `    <edges>`)
+	edge := 0
+	// the errors of w are sticky, Flush reports them
+	s.graph.edges(func(from, to int) error {
+		_, err := fmt.Fprintf(w, "      <edge id=\"%d\" source=\"%d\" target=\"%d\"/>\n", edge, from, to)
+		edge++
+		return err
+	})
+	fmt.Fprintln(w, `    </edges>`)
+	fmt.Fprintln(w, "  </graph>")
+	fmt.Fprintln(w, "</gexf>")
+	return w.Flush()
+}
+
+// xmlEscape returns s escaped for XML text and attribute values.
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bufio"
+	"html"
+	"io"
+	"strings"
+)
+
+// The module has no dependencies, so instead of golang.org/x/net/html pages are read with a small tokenizer
+// that only understands as much HTML as link extraction needs: tags, attributes, comments and raw text elements.
+
+type htmlTokenKind int
+
+const (
+	startTagToken htmlTokenKind = iota
+	endTagToken
+	textToken
+)
+
+// htmlToken is a tag or a run of text read by htmlTokenizer.
+type htmlToken struct {
+	kind htmlTokenKind
+	// name is the lower case tag name of start and end tags.
+	name string
+	// attrs are the attributes of start tags, with lower case names and unescaped values.
+	attrs []htmlAttr
+	// text is the unescaped text of text tokens.
+	text string
+}
+
+type htmlAttr struct {
+	name, value string
+}
+
+// attr returns the value of the attribute name, reporting whether it is set.
+func (t *htmlToken) attr(name string) (string, bool) {
+	for _, a := range t.attrs {
+		if a.name == name {
+			return a.value, true
+		}
+	}
+	return "", false
+}
+
+// rawTextElements hold text that is not parsed for tags until their end tag.
+var rawTextElements = map[string]bool{
+	"script":   true,
+	"style":    true,
+	"textarea": true,
+	"title":    true,
+}
+
+// htmlTokenizer reads htmlTokens from a stream.
+type htmlTokenizer struct {
+	r *bufio.Reader
+	// rawText is the element whose raw text comes next, if any
+	rawText string
+	// pending is a token read ahead of time, returned by the next call to next
+	pending *htmlToken
+}
+
+func newHTMLTokenizer(r io.Reader) *htmlTokenizer {
+	return &htmlTokenizer{r: bufio.NewReader(r)}
+}
+
+// next returns the next token, or io.EOF at the end of the document.
+func (z *htmlTokenizer) next() (htmlToken, error) {
+	if z.pending != nil {
+		t := *z.pending
+		z.pending = nil
+		return t, nil
+	}
+	if z.rawText != "" {
+		name := z.rawText
+		z.rawText = ""
+		text, err := z.readRawText(name)
+		end := htmlToken{kind: endTagToken, name: name}
+		if err == nil && text != "" {
+			z.pending = &end
+		}
+		if text != "" {
+			return htmlToken{kind: textToken, text: html.UnescapeString(text)}, nil
+		}
+		if err != nil {
+			return htmlToken{}, err
+		}
+		return end, nil
+	}
+	for {
+		text, err := z.r.ReadString('<')
+		if len(text) > 1 || (len(text) == 1 && err != nil) {
+			if err == nil {
+				z.r.UnreadByte()
+				text = text[:len(text)-1]
+			}
+			return htmlToken{kind: textToken, text: html.UnescapeString(text)}, nil
+		}
+		if err != nil {
+			return htmlToken{}, err
+		}
+		c, err := z.r.ReadByte()
+		if err != nil {
+			return htmlToken{}, err
+		}
+		switch {
+		case c == '!':
+			if err := z.skipMarkup(); err != nil {
+				return htmlToken{}, err
+			}
+		case c == '/':
+			name, err := z.readName()
+			if err != nil {
+				return htmlToken{}, err
+			}
+			if _, err := z.r.ReadString('>'); err != nil {
+				return htmlToken{}, err
+			}
+			if name != "" {
+				return htmlToken{kind: endTagToken, name: name}, nil
+			}
+		case isASCIILetter(c):
+			z.r.UnreadByte()
+			return z.readStartTag()
+		case c == '?':
+			if _, err := z.r.ReadString('>'); err != nil {
+				return htmlToken{}, err
+			}
+		default:
+			// a lone '<' is just text
+			z.r.UnreadByte()
+			return htmlToken{kind: textToken, text: "<"}, nil
+		}
+	}
+}
+
+// skipMarkup skips a comment, doctype or CDATA section, after its "<!".
+func (z *htmlTokenizer) skipMarkup() error {
+	peek, _ := z.r.Peek(2)
+	if string(peek) != "--" {
+		_, err := z.r.ReadString('>')
+		return err
+	}
+	z.r.Discard(2)
+	// a comment ends with the first "-->"
+	dashes := 0
+	for {
+		c, err := z.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		switch {
+		case c == '-':
+			dashes++
+		case c == '>' && dashes >= 2:
+			return nil
+		default:
+			dashes = 0
+		}
+	}
+}
+
+// readStartTag reads a start tag after its '<'.
+func (z *htmlTokenizer) readStartTag() (htmlToken, error) {
+	name, err := z.readName()
+	if err != nil {
+		return htmlToken{}, err
+	}
+	t := htmlToken{kind: startTagToken, name: name}
+	for {
+		z.skipSpace()
+		c, err := z.r.ReadByte()
+		if err != nil {
+			return htmlToken{}, err
+		}
+		if c == '>' {
+			break
+		}
+		if c == '/' {
+			continue
+		}
+		z.r.UnreadByte()
+		attr, err := z.readAttr()
+		if err != nil {
+			return htmlToken{}, err
+		}
+		if attr.name != "" {
+			t.attrs = append(t.attrs, attr)
+		}
+	}
+	if rawTextElements[name] {
+		z.rawText = name
+	}
+	return t, nil
+}
+
+// readAttr reads a single attribute of a start tag.
+func (z *htmlTokenizer) readAttr() (htmlAttr, error) {
+	var name strings.Builder
+	for {
+		c, err := z.r.ReadByte()
+		if err != nil {
+			return htmlAttr{}, err
+		}
+		if isHTMLSpace(c) || c == '=' || c == '>' || c == '/' {
+			z.r.UnreadByte()
+			break
+		}
+		name.WriteByte(toLowerASCII(c))
+	}
+	if name.Len() == 0 {
+		// skip the stray byte, so the tag can go on
+		_, err := z.r.ReadByte()
+		return htmlAttr{}, err
+	}
+	attr := htmlAttr{name: name.String()}
+	z.skipSpace()
+	if c, err := z.r.ReadByte(); err != nil || c != '=' {
+		if err == nil {
+			z.r.UnreadByte()
+		}
+		return attr, err
+	}
+	z.skipSpace()
+	c, err := z.r.ReadByte()
+	if err != nil {
+		return htmlAttr{}, err
+	}
+	var value string
+	if c == '"' || c == '\'' {
+		value, err = z.r.ReadString(c)
+		if err != nil {
+			return htmlAttr{}, err
+		}
+		value = value[:len(value)-1]
+	} else {
+		var b strings.Builder
+		for ; !isHTMLSpace(c) && c != '>'; c, err = z.r.ReadByte() {
+			if err != nil {
+				return htmlAttr{}, err
+			}
+			b.WriteByte(c)
+		}
+		z.r.UnreadByte()
+		value = b.String()
+	}
+	attr.value = html.UnescapeString(value)
+	return attr, nil
+}
+
+// readName reads a lower cased tag name.
+func (z *htmlTokenizer) readName() (string, error) {
+	var b strings.Builder
+	for {
+		c, err := z.r.ReadByte()
+		if err == io.EOF && b.Len() > 0 {
+			return b.String(), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if isHTMLSpace(c) || c == '>' || c == '/' {
+			z.r.UnreadByte()
+			return b.String(), nil
+		}
+		b.WriteByte(toLowerASCII(c))
+	}
+}
+
+// readRawText reads the text of a raw text element up to, and including, its end tag.
+func (z *htmlTokenizer) readRawText(name string) (string, error) {
+	var b strings.Builder
+	end := "</" + name
+	for {
+		// the end tag holds no '>' before its own, so it is always within a single chunk
+		chunk, err := z.r.ReadString('>')
+		if i := strings.LastIndex(strings.ToLower(chunk), end); i >= 0 && err == nil {
+			b.WriteString(chunk[:i])
+			return b.String(), nil
+		}
+		b.WriteString(chunk)
+		if err != nil {
+			return b.String(), err
+		}
+	}
+}
+
+func (z *htmlTokenizer) skipSpace() {
+	for {
+		c, err := z.r.ReadByte()
+		if err != nil {
+			return
+		}
+		if !isHTMLSpace(c) {
+			z.r.UnreadByte()
+			return
+		}
+	}
+}
+
+func isHTMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func isASCIILetter(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func toLowerASCII(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+// htmlText returns the text of the HTML document body as it reads, without its tags, comments, scripts, styles
+// and title, with its spaces collapsed.
+func htmlText(body string) string {
+	var words []string
+	// skip is set in the raw text elements that are not read, such as scripts
+	skip := false
+	z := newHTMLTokenizer(strings.NewReader(body))
+	for {
+		t, err := z.next()
+		if err != nil {
+			return strings.Join(words, " ")
+		}
+		switch t.kind {
+		case startTagToken:
+			skip = rawTextElements[t.name] && t.name != "textarea"
+		case endTagToken:
+			skip = false
+		case textToken:
+			if !skip {
+				words = append(words, strings.Fields(t.text)...)
+			}
+		}
+	}
+}
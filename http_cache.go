@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// httpExpiry returns when a response with header goes stale as declared by its Cache-Control and Expires headers,
+// with Cache-Control max-age taking precedence over Expires. It reports false for cache when the response must not
+// be stored, and false for ok when header declares nothing.
+// A response with no-cache, or an invalid Expires, is stale right away, so it is revalidated on its next fetch.
+func httpExpiry(header http.Header, now time.Time) (expires time.Time, cache bool, ok bool) {
+	if header == nil {
+		return time.Time{}, true, false
+	}
+	maxAge := -1
+	for _, directive := range strings.Split(strings.Join(header.Values("Cache-Control"), ","), ",") {
+		name, value := directive, ""
+		if i := strings.IndexByte(directive, '='); i >= 0 {
+			name, value = directive[:i], strings.Trim(strings.TrimSpace(directive[i+1:]), `"`)
+		}
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "no-store":
+			return time.Time{}, false, true
+		case "no-cache":
+			return now, true, true
+		case "max-age":
+			if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+				maxAge = seconds
+			}
+		}
+	}
+	// the age of the response when it was received, as counted by the caches in between
+	age := time.Duration(0)
+	if seconds, err := strconv.Atoi(header.Get("Age")); err == nil && seconds > 0 {
+		age = time.Duration(seconds) * time.Second
+	}
+	if maxAge >= 0 {
+		return now.Add(time.Duration(maxAge)*time.Second - age), true, true
+	}
+	if value := header.Get("Expires"); value != "" {
+		at, err := http.ParseTime(value)
+		if err != nil {
+			return now, true, true
+		}
+		// Expires is relative to the clock of the server, as is Date
+		if date, err := http.ParseTime(header.Get("Date")); err == nil {
+			return now.Add(at.Sub(date) - age), true, true
+		}
+		return at, true, true
+	}
+	return time.Time{}, true, false
+}
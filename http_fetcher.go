@@ -0,0 +1,455 @@
+package main
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultUserAgent identifies the crawler in the requests of HTTPFetcher, with a url telling site owners what it is.
+// Its product token, "crawler", is the one robots.txt groups are matched against.
+const DefaultUserAgent = "crawler/1.0 (+https://github.com/aviadsTraiana/exercise-web-crawler-golang)"
+
+const (
+	// SkipTooLarge is the Stats.Skipped reason of pages larger than the MaxBodySize of HTTPFetcher.
+	SkipTooLarge = "too large"
+	// SkipContentType is the Stats.Skipped reason of pages whose type is not in the ContentTypes of HTTPFetcher.
+	SkipContentType = "content type"
+)
+
+// ErrNotModified is returned by fetchers when the page still matches the Validators of the fetch context.
+var ErrNotModified = errors.New("not modified")
+
+// HTTPError is returned by HTTPFetcher for responses with a non 2xx status code.
+type HTTPError struct {
+	URL        URL
+	StatusCode int
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("%s: %d %s", e.URL, e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// Is makes 404 and 410 responses match ErrNotFound.
+func (e *HTTPError) Is(target error) bool {
+	return target == ErrNotFound && (e.StatusCode == http.StatusNotFound || e.StatusCode == http.StatusGone)
+}
+
+// HTTPFetcher is a Fetcher downloading pages with net/http.
+// Links are extracted from HTML pages only, and resolved against the url of the page after redirects.
+// Bodies are asked for compressed with gzip or deflate. Brotli is not supported, the standard library has
+// no decoder for it, so the fetches of servers sending br bodies regardless fail.
+type HTTPFetcher struct {
+	// Client sends the requests, http.DefaultClient when nil.
+	Client *http.Client
+	// UserAgent is sent with every request, DefaultUserAgent when empty.
+	UserAgent string
+	// UserAgents, when not empty, are sent in turn instead of UserAgent.
+	// Robots still matches its own UserAgent, which should name the crawler.
+	UserAgents []string
+	// MaxBodySize, when above 0, skips the pages with larger bodies, as announced by Content-Length and as decoded.
+	MaxBodySize int64
+	// ContentTypes, when not empty, skips the pages of other media types, such as "text/html" or "text/*".
+	ContentTypes []string
+	// HeadFirst sends a HEAD request before the GET one, so skipped pages are not even started.
+	HeadFirst bool
+	// Credentials authenticate the requests to hosts, by hostname or host:port.
+	// A client without a cookie jar is given one when a Credential logs in.
+	Credentials map[string]*Credential
+	// Proxies, when set, are the proxies the requests go through.
+	// The Transport of Client must then be an *http.Transport, or nil.
+	Proxies *ProxyPool
+	// TransportConfig, when set, tunes the connections of the requests.
+	// Like Proxies, it needs the Transport of Client to be an *http.Transport, or nil.
+	TransportConfig *TransportConfig
+
+	once sync.Once
+	// built is the client sending the requests, derived from Client
+	built *http.Client
+	// rotated counts the requests that took a user agent from UserAgents
+	rotated uint32
+}
+
+// TransportConfig tunes the connections of an HTTPFetcher, its zero fields keep the settings of the transport.
+// The transport of http.DefaultClient keeps only 2 idle connections per host, which makes concurrent fetches
+// from a host open new connections all the time.
+type TransportConfig struct {
+	// MaxIdleConns is the number of idle connections kept open, across all hosts.
+	MaxIdleConns int
+	// MaxIdleConnsPerHost is the number of idle connections kept open to every host.
+	MaxIdleConnsPerHost int
+	// MaxConnsPerHost limits the connections to every host, including the ones in use.
+	MaxConnsPerHost int
+	// IdleConnTimeout is how long idle connections are kept open.
+	IdleConnTimeout time.Duration
+	// DisableKeepAlives opens a new connection for every request.
+	DisableKeepAlives bool
+	// DisableHTTP2 sticks to HTTP/1.1, which is negotiated with HTTPS servers otherwise.
+	DisableHTTP2 bool
+	// Resolver, when set, looks up the hosts connected to instead of net.DefaultResolver.
+	Resolver *net.Resolver
+	// DNSCache, when set, looks up the hosts connected to and keeps their addresses, it overrides Resolver.
+	DNSCache *DNSCache
+}
+
+func (c *TransportConfig) apply(t *http.Transport) {
+	if c.MaxIdleConns > 0 {
+		t.MaxIdleConns = c.MaxIdleConns
+	}
+	if c.MaxIdleConnsPerHost > 0 {
+		t.MaxIdleConnsPerHost = c.MaxIdleConnsPerHost
+	}
+	if c.MaxConnsPerHost > 0 {
+		t.MaxConnsPerHost = c.MaxConnsPerHost
+	}
+	if c.IdleConnTimeout > 0 {
+		t.IdleConnTimeout = c.IdleConnTimeout
+	}
+	if c.DisableKeepAlives {
+		t.DisableKeepAlives = true
+	}
+	if c.DNSCache != nil {
+		t.DialContext = c.DNSCache.DialContext
+	} else if c.Resolver != nil {
+		t.DialContext = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Resolver: c.Resolver}).DialContext
+	}
+	if c.DisableHTTP2 {
+		t.ForceAttemptHTTP2 = false
+		t.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+		if t.TLSClientConfig != nil {
+			t.TLSClientConfig = t.TLSClientConfig.Clone()
+			var protos []string
+			for _, proto := range t.TLSClientConfig.NextProtos {
+				if proto != "h2" {
+					protos = append(protos, proto)
+				}
+			}
+			t.TLSClientConfig.NextProtos = protos
+		}
+	}
+}
+
+// Fetch is the implementation of Fetcher for HTTPFetcher.
+func (f *HTTPFetcher) Fetch(url string) (body string, urls []string, err error) {
+	return f.FetchContext(context.Background(), url)
+}
+
+// FetchContext is the implementation of ContextFetcher for HTTPFetcher.
+func (f *HTTPFetcher) FetchContext(ctx context.Context, url string) (body string, urls []string, err error) {
+	stream, err := f.FetchStream(ctx, url)
+	if err != nil {
+		return "", nil, err
+	}
+	defer stream.Close()
+	data, err := io.ReadAll(stream)
+	if err != nil {
+		return "", nil, err
+	}
+	body = string(data)
+	if !stream.HTML {
+		return body, nil, nil
+	}
+	urls, err = extractLinks(ctx, strings.NewReader(body), stream.URL)
+	return body, urls, err
+}
+
+// FetchStream is the implementation of StreamFetcher for HTTPFetcher.
+// Reading a body beyond MaxBodySize fails with a SkippedResult, and the size of the body is recorded once it is closed.
+// With WithHeadOnly, a HEAD request is sent instead and the body is empty.
+func (f *HTTPFetcher) FetchStream(ctx context.Context, url string) (*Stream, error) {
+	if HeadOnlyFromContext(ctx) {
+		return f.head(ctx, url)
+	}
+	if f.HeadFirst && (f.MaxBodySize > 0 || len(f.ContentTypes) > 0) {
+		// servers failing a HEAD request may still answer the GET one
+		if resp, err := f.do(ctx, http.MethodHead, url); err == nil {
+			resp.Body.Close()
+			if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+				if err := f.gate(url, resp); err != nil {
+					return nil, err
+				}
+			}
+		} else if ctx.Err() != nil {
+			return nil, err
+		}
+	}
+	start := time.Now()
+	resp, err := f.do(ctx, http.MethodGet, url)
+	if err != nil {
+		return nil, err
+	}
+	// the meta of failed responses is recorded too, for the reports of broken links
+	meta := metaFromContext(ctx)
+	meta.StatusCode = resp.StatusCode
+	meta.Header = resp.Header
+	meta.Redirects = redirectsOf(resp)
+	meta.Latency = time.Since(start)
+	if resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %w", url, ErrNotModified)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		// a short body is drained for the connection to be reused, a longer one is abandoned
+		drain := f.MaxBodySize
+		if drain <= 0 {
+			drain = maxErrorDrain
+		}
+		io.Copy(io.Discard, io.LimitReader(resp.Body, drain))
+		resp.Body.Close()
+		return nil, &HTTPError{URL: url, StatusCode: resp.StatusCode}
+	}
+	if err := f.gate(url, resp); err != nil {
+		// closing the body without reading it aborts the download
+		resp.Body.Close()
+		return nil, err
+	}
+	encoded := &countingReader{r: resp.Body}
+	decoded, err := decodeBody(encoded, resp.Header.Get("Content-Encoding"))
+	if err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %w", url, err)
+	}
+	if f.MaxBodySize > 0 {
+		decoded = &maxBodyReader{r: decoded, url: url, left: f.MaxBodySize}
+	}
+	meta.ContentEncoding = resp.Header.Get("Content-Encoding")
+	meta.ETag = resp.Header.Get("ETag")
+	meta.LastModified = resp.Header.Get("Last-Modified")
+	body := &streamBody{Reader: decoded, close: func() error {
+		meta.EncodedSize = encoded.n
+		return resp.Body.Close()
+	}}
+	return &Stream{ReadCloser: body, URL: resp.Request.URL.String(), HTML: isHTML(resp.Header.Get("Content-Type"))}, nil
+}
+
+// head checks url with a HEAD request, failing like FetchStream for responses with a non 2xx status code.
+func (f *HTTPFetcher) head(ctx context.Context, url string) (*Stream, error) {
+	start := time.Now()
+	resp, err := f.do(ctx, http.MethodHead, url)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	meta := metaFromContext(ctx)
+	meta.StatusCode = resp.StatusCode
+	meta.Header = resp.Header
+	meta.Redirects = redirectsOf(resp)
+	meta.Latency = time.Since(start)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &HTTPError{URL: url, StatusCode: resp.StatusCode}
+	}
+	return &Stream{ReadCloser: io.NopCloser(strings.NewReader("")), URL: resp.Request.URL.String()}, nil
+}
+
+// do sends a request for url with the headers, proxy and credentials of f.
+func (f *HTTPFetcher) do(ctx context.Context, method, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", f.userAgent())
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,*/*;q=0.8")
+	// asking for an encoding explicitly turns off the transparent gzip of http.Transport, so the sizes can be recorded
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+	if v, ok := ValidatorsFromContext(ctx); ok {
+		if v.ETag != "" {
+			req.Header.Set("If-None-Match", v.ETag)
+		}
+		if v.LastModified != "" {
+			req.Header.Set("If-Modified-Since", v.LastModified)
+		}
+	}
+	if err := f.authenticate(req); err != nil {
+		return nil, err
+	}
+	return f.HTTPClient().Do(req)
+}
+
+// gate fails with a SkippedResult when the headers of resp show a body that is too large or of a type not in ContentTypes.
+func (f *HTTPFetcher) gate(url string, resp *http.Response) error {
+	if f.MaxBodySize > 0 && resp.ContentLength > f.MaxBodySize {
+		return &SkippedResult{URL: url, Reason: SkipTooLarge}
+	}
+	if len(f.ContentTypes) > 0 && !matchesContentType(resp.Header.Get("Content-Type"), f.ContentTypes) {
+		return &SkippedResult{URL: url, Reason: SkipContentType}
+	}
+	return nil
+}
+
+// redirectsOf returns the urls resp was redirected from, starting with the requested one, or nil without redirects.
+func redirectsOf(resp *http.Response) []URL {
+	var redirects []URL
+	for req := resp.Request; req.Response != nil; req = req.Response.Request {
+		redirects = append([]URL{req.Response.Request.URL.String()}, redirects...)
+	}
+	return redirects
+}
+
+// HTTPClient returns the client the requests of f are sent with: Client with the Proxies, TransportConfig and cookie jar
+// of f. Robots and Sitemaps can share it, so their requests go through the same proxies and connections.
+func (f *HTTPFetcher) HTTPClient() *http.Client {
+	f.once.Do(func() {
+		f.built = f.buildClient()
+	})
+	return f.built
+}
+
+// buildClient derives the client sending the requests from Client, with the Proxies and TransportConfig of f.
+func (f *HTTPFetcher) buildClient() *http.Client {
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	derived := *client
+	if client.Jar == nil && f.needsCookies() {
+		// a cookie jar without a public suffix list only shares cookies between a host and its subdomains
+		derived.Jar, _ = cookiejar.New(nil)
+	}
+	if f.Proxies == nil && f.TransportConfig == nil {
+		return &derived
+	}
+	transport, ok := client.Transport.(*http.Transport)
+	if client.Transport == nil {
+		transport, ok = http.DefaultTransport.(*http.Transport)
+	}
+	if !ok {
+		return &derived
+	}
+	transport = transport.Clone()
+	if f.TransportConfig != nil {
+		f.TransportConfig.apply(transport)
+	}
+	derived.Transport = transport
+	if f.Proxies != nil {
+		transport.Proxy = proxyFromContext
+		transport.OnProxyConnectResponse = checkProxyConnect
+		derived.Transport = &proxyTransport{pool: f.Proxies, next: transport}
+	}
+	return &derived
+}
+
+func (f *HTTPFetcher) userAgent() string {
+	if n := uint32(len(f.UserAgents)); n > 0 {
+		return f.UserAgents[(atomic.AddUint32(&f.rotated, 1)-1)%n]
+	}
+	if f.UserAgent != "" {
+		return f.UserAgent
+	}
+	return DefaultUserAgent
+}
+
+// maxErrorDrain is the most of the body of an error response that is read, when HTTPFetcher has no MaxBodySize.
+const maxErrorDrain = 64 << 10
+
+// acceptEncoding are the content encodings decodeBody understands.
+// Brotli is not among them, the standard library has no decoder for it.
+const acceptEncoding = "gzip, deflate"
+
+// decodeBody returns r decoded from contentEncoding.
+func decodeBody(r io.Reader, contentEncoding string) (io.Reader, error) {
+	switch strings.ToLower(strings.TrimSpace(contentEncoding)) {
+	case "", "identity":
+		return r, nil
+	case "gzip", "x-gzip":
+		return gzip.NewReader(r)
+	case "deflate":
+		// deflate is meant to be zlib wrapped, but some servers send raw deflate streams
+		br := bufio.NewReader(r)
+		header, _ := br.Peek(2)
+		if len(header) == 2 && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+			return zlib.NewReader(br)
+		}
+		return flate.NewReader(br), nil
+	}
+	return nil, fmt.Errorf("unsupported content encoding %q", contentEncoding)
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// matchesContentType reports whether contentType is one of the media types, which can end with a "/*" wildcard.
+// A missing content type matches, like it is taken for HTML.
+func matchesContentType(contentType string, mediaTypes []string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range mediaTypes {
+		if t == mediaType || strings.HasSuffix(t, "/*") && strings.HasPrefix(mediaType, t[:len(t)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// streamBody is the body of a Stream of HTTPFetcher, closing it runs close.
+type streamBody struct {
+	io.Reader
+	close func() error
+}
+
+func (b *streamBody) Close() error {
+	return b.close()
+}
+
+// maxBodyReader fails with a SkippedResult once more than left bytes are read from r.
+type maxBodyReader struct {
+	r    io.Reader
+	url  URL
+	left int64
+}
+
+func (m *maxBodyReader) Read(p []byte) (int, error) {
+	if m.left < 0 {
+		return 0, &SkippedResult{URL: m.url, Reason: SkipTooLarge}
+	}
+	// reading one byte more than left tells a body of exactly left bytes from a larger one
+	if int64(len(p)) > m.left+1 {
+		p = p[:m.left+1]
+	}
+	n, err := m.r.Read(p)
+	if int64(n) > m.left {
+		m.left = -1
+		return n - 1, &SkippedResult{URL: m.url, Reason: SkipTooLarge}
+	}
+	m.left -= int64(n)
+	return n, err
+}
+
+// isHTML reports whether contentType is an HTML media type, servers sending none are assumed to send HTML.
+func isHTML(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHTTPFetcherLimitsErrorBodies(t *testing.T) {
+	var written atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		chunk := strings.Repeat("x", 4<<10)
+		// the body never ends, until the client goes away
+		for written.Load() < 1<<30 {
+			n, err := w.Write([]byte(chunk))
+			written.Add(int64(n))
+			if err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+	tests := []struct {
+		name        string
+		maxBodySize int64
+	}{
+		{"max body size", 16 << 10},
+		{"default", 0},
+	}
+	for _, test := range tests {
+		written.Store(0)
+		f := &HTTPFetcher{MaxBodySize: test.maxBodySize}
+		_, _, err := f.Fetch(server.URL)
+		var httpErr *HTTPError
+		if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusInternalServerError {
+			t.Errorf("%s: err = %v, want an HTTPError 500", test.name, err)
+		}
+		// the server may get ahead of the client by the buffers of the connection
+		if n := written.Load(); n >= 1<<30 {
+			t.Errorf("%s: the whole body was read", test.name)
+		}
+	}
+}
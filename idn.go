@@ -0,0 +1,242 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"unicode/utf8"
+)
+
+// Internationalized domain names are crawled in their ASCII form, with their labels encoded in punycode
+// (RFC 3492), so a host spelled both ways is one host for the visited urls, robots.txt and the per host limits.
+// Labels are lowercased, but not mapped further as IDNA does.
+
+// asciiPrefix starts the ASCII form of the labels with non-ASCII characters.
+const asciiPrefix = "xn--"
+
+// labelSeparators are the characters separating the labels of a host, the ideographic full stops included.
+var labelSeparators = strings.NewReplacer("。", ".", "．", ".", "｡", ".")
+
+// ToASCIIHost returns the ASCII form of host, lowercased, with its port if it has one.
+// Hosts that are already ASCII are only lowercased.
+func ToASCIIHost(host string) string {
+	if isASCII(host) {
+		return strings.ToLower(host)
+	}
+	name, port := splitHostPort(host)
+	labels := strings.Split(labelSeparators.Replace(strings.ToLower(name)), ".")
+	for i, label := range labels {
+		if !isASCII(label) {
+			labels[i] = asciiPrefix + punycodeEncode(label)
+		}
+	}
+	return strings.Join(labels, ".") + port
+}
+
+// ToUnicodeHost returns the Unicode form of host, for display, decoding its punycode labels.
+// Labels that do not decode are left as they are.
+func ToUnicodeHost(host string) string {
+	if !strings.Contains(strings.ToLower(host), asciiPrefix) {
+		return host
+	}
+	name, port := splitHostPort(host)
+	labels := strings.Split(name, ".")
+	for i, label := range labels {
+		if len(label) > len(asciiPrefix) && strings.EqualFold(label[:len(asciiPrefix)], asciiPrefix) {
+			if decoded, err := punycodeDecode(strings.ToLower(label[len(asciiPrefix):])); err == nil {
+				labels[i] = decoded
+			}
+		}
+	}
+	return strings.Join(labels, ".") + port
+}
+
+// DisplayURL returns rawURL with its host in its Unicode form, for reports.
+func DisplayURL(rawURL URL) string {
+	i := strings.Index(rawURL, "://")
+	if i < 0 || !strings.Contains(strings.ToLower(rawURL), asciiPrefix) {
+		return rawURL
+	}
+	rest := rawURL[i+len("://"):]
+	end := strings.IndexAny(rest, "/?#")
+	if end < 0 {
+		end = len(rest)
+	}
+	// the user info is kept as it is
+	at := strings.LastIndexByte(rest[:end], '@') + 1
+	return rawURL[:i+len("://")] + rest[:at] + ToUnicodeHost(rest[at:end]) + rest[end:]
+}
+
+// splitHostPort splits host into its name and its port, with its colon.
+func splitHostPort(host string) (name, port string) {
+	if strings.HasPrefix(host, "[") {
+		return host, ""
+	}
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		return h, ":" + p
+	}
+	return host, ""
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// Parameters of punycode, RFC 3492 section 5.
+const (
+	punyBase        = 36
+	punyTMin        = 1
+	punyTMax        = 26
+	punySkew        = 38
+	punyDamp        = 700
+	punyInitialBias = 72
+	punyInitialN    = 128
+)
+
+var errPunycode = errors.New("invalid punycode")
+
+// punycodeEncode returns the punycode of label, without the xn-- prefix.
+func punycodeEncode(label string) string {
+	input := []rune(label)
+	var out strings.Builder
+	for _, r := range input {
+		if r < utf8.RuneSelf {
+			out.WriteRune(r)
+		}
+	}
+	basic := out.Len()
+	if basic > 0 {
+		out.WriteByte('-')
+	}
+	n, delta, bias := rune(punyInitialN), 0, punyInitialBias
+	for h := basic; h < len(input); {
+		// m is the smallest code point not encoded yet
+		m := rune(utf8.MaxRune)
+		for _, r := range input {
+			if r >= n && r < m {
+				m = r
+			}
+		}
+		delta += int(m-n) * (h + 1)
+		n = m
+		for _, r := range input {
+			if r < n {
+				delta++
+			}
+			if r != n {
+				continue
+			}
+			q := delta
+			for k := punyBase; ; k += punyBase {
+				t := punyThreshold(k, bias)
+				if q < t {
+					break
+				}
+				out.WriteByte(punyDigit(t + (q-t)%(punyBase-t)))
+				q = (q - t) / (punyBase - t)
+			}
+			out.WriteByte(punyDigit(q))
+			bias = punyAdapt(delta, h+1, h == basic)
+			delta = 0
+			h++
+		}
+		delta++
+		n++
+	}
+	return out.String()
+}
+
+// punycodeDecode returns the label encoded as s, without the xn-- prefix.
+func punycodeDecode(s string) (string, error) {
+	var output []rune
+	pos := 0
+	if i := strings.LastIndexByte(s, '-'); i >= 0 {
+		for _, r := range s[:i] {
+			if r >= utf8.RuneSelf {
+				return "", errPunycode
+			}
+			output = append(output, r)
+		}
+		pos = i + 1
+	}
+	n, i, bias := rune(punyInitialN), 0, punyInitialBias
+	for pos < len(s) {
+		oldi, w := i, 1
+		for k := punyBase; ; k += punyBase {
+			if pos >= len(s) {
+				return "", errPunycode
+			}
+			digit, ok := punyValue(s[pos])
+			pos++
+			if !ok || digit > (1<<30-i)/w {
+				return "", errPunycode
+			}
+			i += digit * w
+			t := punyThreshold(k, bias)
+			if digit < t {
+				break
+			}
+			w *= punyBase - t
+		}
+		bias = punyAdapt(i-oldi, len(output)+1, oldi == 0)
+		n += rune(i / (len(output) + 1))
+		i %= len(output) + 1
+		if n > utf8.MaxRune || n < punyInitialN {
+			return "", errPunycode
+		}
+		output = append(output, 0)
+		copy(output[i+1:], output[i:])
+		output[i] = n
+		i++
+	}
+	return string(output), nil
+}
+
+func punyThreshold(k, bias int) int {
+	switch {
+	case k <= bias:
+		return punyTMin
+	case k >= bias+punyTMax:
+		return punyTMax
+	}
+	return k - bias
+}
+
+func punyAdapt(delta, points int, first bool) int {
+	if first {
+		delta /= punyDamp
+	} else {
+		delta /= 2
+	}
+	delta += delta / points
+	k := 0
+	for delta > (punyBase-punyTMin)*punyTMax/2 {
+		delta /= punyBase - punyTMin
+		k += punyBase
+	}
+	return k + (punyBase-punyTMin+1)*delta/(delta+punySkew)
+}
+
+func punyDigit(d int) byte {
+	if d < 26 {
+		return byte('a' + d)
+	}
+	return byte('0' + d - 26)
+}
+
+func punyValue(c byte) (int, bool) {
+	switch {
+	case 'a' <= c && c <= 'z':
+		return int(c - 'a'), true
+	case 'A' <= c && c <= 'Z':
+		return int(c - 'A'), true
+	case '0' <= c && c <= '9':
+		return int(c-'0') + 26, true
+	}
+	return 0, false
+}
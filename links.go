@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// ExtractLinks returns the <a href> links of the HTML document read from r, resolved against pageURL,
+// without fragments and without duplicates. Links are resolved against the first <base href> of the document
+// instead, when it has one. Links that cannot be pages are dropped, see checkLink.
+func ExtractLinks(r io.Reader, pageURL string) ([]URL, error) {
+	page, err := parseLinks(r, pageURL, false)
+	if page == nil {
+		return nil, err
+	}
+	return page.links, err
+}
+
+// extractLinks is ExtractLinks for fetchers, it records the robots directives of the page and its nofollow links
+// into the FetchMeta of ctx, for the crawl to honor. The links keep their #!/route and #/route fragments when the
+// Normalizer of the crawl keeps them, see Normalizer.KeepRouteFragments.
+func extractLinks(ctx context.Context, r io.Reader, pageURL string) ([]URL, error) {
+	keepRouteFragments := false
+	if trace := traceFromContext(ctx); trace != nil {
+		keepRouteFragments = trace.keepRouteFragments
+	}
+	page, err := parseLinks(r, pageURL, keepRouteFragments)
+	if page == nil {
+		return nil, err
+	}
+	meta := metaFromContext(ctx)
+	meta.Robots = page.robots
+	meta.Nofollow = page.nofollow
+	meta.Canonical = page.canonical
+	meta.Title = page.title
+	meta.Filtered = page.filtered
+	return page.links, err
+}
+
+// pageLinks are the links of an HTML document, and what it says about following them.
+type pageLinks struct {
+	links []URL
+	// nofollow are the links only found with rel="nofollow"
+	nofollow []URL
+	// robots are the directives of the <meta name="robots"> of the document, comma separated
+	robots string
+	// canonical is the url of the first <link rel="canonical"> of the document
+	canonical URL
+	// title is the text of the first <title> of the document, with its spaces collapsed
+	title string
+	// filtered counts the links dropped, by reason
+	filtered map[string]int
+}
+
+// parseLinks reads the links of the HTML document read from r, as returned by ExtractLinks, but for the fragments
+// routing single page apps with keepRouteFragments. It returns the links read so far along with a read error,
+// and nil pageLinks when pageURL does not parse.
+func parseLinks(r io.Reader, pageURL string, keepRouteFragments bool) (*pageLinks, error) {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil, err
+	}
+	page := &pageLinks{}
+	seen := make(map[URL]bool)
+	// followed are the links found without rel="nofollow" at least once
+	followed := make(map[URL]bool)
+	var robots []string
+	hasBase := false
+	// inTitle is set when the text of the first <title> comes next
+	inTitle, hasTitle := false, false
+	z := newHTMLTokenizer(r)
+	for {
+		t, err := z.next()
+		if err != nil {
+			for _, link := range page.links {
+				if !followed[link] {
+					page.nofollow = append(page.nofollow, link)
+				}
+			}
+			page.robots = strings.Join(robots, ",")
+			if err == io.EOF {
+				err = nil
+			}
+			return page, err
+		}
+		if inTitle {
+			inTitle = false
+			if t.kind == textToken {
+				page.title = strings.Join(strings.Fields(t.text), " ")
+			}
+			continue
+		}
+		if t.kind != startTagToken {
+			continue
+		}
+		if t.name == "title" {
+			inTitle, hasTitle = !hasTitle, true
+			continue
+		}
+		if t.name == "meta" {
+			if name, _ := t.attr("name"); strings.EqualFold(name, "robots") {
+				if content, ok := t.attr("content"); ok {
+					robots = append(robots, strings.ToLower(strings.TrimSpace(content)))
+				}
+			}
+			continue
+		}
+		if t.name == "link" {
+			if rel, _ := t.attr("rel"); hasToken(rel, "canonical") && page.canonical == "" {
+				if href, ok := t.attr("href"); ok {
+					page.canonical, _ = resolveLink(base, href)
+				}
+			}
+			continue
+		}
+		if t.name != "a" && t.name != "base" {
+			continue
+		}
+		href, ok := t.attr("href")
+		if !ok {
+			continue
+		}
+		if t.name == "base" {
+			// only the first base counts, a base that does not parse leaves the page url in effect
+			if !hasBase {
+				hasBase = true
+				if u, err := url.Parse(cleanHref(href)); err == nil {
+					base = base.ResolveReference(u)
+				}
+			}
+			continue
+		}
+		link, reason := checkLink(base, href, keepRouteFragments)
+		if reason != "" {
+			if page.filtered == nil {
+				page.filtered = make(map[string]int)
+			}
+			page.filtered[reason]++
+		}
+		if link == "" || reason != "" {
+			continue
+		}
+		if !seen[link] {
+			seen[link] = true
+			page.links = append(page.links, link)
+		}
+		if rel, _ := t.attr("rel"); !hasToken(rel, "nofollow") {
+			followed[link] = true
+		}
+	}
+}
+
+// robotsDirectives reports whether the page of meta asks not to be indexed and not to have its links followed,
+// with its <meta name="robots"> or its X-Robots-Tag headers. Headers for a named crawler, such as
+// "otherbot: noindex", are ignored.
+func robotsDirectives(meta FetchMeta) (noindex, nofollow bool) {
+	directives := []string{meta.Robots}
+	for _, value := range meta.Header.Values("X-Robots-Tag") {
+		if i := strings.IndexByte(value, ':'); i < 0 || strings.ContainsAny(value[:i], ", ") {
+			directives = append(directives, value)
+		}
+	}
+	for _, directive := range strings.Split(strings.Join(directives, ","), ",") {
+		switch strings.ToLower(strings.TrimSpace(directive)) {
+		case "noindex":
+			noindex = true
+		case "nofollow":
+			nofollow = true
+		case "none":
+			noindex, nofollow = true, true
+		}
+	}
+	return noindex, nofollow
+}
+
+// canonicalOf returns the canonical url the page at pageURL declares, with a <link rel="canonical"> or
+// a Link header, or an empty string when it declares none.
+func canonicalOf(pageURL URL, meta FetchMeta) URL {
+	if meta.Canonical != "" {
+		return meta.Canonical
+	}
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return ""
+	}
+	// Link: <https://golang.org/pkg/>; rel="canonical", <...>; rel=next
+	for _, value := range meta.Header.Values("Link") {
+		for _, link := range strings.Split(value, ",") {
+			parts := strings.Split(link, ";")
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			for _, param := range parts[1:] {
+				param = strings.TrimSpace(param)
+				i := strings.IndexByte(param, '=')
+				if i > 0 && strings.EqualFold(param[:i], "rel") && hasToken(strings.Trim(param[i+1:], `"`), "canonical") {
+					canonical, _ := resolveLink(base, target[1:len(target)-1])
+					return canonical
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// followedLinks returns the links of the page of meta the crawler follows, all of them with WithIgnoreNofollow.
+func (c *Crawler) followedLinks(links []URL, meta FetchMeta) []URL {
+	if c.ignoreNofollow {
+		return links
+	}
+	if _, nofollow := robotsDirectives(meta); nofollow {
+		return nil
+	}
+	if len(meta.Nofollow) == 0 {
+		return links
+	}
+	skip := make(map[URL]bool)
+	for _, link := range c.normalizeLinks(meta.Nofollow) {
+		skip[link] = true
+	}
+	followed := make([]URL, 0, len(links))
+	for _, link := range links {
+		if !skip[link] {
+			followed = append(followed, link)
+		}
+	}
+	return followed
+}
+
+// hasToken reports whether the space separated list of tokens list has token, regardless of case.
+func hasToken(list, token string) bool {
+	for _, t := range strings.Fields(list) {
+		if strings.EqualFold(t, token) {
+			return true
+		}
+	}
+	return false
+}
+
+// MaxURLLength is the length of the longest link kept by ExtractLinks, longer ones are most likely
+// generated without end.
+const MaxURLLength = 2048
+
+// Reasons of FetchMeta.Filtered and Stats.Filtered for the links dropped by ExtractLinks.
+const (
+	FilterMalformed = "malformed"
+	FilterTooLong   = "too long"
+)
+
+// unfetchableSchemes are the schemes of the links dropped by ExtractLinks, which are never pages.
+var unfetchableSchemes = map[string]bool{
+	"mailto":     true,
+	"javascript": true,
+	"tel":        true,
+	"data":       true,
+	"sms":        true,
+	"callto":     true,
+}
+
+// resolveLink resolves href against base, reporting false for hrefs dropped by checkLink.
+func resolveLink(base *url.URL, href string) (URL, bool) {
+	link, reason := checkLink(base, href, false)
+	return link, link != "" && reason == ""
+}
+
+// checkLink resolves href against base, without its fragment unless keepRouteFragments and it routes a single page app.
+// It returns an empty url for an empty href, and the reason of FetchMeta.Filtered for a link that is dropped:
+// its scheme when it is one of unfetchableSchemes, FilterMalformed when it does not parse or FilterTooLong when
+// it is longer than MaxURLLength.
+func checkLink(base *url.URL, href string, keepRouteFragments bool) (URL, string) {
+	href = cleanHref(href)
+	if href == "" {
+		return "", ""
+	}
+	ref, err := url.Parse(href)
+	if err != nil {
+		return "", FilterMalformed
+	}
+	if scheme := strings.ToLower(ref.Scheme); unfetchableSchemes[scheme] {
+		return "", scheme
+	}
+	u := base.ResolveReference(ref)
+	if !keepRouteFragments || !isRouteFragment(u.Fragment) {
+		u.Fragment = ""
+		u.RawFragment = ""
+	}
+	link := u.String()
+	if len(link) > MaxURLLength {
+		return "", FilterTooLong
+	}
+	return link, ""
+}
+
+// cleanHref trims the spaces around href, and removes the tabs and newlines within it as browsers do,
+// such as those of hrefs wrapped over several lines.
+func cleanHref(href string) string {
+	href = trimHTMLSpace(href)
+	if strings.ContainsAny(href, "\t\n\r") {
+		href = strings.NewReplacer("\t", "", "\n", "", "\r", "").Replace(href)
+	}
+	return href
+}
+
+func trimHTMLSpace(s string) string {
+	for len(s) > 0 && isHTMLSpace(s[0]) {
+		s = s[1:]
+	}
+	for len(s) > 0 && isHTMLSpace(s[len(s)-1]) {
+		s = s[:len(s)-1]
+	}
+	return s
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheckLink(t *testing.T) {
+	base, _ := url.Parse("https://example.com/docs/guide/page.html?v=1")
+	tests := []struct {
+		href               string
+		keepRouteFragments bool
+		link               URL
+		reason             string
+	}{
+		{href: "../api/", link: "https://example.com/docs/api/"},
+		{href: "./intro", link: "https://example.com/docs/guide/intro"},
+		{href: "//cdn.example.org/x", link: "https://cdn.example.org/x"},
+		{href: "?page=2", link: "https://example.com/docs/guide/page.html?page=2"},
+		{href: "#section", link: "https://example.com/docs/guide/page.html?v=1"},
+		{href: "/a#section", link: "https://example.com/a"},
+		{href: "#!/route", link: "https://example.com/docs/guide/page.html?v=1"},
+		{href: "#!/route", keepRouteFragments: true, link: "https://example.com/docs/guide/page.html?v=1#!/route"},
+		{href: "#section", keepRouteFragments: true, link: "https://example.com/docs/guide/page.html?v=1"},
+		{href: "  /a  ", link: "https://example.com/a"},
+		{href: "/wrapped\n\t/path", link: "https://example.com/wrapped/path"},
+		{href: "  ", link: ""},
+		{href: "mailto:someone@example.com", reason: "mailto"},
+		{href: "JavaScript:void(0)", reason: "javascript"},
+		{href: "http://[::1", reason: FilterMalformed},
+		{href: "/" + strings.Repeat("a", MaxURLLength), reason: FilterTooLong},
+	}
+	for _, test := range tests {
+		link, reason := checkLink(base, test.href, test.keepRouteFragments)
+		if link != test.link || reason != test.reason {
+			t.Errorf("checkLink(%q, %t) = %q, %q, want %q, %q", test.href, test.keepRouteFragments, link, reason, test.link, test.reason)
+		}
+	}
+}
+
+func TestExtractLinks(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		links []URL
+	}{
+		{"relative base", `<base href="/root/"><a href="a">`, []URL{"https://example.com/root/a"}},
+		{"absolute base", `<base href="https://other.example/x/"><a href="a">`, []URL{"https://other.example/x/a"}},
+		{"first base wins", `<base href="/first/"><base href="/second/"><a href="a">`, []URL{"https://example.com/first/a"}},
+		{"base without href", `<base target="_blank"><base href="/root/"><a href="a">`, []URL{"https://example.com/root/a"}},
+		{"whitespace", "<a href=\" /x \n\">x</a>", []URL{"https://example.com/x"}},
+		{"entities", `<a href="/y?a=1&amp;b=2">y</a><a href="&#x2F;hex">h</a>`, []URL{"https://example.com/y?a=1&b=2", "https://example.com/hex"}},
+		{"query only", `<a href="?page=2">`, []URL{"https://example.com/docs/page?page=2"}},
+		{"fragment only", `<a href="#top">`, []URL{"https://example.com/docs/page"}},
+		{"duplicates", `<a href="/x#a"><a href="/x#b"><a href="/x">`, []URL{"https://example.com/x"}},
+		{"dropped", `<a href="mailto:a@example.com"><a href=""><a href="tel:123">`, nil},
+	}
+	for _, test := range tests {
+		links, err := ExtractLinks(strings.NewReader(test.doc), "https://example.com/docs/page")
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+		if !reflect.DeepEqual(links, test.links) {
+			t.Errorf("%s: links = %q, want %q", test.name, links, test.links)
+		}
+	}
+}
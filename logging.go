@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+)
+
+// The records logged by the crawler, with WithLogger, and by the cache, with WithCacheLogger, carry the component
+// that logged them: crawler for the crawl as a whole, fetcher for the fetches, frontier for the links that are not
+// followed, and cache for the cache. Fetches are logged at debug level, failures at warn level.
+
+// discardLogger drops every record, it is the logger of the crawlers and caches without one.
+var discardLogger = slog.New(discardHandler{})
+
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool { return false }
+
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+
+func (h discardHandler) WithGroup(string) slog.Handler { return h }
+
+// componentLogger returns logger tagging its records with component, or discardLogger when logger is nil.
+func componentLogger(logger *slog.Logger, component string) *slog.Logger {
+	if logger == nil {
+		return discardLogger
+	}
+	return logger.With("component", component)
+}
@@ -1,8 +1,23 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"sync"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
 )
 
 //Fetcher is an abstraction for Fetching content from urls
@@ -12,78 +27,810 @@ type Fetcher interface {
 	Fetch(url string) (body string, urls []string, err error)
 }
 
-//FetchResult is a wrapper over the Fetch result
-type FetchResult struct {
-	body string
-	urls []string
-	err  error
+// ContextFetcher is a Fetcher that can be cancelled through a context
+type ContextFetcher interface {
+	Fetcher
+	// FetchContext is like Fetch, but gives up once ctx is done.
+	FetchContext(ctx context.Context, url string) (body string, urls []string, err error)
+}
+
+// StreamFetcher is a ContextFetcher that can also hand out bodies as they are downloaded.
+// A crawl whose fetcher is a StreamFetcher extracts the links from the stream, without holding whole bodies in memory.
+type StreamFetcher interface {
+	ContextFetcher
+	// FetchStream returns the body of url as it is downloaded. The Stream must be closed.
+	FetchStream(ctx context.Context, url string) (*Stream, error)
+}
+
+// Stream is a body being downloaded by a StreamFetcher.
+type Stream struct {
+	io.ReadCloser
+	// URL is the url the body was served from, after redirects, which its links are resolved against.
+	URL URL
+	// HTML is set when the body is an HTML document, links are only extracted from those.
+	HTML bool
+}
+
+// fetchContext fetches url with fetcher, passing ctx along when fetcher supports it.
+// Fetchers that do not support it are abandoned once ctx is done, and left to finish in the background.
+func fetchContext(ctx context.Context, fetcher Fetcher, url string) (string, []string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", nil, err
+	}
+	if cf, ok := fetcher.(ContextFetcher); ok {
+		return cf.FetchContext(ctx, url)
+	}
+	if ctx.Done() == nil {
+		return fetcher.Fetch(url)
+	}
+	fetched := make(chan *FetchResult, 1)
+	go func() {
+		body, urls, err := fetcher.Fetch(url)
+		fetched <- &FetchResult{body: body, urls: urls, err: err}
+	}()
+	select {
+	case r := <-fetched:
+		return r.body, r.urls, r.err
+	case <-ctx.Done():
+		return "", nil, ctx.Err()
+	}
+}
+
+// isContextError reports whether err was caused by a cancelled or expired context.
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
 }
 
 //URL is an alias for readbility to a string of a url
 type URL = string
 
-//FetcherCache is a Cache to Fetch results faster, using the Proxy Pattern
-type FetcherCache struct {
-	//Delegator is the Fetcher that is being cached
-	Delegator Fetcher
-	//Cache mapping between a Url to a FetchResult
-	Cache map[URL]*FetchResult
-	lock  sync.Mutex
-}
-
-//Fetch is a implementation for FecherCache
-func (f *FetcherCache) Fetch(url string) (body string, urls []string, err error) {
-	f.lock.Lock()
-	defer f.lock.Unlock()
-	fetchResult, isCached := f.Cache[url]
-	if isCached {
-		return fetchResult.body, fetchResult.urls, fetchResult.err
-	}
-	b, urls, err := f.Delegator.Fetch(url)
-	f.Cache[url] = &FetchResult{
-		body: b,
-		urls: urls,
-		err:  err,
-	}
-	return b, urls, err
-}
-
-// Crawl uses fetcher to recursively crawl
-// pages starting with url, to a maximum of depth.
-func Crawl(url string, depth int, fetcher Fetcher) {
-	// Fetch URLs in parallel.				 [DONE]
-	// Don't fetch the same URL twice. [DONE]
-	var waitGroup sync.WaitGroup
-
-	var recCrawl func(url string, depth int)
-	recCrawl = func(url string, depth int) {
-		defer waitGroup.Done()
-		if depth <= 0 {
-			return
+func main() {
+	checkpointPath := flag.String("checkpoint", "", "periodically save the crawl state to this `file`")
+	checkpointInterval := flag.Duration("checkpoint-interval", 10*time.Second, "how often to save the checkpoint")
+	resumePath := flag.String("resume", "", "resume the crawl saved in this checkpoint `file`, and keep checkpointing to it")
+	seedsPath := flag.String("seeds", "", "also crawl the urls listed in this `file`, one per line or as a sitemap, - for the standard input")
+	format := flag.String("format", "text", "write the pages as text, json, jsonl (a JSON object per line), csv, or null to only print the summary")
+	csvColumns := flag.String("csv-columns", strings.Join(DefaultCSVColumns, ","), "the comma separated `columns` of -format csv, among "+strings.Join(DefaultCSVColumns, ",")+",title,links,duplicate-of,canonical")
+	output := flag.String("o", "", "write the pages to this `file` instead of the standard output")
+	verbose := flag.Bool("v", false, "log every fetch, as -log-level debug does")
+	quiet := flag.Bool("q", false, "only log errors, and do not print the summary")
+	logLevel := flag.String("log-level", "info", "log the records of this `level` and above to stderr: debug, info, warn or error")
+	logFormat := flag.String("log-format", "text", "log as text or json")
+	showProgress := flag.Bool("progress", false, "show the pages per second, the frontier, the busy workers, the errors and the cache hit rate on stderr every second, in place on a terminal")
+	fetchTimeout := flag.Duration("fetch-timeout", 0, "abandon fetches taking longer than this")
+	maxDuration := flag.Duration("max-duration", 0, "stop the crawl after this long")
+	ignoreRobots := flag.Bool("ignore-robots", false, "crawl urls disallowed by robots.txt, and do not wait their Crawl-delay")
+	ignoreNofollow := flag.Bool("ignore-nofollow", false, "follow the links marked nofollow, and of the pages with a robots nofollow meta tag")
+	render := flag.Bool("render", false, "render pages with a headless browser, to find links added by JavaScript")
+	dotFile := flag.String("dot", "", "write the link graph to this Graphviz `file`")
+	dotDepth := flag.Bool("dot-depth", false, "color the nodes of -dot by depth instead of by status")
+	graphMLFile := flag.String("graphml", "", "write the link graph to this GraphML `file`")
+	gexfFile := flag.String("gexf", "", "write the link graph to this GEXF `file`, for Gephi")
+	mirrorDir := flag.String("mirror", "", "save the pages to this `dir`, with their links rewritten to browse them offline")
+	warcFile := flag.String("warc", "", "archive the pages to this WARC `file`, gzipped when it ends with .gz")
+	brokenLinksFile := flag.String("broken-links", "", "write the broken links and the pages linking to them to this `file`")
+	sqliteFile := flag.String("sqlite", "", "write the pages, links and errors to this SQLite database `file`, with the sqlite3 shell")
+	elasticsearchURL := flag.String("elasticsearch", "", "index the pages into the Elasticsearch or OpenSearch cluster at this `url`, with its credentials if any")
+	elasticsearchIndex := flag.String("elasticsearch-index", "crawl", "the `index` of -elasticsearch")
+	s3Bucket := flag.String("s3", "", "upload the pages to this S3 `bucket`, with the credentials of AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN")
+	s3Endpoint := flag.String("s3-endpoint", "", "the `url` of the S3 compatible service of -s3, AWS S3 by default")
+	s3Region := flag.String("s3-region", os.Getenv("AWS_REGION"), "the `region` of the bucket of -s3")
+	s3Key := flag.String("s3-key", DefaultS3KeyLayout, "the key `layout` of the objects of -s3, with {host}, {path}, {hash} and {date}")
+	s3Gzip := flag.Bool("s3-gzip", false, "gzip the bodies uploaded to -s3")
+	s3PathStyle := flag.Bool("s3-path-style", false, "address the bucket of -s3 in the path of the urls, as most S3 compatible services need")
+	reportJSON := flag.String("report-json", "", "also write the summary of the crawl to this `file` as JSON")
+	reportTop := flag.Int("report-top", DefaultReportTop, "list this many of the slowest, largest and deepest pages in the summary")
+	webhookURL := flag.String("webhook", "", "post the start and the end of the crawl to this `url` as JSON")
+	webhookMaxErrors := flag.Int("webhook-max-errors", 0, "also post to -webhook once more than this many pages failed")
+	webhookMaxErrorRate := flag.Float64("webhook-max-error-rate", 0, "also post to -webhook once the share of the failed pages is above this `rate`, such as 0.1")
+	webhookBrokenLinks := flag.Bool("webhook-broken-links", false, "also post every broken link to -webhook")
+	sitemapDir := flag.String("sitemap-dir", "", "write a sitemap.xml of the pages crawled successfully to this `dir`")
+	sitemapURL := flag.String("sitemap-url", "", "the `url` -sitemap-dir is served at, the root of the first seed by default")
+	useSitemaps := flag.Bool("sitemaps", false, "also crawl the urls listed in the sitemaps of the seeds")
+	bloomURLs := flag.Int("bloom", 0, "remember the visited urls in a Bloom filter sized for this many urls, instead of exactly")
+	bloomRate := flag.Float64("bloom-fp", DefaultFalsePositiveRate, "the false positive `rate` of -bloom, the share of the urls never crawled")
+	var include, exclude []*regexp.Regexp
+	flag.Var(&patternsFlag{&include, regexp.Compile}, "include", "only follow the links matching this `regexp`, can be repeated")
+	flag.Var(&patternsFlag{&exclude, regexp.Compile}, "exclude", "do not follow the links matching this `regexp`, can be repeated")
+	flag.Var(&patternsFlag{&include, CompileGlob}, "include-glob", "only follow the links matching this `glob`, matched against the path when it starts with /, can be repeated")
+	flag.Var(&patternsFlag{&exclude, CompileGlob}, "exclude-glob", "do not follow the links matching this `glob`, can be repeated")
+	skipExtensions := flag.String("skip-extensions", "", "do not fetch the links with this comma separated `list` of extensions, such as .pdf,.zip, or default for the usual files that are not pages")
+	checkSkipped := flag.Bool("check-skipped", false, "check the links of -skip-extensions with HEAD requests instead, reporting the broken ones")
+	maxPages := flag.Int("max-pages", 0, "stop after fetching this many pages")
+	var weights []PatternWeight
+	flag.Var(&weightsFlag{&weights}, "weight", "fetch the urls matching a glob first, or last with a negative weight, `glob=weight` such as /docs/**=10, can be repeated")
+	depthWeight := flag.Int("depth-weight", 0, "with -weight, take this off the weight of the urls for every link from the seed")
+	maxLinks := flag.Int("max-links", 0, "enqueue at most this many new links from a page")
+	forceHTTPS := flag.Bool("force-https", false, "crawl the http urls found over https")
+	var rewrites []RewriteFunc
+	flag.Var(&hostMapFlag{&rewrites}, "map-host", "crawl the urls of a host on another, `from=to`, or drop them when to is empty, can be repeated")
+	var pathDepths []Option
+	flag.Var(&pathDepthsFlag{&pathDepths}, "path-depth", "crawl the urls under a `prefix=depth` to that depth instead, such as /docs=5, the longest prefix wins, can be repeated")
+	externalDepth := flag.Int("external-depth", 0, "follow the links out of -scope, or to other hosts than the seeds, for this many links, such as 1 to check them")
+	scopeName := flag.String("scope", "open", "follow links to any host with open, or only to the hosts of the seeds with host, or to their domains with domain")
+	trailingSlash := flag.String("trailing-slash", "keep", "`policy` for the trailing slashes of the urls found: keep, add to the paths without an extension, or strip")
+	routeFragments := flag.Bool("route-fragments", false, "crawl the #!/route and #/route links of single page apps as pages of their own, with -render")
+	sortQuery := flag.Bool("sort-query", false, "sort the query parameters of the urls found, so their permutations are crawled once")
+	stripParams := flag.String("strip-params", "", "drop this comma separated `list` of query parameters from the urls found, a trailing * matches prefixes")
+	stripTracking := flag.Bool("strip-tracking", false, "drop the usual tracking and session query parameters from the urls found, such as utm_*")
+	detectTraps := flag.Bool("detect-traps", false, "do not follow the links of suspected crawler traps, such as calendars, and report them")
+	canonicalDedup := flag.Bool("canonical-dedup", false, "report the pages with the same canonical url as a page crawled before, and do not follow their links")
+	dedup := flag.Bool("dedup", false, "report the pages with the same content as a page crawled before")
+	skipDuplicateLinks := flag.Bool("skip-duplicate-links", false, "do not follow the links of the pages reported by -dedup, implies -dedup")
+	retries := flag.Int("retries", 0, "retry transient web failures up to this many times")
+	hostDelay := flag.Duration("host-delay", 0, "wait at least this long between two fetches from the same host")
+	domainDelay := flag.Bool("domain-delay", false, "apply -host-delay to the registrable domains instead of the hosts")
+	publicSuffixes := flag.String("public-suffixes", "", "group the hosts by registrable domain with the public suffix list in this `file`, public_suffix_list.dat, instead of the built-in subset")
+	proxies := flag.String("proxies", "", "send web requests through this comma separated `list` of proxy urls, in turn")
+	proxyCheckURL := flag.String("proxy-check-url", "", "request this `url` through every proxy of -proxies before crawling, leaving out those that fail")
+	connsPerHost := flag.Int("conns-per-host", 0, "open at most this many connections to every web host, and keep them open")
+	userAgent := flag.String("user-agent", DefaultUserAgent, "identify the crawler with this user agent, also matched against robots.txt")
+	userAgents := flag.String("user-agents", "", "send the user agents listed in this `file`, one per line, in turn")
+	maxBodySize := flag.Int64("max-body-size", 0, "skip web pages larger than this many bytes")
+	htmlOnly := flag.Bool("html-only", false, "skip web pages that are not HTML, checking them with a HEAD request first")
+	circuitFailures := flag.Int("circuit-failures", 0, "skip the rest of a web host after this many failures in a row, probing it again after a minute")
+	dnsTTL := flag.Duration("dns-cache", 0, "keep the addresses of web hosts for this long instead of resolving them for every connection")
+	cacheEntries := flag.Int("cache-entries", 0, "keep at most this many fetched pages in memory, evicting the least recently used ones")
+	cacheBytes := flag.Int64("cache-bytes", 0, "keep fetched pages up to this many bytes in memory, evicting the least recently used ones")
+	cacheDir := flag.String("cache-dir", "", "keep the fetched pages in this `directory`, a file per page, to reuse them in later crawls")
+	redisAddr := flag.String("cache-redis", "", "share the fetched pages with other crawls through the Redis server at this `host:port`")
+	cacheStale := flag.Duration("cache-stale", 0, "serve pages from the cache up to this long after they went stale, while fetching them again")
+	cacheShards := flag.Int("cache-shards", 0, "spread the cache over this many maps, for crawls with many workers")
+	cacheCompress := flag.Int("cache-compress", 0, "keep the fetched pages larger than this many bytes compressed in memory")
+	cacheHTTP := flag.Bool("cache-http", false, "keep the fetched pages in the cache as long as their Cache-Control and Expires headers declare")
+	cacheErrors := flag.String("cache-errors", "not_found,http_4xx", "cache the failed pages of this comma separated `list` of error classes, the others are fetched again")
+	cacheFile := flag.String("cache-file", "", "preload the cache from this `file` when it exists, and save the cache to it after the crawl")
+	cacheFileFormat := flag.String("cache-file-format", FormatJSON, "the `format` of the results saved to -cache-file, json or gob")
+	credentials := make(map[string]*Credential)
+	flag.Var(&credentialsFlag{credentials, setBasicAuth}, "auth", "authenticate to a web host with basic auth, as `host=user:password`, can be repeated")
+	flag.Var(&credentialsFlag{credentials, setBearer}, "bearer", "authenticate to a web host with a bearer token, as `host=token`, can be repeated")
+	metricsAddr := flag.String("metrics", "", "serve the metrics of the crawl to Prometheus on /metrics at this `address`, such as :9090")
+	debugAddr := flag.String("debug", "", "serve the expvars, with the progress of the crawl, on /debug/vars and the profiles of pprof on /debug/pprof/ at this `address`, such as localhost:6060")
+	otlpEndpoint := flag.String("otlp", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), "export a trace of every page to the OpenTelemetry collector at this `url`, with OTLP over HTTP, such as http://localhost:4318")
+	monitorInterval := flag.Duration("monitor", 0, "keep fetching the crawled pages again at this interval and report changes")
+	flag.Parse()
+
+	// the logs and the summary go above the progress line
+	stderr := io.Writer(os.Stderr)
+	var progress *ProgressDisplay
+	if *showProgress {
+		progress = &ProgressDisplay{W: os.Stderr, Terminal: isTerminal(os.Stderr)}
+		stderr = progress
+	}
+	logger, err := newLogger(stderr, *logFormat, *logLevel, *verbose, *quiet)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	slog.SetDefault(logger)
+
+	if *publicSuffixes != "" {
+		list, err := loadPublicSuffixes(*publicSuffixes)
+		if err != nil {
+			fatal("load public suffixes", err)
 		}
-		body, urls, err := fetcher.Fetch(url)
+		DefaultPublicSuffixList = list
+	}
+
+	// the first SIGINT or SIGTERM stops the crawl, a second one kills the process
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	opts := []Option{
+		WithDepth(4),
+		WithGracePeriod(5 * time.Second),
+		WithLogger(logger),
+	}
+	if *resumePath != "" {
+		cp, err := LoadCheckpoint(*resumePath)
 		if err != nil {
-			fmt.Println(err)
-			return
+			fatal("load checkpoint", err)
 		}
-		fmt.Printf("found: %s %q\n", url, body)
-		for _, u := range urls {
-			waitGroup.Add(1)
-			go recCrawl(u, depth-1)
+		opts = append(opts, WithResume(cp))
+		if *checkpointPath == "" {
+			*checkpointPath = *resumePath
 		}
 	}
-	waitGroup.Add(1)
-	recCrawl(url, depth)
-	waitGroup.Wait()
-	return
-}
+	if *checkpointPath != "" {
+		opts = append(opts, WithCheckpoint(*checkpointPath, *checkpointInterval))
+	}
+	var tracer *Tracer
+	if *otlpEndpoint != "" {
+		tracer = &Tracer{Endpoint: *otlpEndpoint, ServiceName: os.Getenv("OTEL_SERVICE_NAME")}
+		opts = append(opts, WithTracer(tracer))
+	}
+	// the endpoints at the same address share its listener
+	muxes := make(map[string]*http.ServeMux)
+	if *metricsAddr != "" {
+		metrics := &Metrics{}
+		opts = append(opts, WithMetrics(metrics))
+		muxAt(muxes, *metricsAddr).Handle("/metrics", metrics)
+	}
+	var progressReports []func(Progress)
+	if progress != nil {
+		progressReports = append(progressReports, progress.Update)
+	}
+	if *debugAddr != "" {
+		handleDebug(muxAt(muxes, *debugAddr))
+		progressReports = append(progressReports, publishProgress())
+	}
+	if len(progressReports) > 0 {
+		opts = append(opts, WithProgress(time.Second, func(p Progress) {
+			for _, report := range progressReports {
+				report(p)
+			}
+		}))
+	}
+	for addr, mux := range muxes {
+		serve(addr, mux)
+	}
 
-func main() {
-	Crawl("https://golang.org/", 4, //fetcher)
-		&FetcherCache{
-			Delegator: fetcher,
-			Cache:     make(map[URL]*FetchResult),
+	// without seeds, the canned golang.org pages are crawled
+	seeds := flag.Args()
+	if *seedsPath != "" {
+		list, err := loadSeeds(*seedsPath)
+		if err != nil {
+			fatal("load seeds", err)
+		}
+		seeds = uniqueURLs(append(seeds, list...))
+	}
+	httpFetcher := &HTTPFetcher{UserAgent: *userAgent, Credentials: credentials, MaxBodySize: *maxBodySize}
+	if *htmlOnly {
+		httpFetcher.ContentTypes = []string{"text/html", "application/xhtml+xml"}
+		httpFetcher.HeadFirst = true
+	}
+	web := Fetcher(httpFetcher)
+	var source Fetcher
+	if len(seeds) == 0 {
+		seeds = []URL{"https://golang.org/"}
+		source = fetcher
+	} else {
+		if *proxies != "" {
+			pool, err := ParseProxies(*proxies)
+			if err != nil {
+				fatal("parse proxies", err)
+			}
+			httpFetcher.Proxies = &ProxyPool{Proxies: pool, CheckURL: *proxyCheckURL}
+			if *proxyCheckURL != "" {
+				if err := httpFetcher.Proxies.Check(ctx); err != nil {
+					fatal("check proxies", err)
+				}
+			}
+		}
+		if *connsPerHost > 0 || *dnsTTL > 0 {
+			httpFetcher.TransportConfig = &TransportConfig{MaxConnsPerHost: *connsPerHost, MaxIdleConnsPerHost: *connsPerHost}
+			if *dnsTTL > 0 {
+				httpFetcher.TransportConfig.DNSCache = &DNSCache{TTL: *dnsTTL}
+			}
+		}
+		if *userAgents != "" {
+			list, err := readLines(*userAgents)
+			if err != nil {
+				fatal("load user agents", err)
+			}
+			httpFetcher.UserAgents = list
+		}
+		if *render {
+			web = &RenderingFetcher{UserAgent: *userAgent}
+		}
+		if *circuitFailures > 0 {
+			web = &CircuitBreakerFetcher{Delegate: web, MaxFailures: *circuitFailures}
+		}
+		robots := &Robots{UserAgent: *userAgent, Client: httpFetcher.HTTPClient()}
+		// the Crawl-delay of the robots.txt files is honored unless they are ignored
+		if *hostDelay > 0 || !*ignoreRobots {
+			limiter := &RateLimitFetcher{Delegate: web, Delay: *hostDelay, PerDomain: *domainDelay}
+			if !*ignoreRobots {
+				limiter.Robots = robots
+			}
+			web = limiter
+		}
+		if *retries > 0 {
+			web = &RetryFetcher{Delegate: web, MaxAttempts: *retries + 1}
+		}
+		source = SchemeFetcher{
+			"http":  web,
+			"https": web,
+			"file":  &FileFetcher{},
+			"ftp":   &FTPFetcher{},
+			"sftp":  &SFTPFetcher{},
+		}
+		// local paths are crawled as file urls
+		for i, seed := range seeds {
+			if !strings.Contains(seed, "://") {
+				fileURL, err := FileURL(seed)
+				if err != nil {
+					fatal("parse seed", err)
+				}
+				seeds[i] = fileURL
+			}
+		}
+		if !*ignoreRobots {
+			opts = append(opts, WithRobots(robots))
+		}
+		if *useSitemaps {
+			opts = append(opts, WithSitemaps(&Sitemaps{Client: httpFetcher.HTTPClient(), UserAgent: *userAgent, Robots: robots}))
+		}
+	}
+	if *fetchTimeout > 0 {
+		opts = append(opts, WithFetchTimeout(*fetchTimeout))
+	}
+	if *maxDuration > 0 {
+		opts = append(opts, WithCrawlDeadline(time.Now().Add(*maxDuration)))
+	}
+	scope, err := ParseScope(*scopeName)
+	if err != nil {
+		fatal("parse scope", err)
+	}
+	if *ignoreNofollow {
+		opts = append(opts, WithIgnoreNofollow())
+	}
+	opts = append(opts, WithScope(scope), WithExternalDepth(*externalDepth), WithInclude(include...), WithExclude(exclude...))
+	opts = append(opts, pathDepths...)
+	slashPolicy, err := ParseTrailingSlash(*trailingSlash)
+	if err != nil {
+		fatal("parse trailing slash", err)
+	}
+	normalizer := &Normalizer{TrailingSlash: slashPolicy, SortQuery: *sortQuery, KeepRouteFragments: *routeFragments}
+	if *stripParams != "" {
+		normalizer.StripParams = strings.Split(*stripParams, ",")
+	}
+	if *stripTracking {
+		normalizer.StripParams = append(normalizer.StripParams, TrackingParams...)
+	}
+	opts = append(opts, WithNormalizer(normalizer))
+	if *skipExtensions == "default" {
+		opts = append(opts, WithSkipExtensions(*checkSkipped))
+	} else if *skipExtensions != "" {
+		opts = append(opts, WithSkipExtensions(*checkSkipped, strings.Split(*skipExtensions, ",")...))
+	}
+	if *maxPages > 0 {
+		opts = append(opts, WithMaxPages(*maxPages))
+	}
+	if len(weights) > 0 || *depthWeight != 0 {
+		opts = append(opts, WithPriority(WeightedScore(*depthWeight, weights...)))
+	}
+	if *maxLinks > 0 {
+		opts = append(opts, WithMaxLinks(*maxLinks))
+	}
+	if *forceHTTPS {
+		opts = append(opts, WithRewrite(ForceHTTPS()))
+	}
+	for _, rewrite := range rewrites {
+		opts = append(opts, WithRewrite(rewrite))
+	}
+	if *detectTraps {
+		opts = append(opts, WithTrapDetector(&TrapDetector{}))
+	}
+	if *bloomURLs > 0 {
+		opts = append(opts, WithVisitedSet(NewBloomVisitedSet(*bloomURLs, *bloomRate)))
+	}
+	if *canonicalDedup {
+		opts = append(opts, WithCanonicalDedup())
+	}
+	if *dedup || *skipDuplicateLinks {
+		opts = append(opts, WithDedup(*skipDuplicateLinks))
+	}
+
+	if *monitorInterval > 0 {
+		// the cache revalidates every fetch, so unchanged pages cost a conditional request
+		opts = append(opts, WithRecrawlInterval(*monitorInterval))
+		cache := NewFetcherCache(source, WithRevalidate(), WithMaxEntries(*cacheEntries), WithMaxBytes(*cacheBytes), WithCacheLogger(logger))
+		// SIGHUP clears the cache, to fetch the pages again without validators
+		hangups := make(chan os.Signal, 1)
+		signal.Notify(hangups, syscall.SIGHUP)
+		go func() {
+			for range hangups {
+				if n, err := cache.Clear(); err == nil {
+					slog.Info("cache cleared", "entries", n)
+				}
+			}
+		}()
+		err := NewCrawler(cache, opts...).Monitor(ctx, seeds, func(c Change) {
+			fmt.Printf("changed: %s %q\n", c.Page.URL, c.Page.Body)
 		})
+		if tracer != nil {
+			if err := tracer.Close(); err != nil {
+				slog.Error("export traces", "err", err)
+			}
+		}
+		if err != nil && !isContextError(err) {
+			fatal("monitor", err)
+		}
+		return
+	}
+
+	cacheOpts := []CacheOption{
+		WithCacheLogger(logger),
+		WithMaxEntries(*cacheEntries),
+		WithMaxBytes(*cacheBytes),
+		WithCompression(*cacheCompress),
+		WithShards(*cacheShards),
+		WithErrorPolicy(CacheErrorClasses(0, strings.Split(*cacheErrors, ",")...)),
+		WithExportFormat(*cacheFileFormat),
+	}
+	if *cacheHTTP {
+		cacheOpts = append(cacheOpts, WithHTTPCaching())
+	}
+	if *cacheStale > 0 {
+		cacheOpts = append(cacheOpts, WithStaleWhileRevalidate(*cacheStale))
+	}
+	var store CacheStore
+	var diskStore *DiskStore
+	if *cacheDir != "" {
+		diskStore = &DiskStore{Dir: *cacheDir}
+		store = diskStore
+	}
+	var redisStore *RedisStore
+	if *redisAddr != "" {
+		redisStore = &RedisStore{Addr: *redisAddr}
+		store = redisStore
+	}
+	var tieredStore *TieredStore
+	if store != nil && (*cacheEntries > 0 || *cacheBytes > 0) {
+		// the bounds of the cache apply to the memory layer in front of the store
+		tieredStore = &TieredStore{Hot: &MapStore{MaxEntries: *cacheEntries, MaxBytes: *cacheBytes, CompressAbove: *cacheCompress}, Cold: store}
+		store = tieredStore
+	}
+	if store != nil {
+		cacheOpts = append(cacheOpts, WithStore(store))
+	}
+	cache := NewFetcherCache(source, cacheOpts...)
+	if *cacheFile != "" {
+		if err := loadCache(cache, *cacheFile); err != nil {
+			fatal("load cache", err)
+		}
+	}
+	out := io.Writer(os.Stdout)
+	var outFile *os.File
+	if *output != "" {
+		var err error
+		if outFile, err = os.Create(*output); err != nil {
+			fatal("create output", err)
+		}
+		out = outFile
+	}
+	sink, err := newSink(*format, out, strings.Split(*csvColumns, ","))
+	if err != nil {
+		fatal("create sink", err)
+	}
+	// the summary does not mix with the records written to the standard output
+	report := io.Writer(os.Stdout)
+	if *output == "" && *format != "text" {
+		report = stderr
+	}
+	if *quiet {
+		report = io.Discard
+	}
+	summary := &ReportSink{Top: *reportTop}
+	sinks := []Sink{sink, summary}
+	if *sitemapDir != "" {
+		sinks = append(sinks, &SitemapSink{Dir: *sitemapDir, BaseURL: *sitemapURL})
+	}
+	if *dotFile != "" {
+		sinks = append(sinks, createSink(*dotFile, func(w io.Writer) Sink {
+			return &DOTSink{W: w, ColorByDepth: *dotDepth}
+		}))
+	}
+	if *mirrorDir != "" {
+		sinks = append(sinks, &MirrorSink{Dir: *mirrorDir})
+	}
+	if *warcFile != "" {
+		sinks = append(sinks, createSink(*warcFile, func(w io.Writer) Sink {
+			return &WARCSink{W: w, Gzip: strings.HasSuffix(*warcFile, ".gz"), UserAgent: *userAgent}
+		}))
+	}
+	if *brokenLinksFile != "" {
+		sinks = append(sinks, createSink(*brokenLinksFile, func(w io.Writer) Sink { return &BrokenLinkSink{W: w} }))
+	}
+	if *sqliteFile != "" {
+		sinks = append(sinks, &SQLiteSink{Path: *sqliteFile})
+	}
+	if *elasticsearchURL != "" {
+		sink, err := newElasticsearchSink(*elasticsearchURL, *elasticsearchIndex)
+		if err != nil {
+			fatal("create sink", err)
+		}
+		sinks = append(sinks, sink)
+	}
+	if *s3Bucket != "" {
+		sinks = append(sinks, &S3Sink{
+			Endpoint:     *s3Endpoint,
+			Region:       *s3Region,
+			Bucket:       *s3Bucket,
+			AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+			PathStyle:    *s3PathStyle,
+			KeyLayout:    *s3Key,
+			Gzip:         *s3Gzip,
+		})
+	}
+	if *webhookURL != "" {
+		sinks = append(sinks, &Webhook{
+			URL:          *webhookURL,
+			MaxErrors:    *webhookMaxErrors,
+			MaxErrorRate: *webhookMaxErrorRate,
+			BrokenLinks:  *webhookBrokenLinks,
+		})
+	}
+	if *graphMLFile != "" {
+		sinks = append(sinks, createSink(*graphMLFile, func(w io.Writer) Sink { return &GraphMLSink{W: w} }))
+	}
+	if *gexfFile != "" {
+		sinks = append(sinks, createSink(*gexfFile, func(w io.Writer) Sink { return &GEXFSink{W: w} }))
+	}
+	for _, sink := range sinks {
+		opts = append(opts, WithSink(sink))
+	}
+	it := NewCrawler(cache, opts...).Run(ctx, seeds...)
+	for _, ok := it.Next(); ok; _, ok = it.Next() {
+	}
+	result := it.Result()
+	for _, sink := range sinks {
+		if err := sink.Close(); err != nil {
+			slog.Error("close sink", "err", err)
+		}
+	}
+	if outFile != nil {
+		if err := outFile.Close(); err != nil {
+			slog.Error("close output", "err", err)
+		}
+	}
+	if tracer != nil {
+		if err := tracer.Close(); err != nil {
+			slog.Error("export traces", "err", err)
+		}
+	}
+	printSummary(report, result, summary)
+	if *reportJSON != "" {
+		if err := writeReport(summary, *reportJSON); err != nil {
+			slog.Error("write report", "err", err)
+		}
+	}
+	cache.Close()
+	cacheStats := cache.Stats()
+	fmt.Fprintf(report, "cache: %d entries, %d bytes, %d hits, %d misses, %d evictions, %d errors cached\n",
+		cacheStats.Entries, cacheStats.Bytes, cacheStats.Hits, cacheStats.Misses, cacheStats.Evictions, cacheStats.ErrorsCached)
+	if tieredStore != nil {
+		tierStats := tieredStore.Stats()
+		fmt.Fprintf(report, "cache tiers: %d memory hits, %d store hits, %d misses\n", tierStats.HotHits, tierStats.ColdHits, tierStats.Misses)
+	}
+	if *cacheFile != "" {
+		if err := saveCache(cache, *cacheFile); err != nil {
+			slog.Error("save cache", "err", err)
+		}
+	}
+	if diskStore != nil && diskStore.Err() != nil {
+		slog.Error("disk cache failed", "dir", *cacheDir, "err", diskStore.Err())
+	}
+	if redisStore != nil && redisStore.Err() != nil {
+		slog.Error("redis cache failed", "addr", *redisAddr, "err", redisStore.Err())
+	}
+}
+
+// newLogger returns the logger of the records of level, or of debug ones with verbose and of errors with quiet,
+// writing them to w as text or json.
+func newLogger(w io.Writer, format, level string, verbose, quiet bool) (*slog.Logger, error) {
+	var min slog.Level
+	if err := min.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("unknown log level %q", level)
+	}
+	switch {
+	case quiet:
+		min = slog.LevelError
+	case verbose:
+		min = slog.LevelDebug
+	}
+	opts := &slog.HandlerOptions{Level: min}
+	switch format {
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q", format)
+}
+
+// muxAt returns the mux of muxes serving the address addr, adding it when there is none.
+func muxAt(muxes map[string]*http.ServeMux, addr string) *http.ServeMux {
+	if muxes[addr] == nil {
+		muxes[addr] = http.NewServeMux()
+	}
+	return muxes[addr]
+}
+
+// serve serves handler at the address addr in the background, exiting when it cannot listen on it.
+func serve(addr string, handler http.Handler) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		fatal("listen", err)
+	}
+	go func() {
+		if err := http.Serve(listener, handler); err != nil {
+			slog.Error("serve", "addr", addr, "err", err)
+		}
+	}()
+}
+
+// isTerminal reports whether f is a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// fatal logs err as the reason the command stops at msg, and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, "err", err)
+	os.Exit(1)
+}
+
+// newSink returns the Sink writing the pages to w in format, with columns for csv.
+func newSink(format string, w io.Writer, columns []string) (Sink, error) {
+	switch format {
+	case "text":
+		return &TextSink{W: w}, nil
+	case "json":
+		return &JSONSink{W: w}, nil
+	case "jsonl":
+		return &JSONLinesSink{W: w}, nil
+	case "csv":
+		return NewCSVSink(w, columns...)
+	case "null":
+		return NullSink{}, nil
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+// fileSink is a Sink writing to a file, closed along with it.
+type fileSink struct {
+	Sink
+	file *os.File
+}
+
+func (s *fileSink) Close() error {
+	err := s.Sink.Close()
+	if closeErr := s.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// createSink returns the Sink returned by newSink writing to the file name, exiting when it cannot be created.
+func createSink(name string, newSink func(w io.Writer) Sink) Sink {
+	file, err := os.Create(name)
+	if err != nil {
+		fatal("create sink", err)
+	}
+	return &fileSink{Sink: newSink(file), file: file}
+}
+
+// newElasticsearchSink returns the ElasticsearchSink of the cluster at rawURL, authenticated with the user info
+// of the url.
+func newElasticsearchSink(rawURL, index string) (*ElasticsearchSink, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	sink := &ElasticsearchSink{Index: index}
+	if u.User != nil {
+		sink.Username = u.User.Username()
+		sink.Password, _ = u.User.Password()
+		u.User = nil
+	}
+	sink.URL = u.String()
+	return sink, nil
+}
+
+// writeReport writes the report of summary to the file name as JSON.
+func writeReport(summary *ReportSink, name string) error {
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := summary.WriteJSON(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// loadSeeds reads the seeds listed in the file name, or in the standard input for -.
+func loadSeeds(name string) ([]URL, error) {
+	if name == "-" {
+		return ReadSeeds(os.Stdin)
+	}
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	seeds, err := ReadSeeds(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return seeds, nil
+}
+
+// loadPublicSuffixes reads the public suffix list in the file name.
+func loadPublicSuffixes(name string) (*PublicSuffixList, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ParsePublicSuffixList(file)
+}
+
+// loadCache preloads cache from the file name, a missing file is an empty cache.
+func loadCache(cache *FetcherCache, name string) error {
+	file, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return cache.LoadFrom(bufio.NewReader(file))
+}
+
+// saveCache saves cache to the file name, replacing it atomically.
+func saveCache(cache *FetcherCache, name string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	w := bufio.NewWriter(tmp)
+	if err := cache.SaveTo(w); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// readLines returns the lines of the file name, without blank ones.
+func readLines(name string) ([]string, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
+
+// printSummary prints the report of the crawl to w, followed by what it leaves out of the result.
+func printSummary(w io.Writer, result *CrawlResult, summary *ReportSink) {
+	summary.WriteText(w)
+	if result.Abandoned > 0 {
+		fmt.Fprintf(w, "abandoned: %d fetches in flight\n", result.Abandoned)
+	}
+	stats := result.Stats
+	if stats.Duplicates > 0 {
+		fmt.Fprintf(w, "duplicates: %d pages\n", stats.Duplicates)
+	}
+	if stats.External > 0 {
+		fmt.Fprintf(w, "external: %d pages\n", stats.External)
+	}
+	for _, trap := range result.Traps {
+		fmt.Fprintf(w, "trap: %s %s, %d links dropped such as %s\n", trap.Kind, DisplayURL(trap.Pattern), trap.Dropped, DisplayURL(trap.Example))
+	}
 }
 
 // fakeFetcher is Fetcher that returns canned results.
@@ -98,7 +845,7 @@ func (f fakeFetcher) Fetch(url string) (string, []string, error) {
 	if res, ok := f[url]; ok {
 		return res.body, res.urls, nil
 	}
-	return "", nil, fmt.Errorf("not found: %s", url)
+	return "", nil, fmt.Errorf("%w: %s", ErrNotFound, url)
 }
 
 // fetcher is a populated fakeFetcher.
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"container/list"
+	"io"
+	"sync"
+)
+
+// MapStore is the CacheStore keeping the results in memory, the store of a FetcherCache without WithStore.
+// It evicts the least recently used results beyond MaxEntries and MaxBytes.
+type MapStore struct {
+	// MaxEntries is the number of results kept, without limit when 0.
+	MaxEntries int
+	// MaxBytes is the size of the results kept, without limit when 0. A result larger than MaxBytes is not kept.
+	MaxBytes int64
+	// CompressAbove keeps the bodies larger than this many bytes compressed with DEFLATE, which fits several
+	// times more HTML pages in MaxBytes at the cost of inflating them on every Get. Bodies are kept as is when 0.
+	CompressAbove int
+
+	lock    sync.Mutex
+	results map[URL]*mapEntry
+	// bytes is the size of results
+	bytes int64
+	// recent lists the stored urls from the most to the least recently used, when MaxEntries or MaxBytes is set
+	recent    *list.List
+	recentOf  map[URL]*list.Element
+	evictions int
+}
+
+// mapEntry is a result kept by a MapStore, with its body in deflated when it is compressed.
+type mapEntry struct {
+	result   *FetchResult
+	deflated []byte
+}
+
+// size returns the size of the entry stored for url, in bytes.
+func (e *mapEntry) size(url URL) int64 {
+	return e.result.size(url) + int64(len(e.deflated))
+}
+
+// unpack returns the result of the entry, inflating its body when it is compressed.
+func (e *mapEntry) unpack() (*FetchResult, bool) {
+	if e.deflated == nil {
+		return e.result, true
+	}
+	body, err := io.ReadAll(flate.NewReader(bytes.NewReader(e.deflated)))
+	if err != nil {
+		return nil, false
+	}
+	result := *e.result
+	result.body = string(body)
+	return &result, true
+}
+
+// deflaters are the flate writers reused by the MapStores.
+var deflaters = sync.Pool{
+	New: func() interface{} {
+		w, _ := flate.NewWriter(nil, flate.BestSpeed)
+		return w
+	},
+}
+
+// pack returns the entry of result, compressing its body when larger than CompressAbove.
+// It keeps the body as is when it does not compress.
+func (s *MapStore) pack(result *FetchResult) *mapEntry {
+	if s.CompressAbove <= 0 || len(result.body) <= s.CompressAbove {
+		return &mapEntry{result: result}
+	}
+	var buf bytes.Buffer
+	w := deflaters.Get().(*flate.Writer)
+	defer deflaters.Put(w)
+	w.Reset(&buf)
+	io.WriteString(w, result.body)
+	if err := w.Close(); err != nil || buf.Len() >= len(result.body) {
+		return &mapEntry{result: result}
+	}
+	stripped := *result
+	stripped.body = ""
+	return &mapEntry{result: &stripped, deflated: buf.Bytes()}
+}
+
+// Get is the implementation of CacheStore for MapStore, it marks the result as recently used.
+func (s *MapStore) Get(url URL) (*FetchResult, bool) {
+	s.lock.Lock()
+	entry, ok := s.results[url]
+	if ok && s.recent != nil {
+		if elem, tracked := s.recentOf[url]; tracked {
+			s.recent.MoveToFront(elem)
+		}
+	}
+	s.lock.Unlock()
+	if !ok {
+		return nil, false
+	}
+	// bodies are inflated without the lock held
+	return entry.unpack()
+}
+
+// Set is the implementation of CacheStore for MapStore, it evicts the least recently used results beyond
+// MaxEntries and MaxBytes.
+func (s *MapStore) Set(url URL, result *FetchResult) {
+	entry := s.pack(result)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.MaxBytes > 0 && entry.size(url) > s.MaxBytes {
+		// it would evict every other result before itself, the result it replaces goes stale too
+		s.remove(url)
+		return
+	}
+	if s.results == nil {
+		s.results = make(map[URL]*mapEntry)
+	}
+	if old, ok := s.results[url]; ok {
+		s.bytes -= old.size(url)
+	}
+	s.results[url] = entry
+	s.bytes += entry.size(url)
+	if s.MaxEntries <= 0 && s.MaxBytes <= 0 {
+		return
+	}
+	if s.recent == nil {
+		s.recent = list.New()
+		s.recentOf = make(map[URL]*list.Element)
+	}
+	if elem, ok := s.recentOf[url]; ok {
+		s.recent.MoveToFront(elem)
+	} else {
+		s.recentOf[url] = s.recent.PushFront(url)
+	}
+	for s.recent.Len() > 0 && (s.MaxEntries > 0 && s.recent.Len() > s.MaxEntries || s.MaxBytes > 0 && s.bytes > s.MaxBytes) {
+		s.remove(s.recent.Back().Value.(URL))
+		s.evictions++
+	}
+}
+
+// Delete is the implementation of CacheStore for MapStore.
+func (s *MapStore) Delete(url URL) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.remove(url)
+}
+
+// remove drops the result stored for url. s.lock must be held.
+func (s *MapStore) remove(url URL) {
+	if entry, ok := s.results[url]; ok {
+		s.bytes -= entry.size(url)
+	}
+	delete(s.results, url)
+	if elem, ok := s.recentOf[url]; ok {
+		s.recent.Remove(elem)
+		delete(s.recentOf, url)
+	}
+}
+
+// Len is the implementation of CacheStore for MapStore.
+func (s *MapStore) Len() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.results)
+}
+
+// Range is the implementation of CacheRanger for MapStore, fn must not call the store.
+func (s *MapStore) Range(fn func(url URL, result *FetchResult) bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for url, entry := range s.results {
+		result, ok := entry.unpack()
+		if ok && !fn(url, result) {
+			return
+		}
+	}
+}
+
+// Bytes returns the size of the stored results, as compressed.
+func (s *MapStore) Bytes() int64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.bytes
+}
+
+// Evictions returns the number of results evicted to stay within MaxEntries and MaxBytes.
+func (s *MapStore) Evictions() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.evictions
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMapStoreSkipsResultsLargerThanMaxBytes(t *testing.T) {
+	s := &MapStore{MaxBytes: 1000}
+	for _, url := range []URL{"https://a/1", "https://a/2", "https://a/3"} {
+		s.Set(url, &FetchResult{body: "small"})
+	}
+	s.Set("https://a/large", &FetchResult{body: strings.Repeat("x", 5000)})
+	if got := s.Len(); got != 3 {
+		t.Errorf("Len() = %d, want 3", got)
+	}
+	if _, ok := s.Get("https://a/large"); ok {
+		t.Error("the large result was kept")
+	}
+	if got := s.Evictions(); got != 0 {
+		t.Errorf("Evictions() = %d, want 0", got)
+	}
+	// a result growing past MaxBytes replaces the one stored before
+	s.Set("https://a/1", &FetchResult{body: strings.Repeat("x", 5000)})
+	if _, ok := s.Get("https://a/1"); ok {
+		t.Error("the stale result of https://a/1 is still served")
+	}
+	if got, want := s.Bytes(), (&FetchResult{body: "small"}).size("https://a/2")*2; got != want {
+		t.Errorf("Bytes() = %d, want %d", got, want)
+	}
+}
+
+func TestMapStore(t *testing.T) {
+	testCacheStore(t, &MapStore{})
+}
+
+func TestMapStoreCompression(t *testing.T) {
+	testCacheStore(t, &MapStore{CompressAbove: 4})
+
+	body := strings.Repeat("<p>a compressible page</p>\n", 1000)
+	plain, compressed := &MapStore{}, &MapStore{CompressAbove: 1024}
+	for _, s := range []*MapStore{plain, compressed} {
+		s.Set("https://a/page", &FetchResult{body: body, urls: []string{"https://a/"}})
+		s.Set("https://a/small", &FetchResult{body: "small"})
+		if result, ok := s.Get("https://a/page"); !ok || result.body != body || len(result.urls) != 1 {
+			t.Errorf("CompressAbove %d: the page is not read back", s.CompressAbove)
+		}
+	}
+	if compressed.Bytes()*10 > plain.Bytes() {
+		t.Errorf("Bytes() = %d compressed, %d not compressed, want a tenth at most", compressed.Bytes(), plain.Bytes())
+	}
+}
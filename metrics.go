@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultLatencyBuckets are the upper bounds, in seconds, of the buckets of the fetch latency histograms of Metrics.
+var DefaultLatencyBuckets = []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Metrics collects the metrics of the crawls it is given to with WithMetrics, and serves them to Prometheus
+// in its text format as an http.Handler, such as on /metrics:
+//
+//	crawler_fetches_total{class}         the fetches by class: 2xx to 5xx, error when there was no response,
+//	                                     ok for the fetchers without status codes
+//	crawler_fetch_duration_seconds       a histogram of the time the fetches took
+//	crawler_frontier_urls                the urls waiting to be fetched
+//	crawler_fetches_in_flight            the fetches dispatched that did not finish yet
+//	crawler_cache_hits_total             the fetches served by a FetcherCache
+//	crawler_cache_misses_total           the other fetches
+//	crawler_downloaded_bytes_total       the size of the bodies not served from cache, as transferred
+//	crawler_host_fetches_total{host}     the fetches by host
+//	crawler_host_errors_total{host}      the failed fetches by host, for their error rates
+//	crawler_host_fetch_duration_seconds  a histogram of the time the fetches from every host took, by host,
+//	                                     without the fetches served from cache
+//
+// Pages fetched again by Monitor are counted too. A Metrics can be shared by several crawls, the gauges are those
+// of the last one to report them.
+type Metrics struct {
+	// Buckets are the upper bounds of the buckets of the latency histograms, DefaultLatencyBuckets when empty.
+	Buckets []float64
+
+	mu              sync.Mutex
+	fetches         map[string]uint64
+	latency         *histogram
+	frontier        int
+	inFlight        int
+	cacheHits       uint64
+	cacheMisses     uint64
+	bytesDownloaded int64
+	hostFetches     map[string]uint64
+	hostErrors      map[string]uint64
+	hostLatency     map[string]*histogram
+}
+
+// observe accounts for the fetch of page that took d.
+func (m *Metrics) observe(page PageResult, cacheHit bool, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.fetches == nil {
+		m.fetches = make(map[string]uint64)
+		m.latency = newHistogram(m.Buckets)
+		m.hostFetches = make(map[string]uint64)
+		m.hostErrors = make(map[string]uint64)
+		m.hostLatency = make(map[string]*histogram)
+	}
+	m.fetches[statusClass(page)]++
+	m.latency.observe(d.Seconds())
+	if cacheHit {
+		m.cacheHits++
+	} else {
+		m.cacheMisses++
+		m.bytesDownloaded += bodySize(page)
+	}
+	host := hostOf(page.URL)
+	m.hostFetches[host]++
+	if page.Err != nil {
+		m.hostErrors[host]++
+	}
+	if !cacheHit {
+		if m.hostLatency[host] == nil {
+			m.hostLatency[host] = newHistogram(m.Buckets)
+		}
+		m.hostLatency[host].observe(d.Seconds())
+	}
+}
+
+// setFrontier sets the gauges of the frontier and of the fetches in flight.
+func (m *Metrics) setFrontier(frontier, inFlight int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.frontier, m.inFlight = frontier, inFlight
+}
+
+// statusClass returns the class of the fetch of page for crawler_fetches_total.
+func statusClass(page PageResult) string {
+	switch {
+	case page.Meta.StatusCode >= 100:
+		return strconv.Itoa(page.Meta.StatusCode/100) + "xx"
+	case page.Err != nil:
+		return "error"
+	}
+	return "ok"
+}
+
+// ServeHTTP is the implementation of http.Handler for Metrics, it writes the metrics in the text format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// WriteTo writes the metrics to w in the Prometheus text format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	writeMetric(bw, "crawler_fetches_total", "counter", "Fetches by status class.")
+	writeCounts(bw, "crawler_fetches_total", "class", m.fetches)
+	writeMetric(bw, "crawler_fetch_duration_seconds", "histogram", "Time the fetches took.")
+	latency := m.latency
+	if latency == nil {
+		latency = newHistogram(m.Buckets)
+	}
+	latency.write(bw, "crawler_fetch_duration_seconds", "")
+	writeMetric(bw, "crawler_frontier_urls", "gauge", "Urls waiting to be fetched.")
+	fmt.Fprintf(bw, "crawler_frontier_urls %d\n", m.frontier)
+	writeMetric(bw, "crawler_fetches_in_flight", "gauge", "Fetches dispatched that did not finish yet.")
+	fmt.Fprintf(bw, "crawler_fetches_in_flight %d\n", m.inFlight)
+	writeMetric(bw, "crawler_cache_hits_total", "counter", "Fetches served by the cache.")
+	fmt.Fprintf(bw, "crawler_cache_hits_total %d\n", m.cacheHits)
+	writeMetric(bw, "crawler_cache_misses_total", "counter", "Fetches not served by the cache.")
+	fmt.Fprintf(bw, "crawler_cache_misses_total %d\n", m.cacheMisses)
+	writeMetric(bw, "crawler_downloaded_bytes_total", "counter", "Size of the bodies downloaded, as transferred.")
+	fmt.Fprintf(bw, "crawler_downloaded_bytes_total %d\n", m.bytesDownloaded)
+	writeMetric(bw, "crawler_host_fetches_total", "counter", "Fetches by host.")
+	writeCounts(bw, "crawler_host_fetches_total", "host", m.hostFetches)
+	writeMetric(bw, "crawler_host_errors_total", "counter", "Failed fetches by host.")
+	writeCounts(bw, "crawler_host_errors_total", "host", m.hostErrors)
+	writeMetric(bw, "crawler_host_fetch_duration_seconds", "histogram", "Time the fetches took by host, without the cache hits.")
+	hosts := make([]string, 0, len(m.hostLatency))
+	for host := range m.hostLatency {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		m.hostLatency[host].write(bw, "crawler_host_fetch_duration_seconds", "host="+labelValue(host))
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// writeMetric writes the HELP and TYPE lines of the metric name.
+func writeMetric(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// writeCounts writes a sample of the metric name per key of counts, labeled with label, in the order of the keys.
+func writeCounts(w io.Writer, name, label string, counts map[string]uint64) {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s{%s=%s} %d\n", name, label, labelValue(key), counts[key])
+	}
+}
+
+// labelValue returns s quoted as a label value of the text format.
+func labelValue(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// histogram is a cumulative histogram of the text format.
+type histogram struct {
+	buckets []float64
+	// counts are the numbers of values of every bucket, not cumulated
+	counts []uint64
+	count  uint64
+	sum    float64
+	// min and max are the smallest and the largest values, bounding the quantiles of the first and the last buckets
+	min, max float64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	return &histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *histogram) observe(v float64) {
+	h.count++
+	h.sum += v
+	if h.count == 1 || v < h.min {
+		h.min = v
+	}
+	if v > h.max {
+		h.max = v
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		h.counts[i]++
+	}
+}
+
+// quantile returns an estimate of the q quantile of the values, interpolated within their bucket
+// as Prometheus does, or 0 without values. The bounds of the buckets are narrowed to the smallest and the largest
+// values, so the estimate never falls outside of them.
+func (h *histogram) quantile(q float64) float64 {
+	if h.count == 0 {
+		return 0
+	}
+	rank := q * float64(h.count)
+	var cumulated uint64
+	for i, upper := range h.buckets {
+		if h.counts[i] == 0 || float64(cumulated+h.counts[i]) < rank {
+			cumulated += h.counts[i]
+			continue
+		}
+		lower := h.min
+		if i > 0 && h.buckets[i-1] > lower {
+			lower = h.buckets[i-1]
+		}
+		if upper > h.max {
+			upper = h.max
+		}
+		return lower + (upper-lower)*(rank-float64(cumulated))/float64(h.counts[i])
+	}
+	return h.max
+}
+
+// exponentialBuckets returns n bucket bounds, starting at start and each factor times the previous one.
+func exponentialBuckets(start, factor float64, n int) []float64 {
+	buckets := make([]float64, n)
+	for i := range buckets {
+		buckets[i] = start
+		start *= factor
+	}
+	return buckets
+}
+
+// write writes the samples of the histogram name, with labels, such as host="golang.org", when not empty.
+func (h *histogram) write(w io.Writer, name, labels string) {
+	sep := ""
+	if labels != "" {
+		sep = ","
+	}
+	var cumulated uint64
+	for i, le := range h.buckets {
+		cumulated += h.counts[i]
+		fmt.Fprintf(w, "%s_bucket{%s%sle=\"%s\"} %d\n", name, labels, sep, strconv.FormatFloat(le, 'g', -1, 64), cumulated)
+	}
+	fmt.Fprintf(w, "%s_bucket{%s%sle=\"+Inf\"} %d\n", name, labels, sep, h.count)
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(w, "%s_sum%s %s\n%s_count%s %d\n", name, labels, strconv.FormatFloat(h.sum, 'g', -1, 64), name, labels, h.count)
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
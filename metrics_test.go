@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// observedMetrics returns a Metrics with a few fetches of two hosts, whose durations are exact in binary.
+func observedMetrics() *Metrics {
+	m := &Metrics{Buckets: []float64{0.1, 1}}
+	m.observe(PageResult{URL: "https://a.example/", Body: "abc", Meta: FetchMeta{StatusCode: 200}}, false, 125*time.Millisecond)
+	m.observe(PageResult{URL: "https://a.example/missing", Body: "not found", Err: ErrNotFound, Meta: FetchMeta{StatusCode: 404}},
+		false, 500*time.Millisecond)
+	m.observe(PageResult{URL: "https://b.example/", Err: errors.New("connection refused")}, false, 2*time.Second)
+	m.observe(PageResult{URL: "https://a.example/cached", Body: "cached"}, true, 62500*time.Microsecond)
+	m.setFrontier(3, 1)
+	return m
+}
+
+// metricsSample matches a sample line of the text format.
+var metricsSample = regexp.MustCompile(`^([a-z_]+)(\{[a-z]+="[^"]*"(,[a-z]+="[^"]*")*\})? [0-9.e+-]+$`)
+
+// checkMetricsFormat checks every sample of out follows the HELP and TYPE lines of its metric.
+func checkMetricsFormat(t *testing.T, out string) {
+	t.Helper()
+	typed := ""
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\n"), "\n") {
+		if name, ok := strings.CutPrefix(line, "# TYPE "); ok {
+			typed, _, _ = strings.Cut(name, " ")
+			continue
+		}
+		if strings.HasPrefix(line, "# HELP ") {
+			continue
+		}
+		m := metricsSample.FindStringSubmatch(line)
+		if m == nil {
+			t.Errorf("malformed sample %q", line)
+			continue
+		}
+		if name := m[1]; name != typed && strings.TrimSuffix(strings.TrimSuffix(strings.TrimSuffix(name, "_bucket"), "_sum"), "_count") != typed {
+			t.Errorf("sample %q not of the metric %s", line, typed)
+		}
+	}
+}
+
+func TestMetricsFormat(t *testing.T) {
+	var b strings.Builder
+	n, err := observedMetrics().WriteTo(&b)
+	out := b.String()
+	if err != nil || n != int64(len(out)) {
+		t.Errorf("WriteTo = %d, %v, want %d", n, err, len(out))
+	}
+	checkMetricsFormat(t, out)
+	want := `# HELP crawler_fetches_total Fetches by status class.
+# TYPE crawler_fetches_total counter
+crawler_fetches_total{class="2xx"} 1
+crawler_fetches_total{class="4xx"} 1
+crawler_fetches_total{class="error"} 1
+crawler_fetches_total{class="ok"} 1
+# HELP crawler_fetch_duration_seconds Time the fetches took.
+# TYPE crawler_fetch_duration_seconds histogram
+crawler_fetch_duration_seconds_bucket{le="0.1"} 1
+crawler_fetch_duration_seconds_bucket{le="1"} 3
+crawler_fetch_duration_seconds_bucket{le="+Inf"} 4
+crawler_fetch_duration_seconds_sum 2.6875
+crawler_fetch_duration_seconds_count 4
+# HELP crawler_frontier_urls Urls waiting to be fetched.
+# TYPE crawler_frontier_urls gauge
+crawler_frontier_urls 3
+# HELP crawler_fetches_in_flight Fetches dispatched that did not finish yet.
+# TYPE crawler_fetches_in_flight gauge
+crawler_fetches_in_flight 1
+# HELP crawler_cache_hits_total Fetches served by the cache.
+# TYPE crawler_cache_hits_total counter
+crawler_cache_hits_total 1
+# HELP crawler_cache_misses_total Fetches not served by the cache.
+# TYPE crawler_cache_misses_total counter
+crawler_cache_misses_total 3
+# HELP crawler_downloaded_bytes_total Size of the bodies downloaded, as transferred.
+# TYPE crawler_downloaded_bytes_total counter
+crawler_downloaded_bytes_total 12
+`
+	if !strings.HasPrefix(out, want) {
+		t.Errorf("metrics =\n%s\nwant them to start with\n%s", out, want)
+	}
+}
+
+func TestMetricsEmpty(t *testing.T) {
+	var b strings.Builder
+	(&Metrics{}).WriteTo(&b)
+	checkMetricsFormat(t, b.String())
+	if !strings.Contains(b.String(), `crawler_fetch_duration_seconds_bucket{le="+Inf"} 0`+"\n") {
+		t.Errorf("metrics without fetches =\n%s\nwant an empty histogram", b.String())
+	}
+}
+
+func TestMetricsServeHTTP(t *testing.T) {
+	rec := httptest.NewRecorder()
+	observedMetrics().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q, want the text format", ct)
+	}
+	if !strings.Contains(rec.Body.String(), "crawler_cache_hits_total 1\n") {
+		t.Errorf("body =\n%s", rec.Body.String())
+	}
+}
+
+func TestCrawlMetrics(t *testing.T) {
+	m := &Metrics{}
+	NewCrawler(fetcher, WithMetrics(m)).Crawl(context.Background(), "https://golang.org/")
+	var b strings.Builder
+	m.WriteTo(&b)
+	// the fake fetcher has no status codes, the missing page is an error
+	for _, want := range []string{
+		`crawler_fetches_total{class="error"} 1` + "\n",
+		fmt.Sprintf(`crawler_fetches_total{class="ok"} %d`+"\n", len(fetcher)),
+		"crawler_frontier_urls 0\n",
+		"crawler_fetches_in_flight 0\n",
+		fmt.Sprintf("crawler_cache_misses_total %d\n", len(fetcher)+1),
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("metrics =\n%s\nwant %q", b.String(), want)
+		}
+	}
+}
+
+func TestMetricsHosts(t *testing.T) {
+	var b strings.Builder
+	observedMetrics().WriteTo(&b)
+	// the fetch served from cache counts as a fetch of a.example, without its duration
+	want := `# HELP crawler_host_fetches_total Fetches by host.
+# TYPE crawler_host_fetches_total counter
+crawler_host_fetches_total{host="a.example"} 3
+crawler_host_fetches_total{host="b.example"} 1
+# HELP crawler_host_errors_total Failed fetches by host.
+# TYPE crawler_host_errors_total counter
+crawler_host_errors_total{host="a.example"} 1
+crawler_host_errors_total{host="b.example"} 1
+# HELP crawler_host_fetch_duration_seconds Time the fetches took by host, without the cache hits.
+# TYPE crawler_host_fetch_duration_seconds histogram
+crawler_host_fetch_duration_seconds_bucket{host="a.example",le="0.1"} 0
+crawler_host_fetch_duration_seconds_bucket{host="a.example",le="1"} 2
+crawler_host_fetch_duration_seconds_bucket{host="a.example",le="+Inf"} 2
+crawler_host_fetch_duration_seconds_sum{host="a.example"} 0.625
+crawler_host_fetch_duration_seconds_count{host="a.example"} 2
+crawler_host_fetch_duration_seconds_bucket{host="b.example",le="0.1"} 0
+crawler_host_fetch_duration_seconds_bucket{host="b.example",le="1"} 0
+crawler_host_fetch_duration_seconds_bucket{host="b.example",le="+Inf"} 1
+crawler_host_fetch_duration_seconds_sum{host="b.example"} 2
+crawler_host_fetch_duration_seconds_count{host="b.example"} 1
+`
+	if !strings.HasSuffix(b.String(), want) {
+		t.Errorf("metrics =\n%s\nwant them to end with\n%s", b.String(), want)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// FetchMiddleware wraps a Fetcher with extra behavior, such as rate limiting, logging, auth injection or metrics.
+type FetchMiddleware func(next Fetcher) Fetcher
+
+// FetcherFunc adapts a function to a ContextFetcher, which makes middlewares easy to write.
+type FetcherFunc func(ctx context.Context, url string) (body string, urls []string, err error)
+
+// Fetch is the implementation of Fetcher for FetcherFunc.
+func (f FetcherFunc) Fetch(url string) (body string, urls []string, err error) {
+	return f(context.Background(), url)
+}
+
+// FetchContext is the implementation of ContextFetcher for FetcherFunc.
+func (f FetcherFunc) FetchContext(ctx context.Context, url string) (body string, urls []string, err error) {
+	return f(ctx, url)
+}
+
+// Chain wraps fetcher with middlewares, the first middleware is the outermost one.
+func Chain(fetcher Fetcher, middlewares ...FetchMiddleware) Fetcher {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		fetcher = middlewares[i](fetcher)
+	}
+	return fetcher
+}
+
+// LoggingMiddleware logs every fetch with its duration and error to logger, the failures at warn level and
+// the others at debug level, with the fetcher component.
+func LoggingMiddleware(logger *slog.Logger) FetchMiddleware {
+	logger = componentLogger(logger, "fetcher")
+	return func(next Fetcher) Fetcher {
+		return FetcherFunc(func(ctx context.Context, url string) (string, []string, error) {
+			start := time.Now()
+			body, urls, err := fetchContext(ctx, next, url)
+			if err != nil {
+				logger.Warn("fetch failed", "url", url, "duration", time.Since(start), "err", err)
+			} else {
+				logger.Debug("fetched", "url", url, "links", len(urls), "duration", time.Since(start))
+			}
+			return body, urls, err
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"html"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// MirrorSink saves the pages crawled without error to a directory tree in Dir, as wget --mirror does, a directory
+// per host and a file per url, such as golang.org/pkg/index.html for https://golang.org/pkg/. When closed, it
+// rewrites the links of the saved HTML pages to relative paths to the files of the pages they link to, and to
+// absolute urls otherwise, so the copy can be browsed offline.
+// Pages are saved as kept by WithBodyLimit, which should not be used with a MirrorSink.
+type MirrorSink struct {
+	// Dir is the directory the pages are saved to, the current directory when empty.
+	Dir string
+
+	// files are the files of the saved pages, slash separated paths relative to Dir, by url
+	files map[URL]string
+	// pages are the urls of the saved HTML pages, in the order they were saved
+	pages []URL
+}
+
+// Write is the implementation of Sink for MirrorSink, it saves the page.
+func (s *MirrorSink) Write(page PageResult) error {
+	if page.Err != nil || s.files[page.URL] != "" {
+		return nil
+	}
+	isPage := isHTML(page.Meta.Header.Get("Content-Type"))
+	name, ok := mirrorPath(page.URL, isPage)
+	// the file must stay within Dir whatever the url
+	if !ok || !filepath.IsLocal(filepath.FromSlash(name)) {
+		return nil
+	}
+	file := filepath.Join(s.Dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(file, []byte(page.Body), 0o644); err != nil {
+		return err
+	}
+	if s.files == nil {
+		s.files = make(map[URL]string)
+	}
+	s.files[page.URL] = name
+	// the links to the urls redirecting to the page lead to its file as well
+	for _, redirect := range page.Meta.Redirects {
+		if s.files[redirect] == "" {
+			s.files[redirect] = name
+		}
+	}
+	if isPage {
+		s.pages = append(s.pages, page.URL)
+	}
+	return nil
+}
+
+// Close is the implementation of Sink for MirrorSink, it rewrites the links of the saved HTML pages.
+func (s *MirrorSink) Close() error {
+	for _, pageURL := range s.pages {
+		file := filepath.Join(s.Dir, filepath.FromSlash(s.files[pageURL]))
+		body, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		rewritten := s.rewriteLinks(pageURL, string(body))
+		if rewritten == string(body) {
+			continue
+		}
+		err = writeAtomic(file, func(w io.Writer) error {
+			_, err := io.WriteString(w, rewritten)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var (
+	// mirrorTag matches the start tags of an HTML document
+	mirrorTag = regexp.MustCompile(`<[a-zA-Z][^>]*>`)
+	// mirrorLinkAttr matches the attributes of a tag holding a link, and their value
+	mirrorLinkAttr = regexp.MustCompile(`(?i)(\s(?:href|src)\s*=\s*)("[^"]*"|'[^']*'|[^\s"'>]+)`)
+)
+
+// rewriteLinks returns body, the HTML page of pageURL, with its href and src links rewritten to the saved files.
+func (s *MirrorSink) rewriteLinks(pageURL URL, body string) string {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return body
+	}
+	from := path.Dir(s.files[pageURL])
+	return mirrorTag.ReplaceAllStringFunc(body, func(tag string) string {
+		return mirrorLinkAttr.ReplaceAllStringFunc(tag, func(attr string) string {
+			m := mirrorLinkAttr.FindStringSubmatch(attr)
+			value, quote := m[2], ""
+			if strings.HasPrefix(value, `"`) || strings.HasPrefix(value, "'") {
+				value, quote = value[1:len(value)-1], value[:1]
+			}
+			link, ok := s.rewriteLink(base, from, html.UnescapeString(value))
+			if !ok {
+				return attr
+			}
+			if quote == "" {
+				quote = `"`
+			}
+			return m[1] + quote + html.EscapeString(link) + quote
+		})
+	})
+}
+
+// rewriteLink returns the path of the file of the link href of the page at base, relative to the directory from,
+// or the absolute url of the links to urls that were not saved. It reports false for the links left as they are.
+func (s *MirrorSink) rewriteLink(base *url.URL, from, href string) (string, bool) {
+	ref, err := url.Parse(cleanHref(href))
+	if err != nil || href == "" || strings.HasPrefix(href, "#") {
+		return "", false
+	}
+	link := base.ResolveReference(ref)
+	if link.Scheme != "http" && link.Scheme != "https" {
+		return "", false
+	}
+	fragment := link.EscapedFragment()
+	link.Fragment, link.RawFragment = "", ""
+	name := s.files[link.String()]
+	if name == "" {
+		name = s.files[(&Normalizer{}).Normalize(link.String())]
+	}
+	if name == "" {
+		if ref.IsAbs() {
+			return "", false
+		}
+		if fragment != "" {
+			return link.String() + "#" + fragment, true
+		}
+		return link.String(), true
+	}
+	rel, err := filepath.Rel(filepath.FromSlash(from), filepath.FromSlash(name))
+	if err != nil {
+		return "", false
+	}
+	// a path with a colon in its first segment is not taken for a scheme
+	relative := (&url.URL{Path: filepath.ToSlash(rel)}).String()
+	if fragment != "" {
+		relative += "#" + fragment
+	}
+	return relative, true
+}
+
+// mirrorPath returns the slash separated path of the file of rawURL in a MirrorSink, under the directory of its
+// host, reporting false for the urls that are not http ones, and for those whose host is not a directory name,
+// such as http://../etc/passwd. Paths ending with a slash are saved as index.html,
+// the query is appended after an @, and HTML pages are given an .html extension when they have another one.
+func mirrorPath(rawURL URL, isPage bool) (string, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return "", false
+	}
+	name := u.Path
+	if name == "" || strings.HasSuffix(name, "/") {
+		name += "index.html"
+	}
+	if u.RawQuery != "" {
+		name += "@" + strings.ReplaceAll(u.RawQuery, "/", "%2F")
+	}
+	// cleaning the rooted path keeps it inside the directory of the host
+	name = path.Clean("/" + name)
+	if ext := strings.ToLower(path.Ext(name)); isPage && ext != ".html" && ext != ".htm" {
+		name += ".html"
+	}
+	host := strings.ReplaceAll(ToASCIIHost(u.Host), ":", "_")
+	if host == "" || host == "." || host == ".." || strings.ContainsAny(host, `/\`) {
+		return "", false
+	}
+	return host + name, true
+}
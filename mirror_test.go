@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func htmlPage(url URL, body string) PageResult {
+	return PageResult{URL: url, Body: body, Meta: FetchMeta{Header: http.Header{"Content-Type": {"text/html"}}}}
+}
+
+func TestMirrorPath(t *testing.T) {
+	tests := []struct {
+		url    URL
+		isPage bool
+		name   string
+	}{
+		{"https://golang.org/", true, "golang.org/index.html"},
+		{"https://golang.org/pkg/", true, "golang.org/pkg/index.html"},
+		{"https://golang.org/doc/go1.21", true, "golang.org/doc/go1.21.html"},
+		{"https://golang.org/lib/godoc/style.css", false, "golang.org/lib/godoc/style.css"},
+		{"https://golang.org/search?q=a/b", true, "golang.org/search@q=a%2Fb.html"},
+		{"http://localhost:8080/x.html", true, "localhost_8080/x.html"},
+		{"http://golang.org/../../etc/passwd", false, "golang.org/etc/passwd"},
+		{"http://../etc/passwd", false, ""},
+		{"http://%2e%2e/etc/passwd", false, ""},
+		{"http://./etc/passwd", false, ""},
+		{"ftp://golang.org/x", false, ""},
+	}
+	for _, test := range tests {
+		name, ok := mirrorPath(test.url, test.isPage)
+		if name != test.name || ok != (test.name != "") {
+			t.Errorf("mirrorPath(%q) = %q, %t, want %q", test.url, name, ok, test.name)
+		}
+	}
+}
+
+func TestMirrorSinkStaysInDir(t *testing.T) {
+	root := t.TempDir()
+	s := &MirrorSink{Dir: filepath.Join(root, "mirror")}
+	for _, url := range []URL{"http://../escaped", "http://%2e%2e/escaped", "http://golang.org/../../escaped"} {
+		if err := s.Write(htmlPage(url, "escaped")); err != nil {
+			t.Errorf("Write(%q): %v", url, err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	filepath.WalkDir(root, func(path string, entry os.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() && !strings.HasPrefix(path, s.Dir+string(filepath.Separator)) {
+			t.Errorf("%s written outside of the mirror", path)
+		}
+		return nil
+	})
+}
+
+func TestMirrorSinkRewritesLinks(t *testing.T) {
+	s := &MirrorSink{Dir: t.TempDir()}
+	s.Write(htmlPage("https://golang.org/", `<a href="/pkg/">pkg</a> <a href='https://golang.org/pkg/fmt/#Println'>fmt</a>`+
+		` <a href="/missing">missing</a> <a href="https://other.example/">other</a> <a href="#top">top</a>`))
+	s.Write(htmlPage("https://golang.org/pkg/", `<a href="../">home</a> <a href=fmt/>fmt</a>`))
+	s.Write(htmlPage("https://golang.org/pkg/fmt/", `<a href="/">home</a>`))
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name, body string
+	}{
+		{"golang.org/index.html", `<a href="pkg/index.html">pkg</a> <a href='pkg/fmt/index.html#Println'>fmt</a>` +
+			` <a href="https://golang.org/missing">missing</a> <a href="https://other.example/">other</a> <a href="#top">top</a>`},
+		{"golang.org/pkg/index.html", `<a href="../index.html">home</a> <a href="fmt/index.html">fmt</a>`},
+		{"golang.org/pkg/fmt/index.html", `<a href="../../index.html">home</a>`},
+	}
+	for _, test := range tests {
+		body, err := os.ReadFile(filepath.Join(s.Dir, filepath.FromSlash(test.name)))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if string(body) != test.body {
+			t.Errorf("%s = %s, want %s", test.name, body, test.body)
+		}
+	}
+}
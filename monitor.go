@@ -0,0 +1,173 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"time"
+)
+
+// DefaultRecrawlInterval is how often Monitor fetches a page again when no interval is configured.
+const DefaultRecrawlInterval = time.Hour
+
+// RecrawlRule sets the recrawl interval of the urls matching Pattern.
+type RecrawlRule struct {
+	Pattern  *regexp.Regexp
+	Interval time.Duration
+}
+
+// Change is reported by Monitor when a page fetched again differs from the previous fetch.
+type Change struct {
+	// Page is the page as fetched now.
+	Page PageResult
+	// PreviousHash and Hash are the hex encoded sha256 of the previous and current bodies.
+	PreviousHash, Hash string
+	// PreviousErr is the error of the previous fetch, if any.
+	PreviousErr error
+}
+
+// Monitor crawls pages starting with the seeds like Crawl, then keeps fetching the crawled pages again on their
+// recrawl interval and calls onChange whenever a body or the failure of a page changes.
+// Only the pages found by the initial crawl are monitored. Monitor runs until ctx is done and returns its error.
+func (c *Crawler) Monitor(ctx context.Context, seeds []URL, onChange func(Change)) error {
+	m := &monitor{c: c, onChange: onChange, pages: make(map[URL]*monitoredPage)}
+	it := c.Run(ctx, seeds...)
+	now := time.Now()
+	for page, ok := it.Next(); ok; page, ok = it.Next() {
+		m.track(page, now)
+	}
+	it.Result()
+	return m.loop(ctx)
+}
+
+type monitor struct {
+	c        *Crawler
+	onChange func(Change)
+	pages    map[URL]*monitoredPage
+	due      dueHeap
+}
+
+type monitoredPage struct {
+	page PageResult
+	hash string
+	due  time.Time
+}
+
+// track records the first fetch of page and schedules it.
+func (m *monitor) track(page PageResult, now time.Time) {
+	p := &monitoredPage{page: page, hash: bodyHash(page.Body), due: now.Add(m.interval(page.URL))}
+	m.pages[page.URL] = p
+	heap.Push(&m.due, p)
+}
+
+// interval returns the recrawl interval for url, from the first matching rule.
+func (m *monitor) interval(url URL) time.Duration {
+	for _, rule := range m.c.recrawlRules {
+		if rule.Pattern.MatchString(url) {
+			return rule.Interval
+		}
+	}
+	if m.c.recrawlInterval > 0 {
+		return m.c.recrawlInterval
+	}
+	return DefaultRecrawlInterval
+}
+
+// loop fetches due pages again, at most concurrency at once, until ctx is done.
+func (m *monitor) loop(ctx context.Context) error {
+	fetched := make(chan PageResult)
+	running := 0
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		// dispatch every due page there is a free worker for
+		now := time.Now()
+		for running < m.c.concurrency && m.due.Len() > 0 && !m.due[0].due.After(now) {
+			p := heap.Pop(&m.due).(*monitoredPage)
+			running++
+			go func(page PageResult) {
+				fetchCtx := ctx
+				if m.c.fetchTimeout > 0 {
+					var cancel context.CancelFunc
+					fetchCtx, cancel = context.WithTimeout(ctx, m.c.fetchTimeout)
+					defer cancel()
+				}
+				fetchCtx, trace := withFetchTrace(fetchCtx)
+				start := time.Now()
+				body, urls, err := fetchContext(fetchCtx, m.c.fetcher, page.URL)
+				page.Body, page.Links, page.Err = body, urls, err
+				page.Meta = trace.meta
+				if m.c.metrics != nil && !isContextError(err) {
+					m.c.metrics.observe(page, trace.cacheHit, time.Since(start))
+				}
+				select {
+				case fetched <- page:
+				case <-ctx.Done():
+				}
+			}(p.page)
+		}
+		var wake <-chan time.Time
+		if running < m.c.concurrency && m.due.Len() > 0 {
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(time.Until(m.due[0].due))
+			wake = timer.C
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case page := <-fetched:
+			running--
+			m.update(page, time.Now())
+		case <-wake:
+		}
+	}
+}
+
+// update compares a page fetched again with the previous fetch, and schedules it again.
+func (m *monitor) update(page PageResult, now time.Time) {
+	if isContextError(page.Err) {
+		return
+	}
+	p := m.pages[page.URL]
+	hash := bodyHash(page.Body)
+	if hash != p.hash || (page.Err == nil) != (p.page.Err == nil) {
+		change := Change{Page: page, PreviousHash: p.hash, Hash: hash, PreviousErr: p.page.Err}
+		if m.onChange != nil {
+			m.onChange(change)
+		}
+	}
+	p.page, p.hash = page, hash
+	p.due = now.Add(m.interval(page.URL))
+	heap.Push(&m.due, p)
+}
+
+// bodyHash returns the hex encoded sha256 of body.
+func bodyHash(body string) string {
+	sum := sha256.Sum256([]byte(body))
+	return hex.EncodeToString(sum[:])
+}
+
+// dueHeap orders monitored pages by the time they are due.
+type dueHeap []*monitoredPage
+
+func (h dueHeap) Len() int { return len(h) }
+
+func (h dueHeap) Less(i, j int) bool { return h[i].due.Before(h[j].due) }
+
+func (h dueHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *dueHeap) Push(x interface{}) { *h = append(*h, x.(*monitoredPage)) }
+
+func (h *dueHeap) Pop() interface{} {
+	old := *h
+	p := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return p
+}
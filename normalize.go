@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// TrailingSlash is the policy of a Normalizer for the trailing slashes of paths.
+type TrailingSlash int
+
+const (
+	// KeepTrailingSlash leaves paths as they are, /pkg and /pkg/ being different pages.
+	KeepTrailingSlash TrailingSlash = iota
+	// AddTrailingSlash adds a slash to the paths whose last segment has no extension, /pkg becoming /pkg/.
+	AddTrailingSlash
+	// StripTrailingSlash removes the trailing slash of paths other than /, /pkg/ becoming /pkg.
+	StripTrailingSlash
+)
+
+// ParseTrailingSlash returns the TrailingSlash named keep, add or strip.
+func ParseTrailingSlash(name string) (TrailingSlash, error) {
+	switch name {
+	case "keep":
+		return KeepTrailingSlash, nil
+	case "add":
+		return AddTrailingSlash, nil
+	case "strip":
+		return StripTrailingSlash, nil
+	}
+	return 0, fmt.Errorf("unknown trailing slash policy %q", name)
+}
+
+// defaultPorts are the ports dropped by a Normalizer, by scheme.
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+	"ftp":   "21",
+}
+
+// TrackingParams are the query parameters of common analytics and session tracking, for Normalizer.StripParams.
+var TrackingParams = []string{
+	"utm_*", "gclid", "dclid", "fbclid", "msclkid", "yclid", "igshid", "mc_cid", "mc_eid", "_ga", "_hsenc", "_hsmi",
+	"sessionid", "sid", "jsessionid", "phpsessid", "aspsessionid",
+}
+
+// Normalizer rewrites urls to a canonical form, so the different spellings of a page are crawled and cached once.
+// It lowercases the scheme and the host, gives internationalized hosts their ASCII form, drops the default port,
+// an empty query and the fragment, resolves the dot segments of the path and gives an empty path a slash,
+// before applying TrailingSlash, StripParams and SortQuery.
+type Normalizer struct {
+	TrailingSlash TrailingSlash
+	// StripParams are the names of the query parameters dropped from the urls, such as TrackingParams.
+	// Names are matched regardless of case, a name ending with * matches the parameters it is a prefix of.
+	StripParams []string
+	// SortQuery sorts the query parameters by name, keeping the order of the values of a parameter.
+	SortQuery bool
+	// KeepRouteFragments keeps the fragments routing single page apps, #!/route and #/route ones,
+	// so their routes are crawled as pages of their own with a RenderingFetcher.
+	KeepRouteFragments bool
+}
+
+// Normalize returns the canonical form of rawURL, or rawURL itself when it is not an absolute url.
+func (n *Normalizer) Normalize(rawURL URL) URL {
+	u, err := url.Parse(rawURL)
+	if err != nil || !u.IsAbs() || u.Opaque != "" {
+		return rawURL
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = ToASCIIHost(u.Host)
+	if port := u.Port(); port != "" && defaultPorts[u.Scheme] == port {
+		u.Host = strings.TrimSuffix(u.Host, ":"+port)
+	}
+	if !n.KeepRouteFragments || !isRouteFragment(u.Fragment) {
+		u.Fragment = ""
+		u.RawFragment = ""
+	}
+	// an empty query is no query
+	u.ForceQuery = false
+	// the path is normalized escaped, so escaped slashes are not taken for separators
+	path := removeDotSegments(u.EscapedPath())
+	if path == "" && u.Host != "" {
+		path = "/"
+	}
+	switch n.TrailingSlash {
+	case AddTrailingSlash:
+		last := path[strings.LastIndexByte(path, '/')+1:]
+		if last != "" && !strings.Contains(last, ".") {
+			path += "/"
+		}
+	case StripTrailingSlash:
+		if len(path) > 1 {
+			path = strings.TrimSuffix(path, "/")
+		}
+	}
+	if unescaped, err := url.PathUnescape(path); err == nil {
+		u.Path, u.RawPath = unescaped, path
+	}
+	if u.RawQuery != "" && (len(n.StripParams) > 0 || n.SortQuery) {
+		u.RawQuery = n.canonicalQuery(u.RawQuery)
+	}
+	return u.String()
+}
+
+// canonicalQuery returns query without the parameters of StripParams, and sorted with SortQuery.
+// The parameters keep their escapes.
+func (n *Normalizer) canonicalQuery(query string) string {
+	var params []string
+	for _, param := range strings.Split(query, "&") {
+		if param != "" && !n.strips(param) {
+			params = append(params, param)
+		}
+	}
+	if n.SortQuery {
+		sort.SliceStable(params, func(i, j int) bool {
+			return queryName(params[i]) < queryName(params[j])
+		})
+	}
+	return strings.Join(params, "&")
+}
+
+// strips reports whether the query parameter param is among StripParams.
+func (n *Normalizer) strips(param string) bool {
+	name := strings.ToLower(queryName(param))
+	for _, strip := range n.StripParams {
+		strip = strings.ToLower(strip)
+		if prefix := strings.TrimSuffix(strip, "*"); prefix != strip {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == strip {
+			return true
+		}
+	}
+	return false
+}
+
+// queryName returns the unescaped name of the query parameter param.
+func queryName(param string) string {
+	name := param
+	if i := strings.IndexByte(param, '='); i >= 0 {
+		name = param[:i]
+	}
+	if unescaped, err := url.QueryUnescape(name); err == nil {
+		return unescaped
+	}
+	return name
+}
+
+// normalize returns rawURL normalized by the normalizer of the crawler.
+func (c *Crawler) normalize(rawURL URL) URL {
+	if c.normalizer == nil {
+		return rawURL
+	}
+	return c.normalizer.Normalize(rawURL)
+}
+
+// normalizeLinks returns the links normalized by the normalizer of the crawler, dropping the links
+// that became duplicates of earlier ones.
+func (c *Crawler) normalizeLinks(links []URL) []URL {
+	if c.normalizer == nil || len(links) == 0 {
+		return links
+	}
+	normalized := make([]URL, 0, len(links))
+	seen := make(map[URL]bool, len(links))
+	for _, link := range links {
+		link = c.normalizer.Normalize(link)
+		if !seen[link] {
+			seen[link] = true
+			normalized = append(normalized, link)
+		}
+	}
+	return normalized
+}
+
+// isRouteFragment reports whether fragment routes a single page app, such as !/docs or /docs,
+// rather than pointing into a page.
+func isRouteFragment(fragment string) bool {
+	return strings.HasPrefix(fragment, "!") || strings.HasPrefix(fragment, "/")
+}
+
+// removeDotSegments resolves the . and .. segments of path as RFC 3986 does, keeping its trailing slash.
+func removeDotSegments(path string) string {
+	if !strings.Contains(path, ".") {
+		return path
+	}
+	var out []string
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		switch segment {
+		case ".":
+			if last {
+				out = append(out, "")
+			}
+		case "..":
+			if len(out) > 1 {
+				out = out[:len(out)-1]
+			}
+			if last {
+				out = append(out, "")
+			}
+		default:
+			out = append(out, segment)
+		}
+	}
+	return strings.Join(out, "/")
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultDepth is the crawl depth used when WithDepth is not given.
+	DefaultDepth = 4
+	// DefaultConcurrency is the number of workers used when WithConcurrency is not given.
+	DefaultConcurrency = 8
+)
+
+// Option configures a Crawler.
+type Option func(*Crawler)
+
+// WithDepth sets the maximum crawl depth, pages more than depth-1 links away from the seed are not fetched.
+func WithDepth(depth int) Option {
+	return func(c *Crawler) {
+		c.depth = depth
+	}
+}
+
+// WithPathDepth sets the maximum crawl depth of the urls under prefix, instead of that of WithDepth,
+// such as crawling deeper under /docs than under /blog. A prefix starting with / is matched against the path
+// of the urls, others against the whole url. It can be given several times, the longest matching prefix wins.
+func WithPathDepth(prefix string, depth int) Option {
+	return func(c *Crawler) {
+		c.pathDepths = append(c.pathDepths, pathDepth{prefix: prefix, depth: depth})
+	}
+}
+
+// WithConcurrency sets the number of workers fetching in parallel.
+// Values below one are ignored.
+func WithConcurrency(n int) Option {
+	return func(c *Crawler) {
+		if n > 0 {
+			c.concurrency = n
+		}
+	}
+}
+
+// WithQueueSize sets the capacity of the channel feeding the workers, the concurrency by default.
+// The dispatcher blocks once it is full, which keeps the workers from being handed more than they can take.
+func WithQueueSize(n int) Option {
+	return func(c *Crawler) {
+		c.queueSize = n
+	}
+}
+
+// WithVisitedSet sets the VisitedSet deduplicating enqueued urls.
+// By default every crawl uses a fresh MapVisitedSet, sharing a set lets several crawls skip each other's urls.
+func WithVisitedSet(visited VisitedSet) Option {
+	return func(c *Crawler) {
+		c.visited = visited
+	}
+}
+
+// WithStrategy sets the order the default Scheduler hands out pages in, BreadthFirst by default.
+// With more than one worker the order is only approximate, since fetches finish out of order.
+func WithStrategy(strategy Strategy) Option {
+	return func(c *Crawler) {
+		c.strategy = strategy
+	}
+}
+
+// WithMaxPages stops the crawl from fetching more than n pages, the crawl is unbounded when n is not positive.
+func WithMaxPages(n int) Option {
+	return func(c *Crawler) {
+		c.maxPages = n
+	}
+}
+
+// WithPriority fetches urls in order of their score with a PriorityScheduler instead of by strategy,
+// which lets the most important pages be fetched first when a page budget is in effect.
+func WithPriority(score ScoreFunc) Option {
+	return func(c *Crawler) {
+		c.score = score
+	}
+}
+
+// WithGracePeriod lets the fetches in flight finish for up to d once the crawl context is done,
+// instead of cancelling them along with the crawl. Fetches still running after d are abandoned.
+func WithGracePeriod(d time.Duration) Option {
+	return func(c *Crawler) {
+		c.gracePeriod = d
+	}
+}
+
+// WithCheckpoint periodically saves the crawl state to path, every interval and once more when the crawl ends,
+// so an interrupted crawl can be resumed with WithResume. Only the final checkpoint is written when interval is not positive.
+func WithCheckpoint(path string, interval time.Duration) Option {
+	return func(c *Crawler) {
+		c.checkpointPath = path
+		c.checkpointInterval = interval
+	}
+}
+
+// WithResume continues the crawl saved in cp instead of starting over.
+func WithResume(cp *Checkpoint) Option {
+	return func(c *Crawler) {
+		c.resume = cp
+	}
+}
+
+// WithMiddleware wraps the fetcher with middlewares, in the order given to Chain.
+// It can be given several times, later middlewares are nested inside earlier ones.
+func WithMiddleware(middlewares ...FetchMiddleware) Option {
+	return func(c *Crawler) {
+		c.middlewares = append(c.middlewares, middlewares...)
+	}
+}
+
+// WithScheduler replaces the frontier with scheduler, which overrides WithStrategy and WithPriority.
+// A Scheduler holds the frontier of a single crawl, so the Crawler must not run several crawls at once.
+func WithScheduler(scheduler Scheduler) Option {
+	return func(c *Crawler) {
+		c.scheduler = scheduler
+	}
+}
+
+// WithFetchTimeout abandons fetches taking longer than d, which fail with context.DeadlineExceeded.
+// Fetchers not implementing ContextFetcher are left to finish in the background, the worker moves on.
+func WithFetchTimeout(d time.Duration) Option {
+	return func(c *Crawler) {
+		c.fetchTimeout = d
+	}
+}
+
+// WithCrawlDeadline stops the crawl at t, returning whatever was collected so far with StopDeadline.
+func WithCrawlDeadline(t time.Time) Option {
+	return func(c *Crawler) {
+		c.crawlDeadline = t
+	}
+}
+
+// WithRecrawlInterval sets how often Monitor fetches a page again, DefaultRecrawlInterval by default.
+func WithRecrawlInterval(d time.Duration) Option {
+	return func(c *Crawler) {
+		c.recrawlInterval = d
+	}
+}
+
+// WithRecrawlRule makes Monitor fetch the urls matching pattern again every interval.
+// Rules are matched in the order they are given, before falling back to the recrawl interval.
+func WithRecrawlRule(pattern *regexp.Regexp, interval time.Duration) Option {
+	return func(c *Crawler) {
+		c.recrawlRules = append(c.recrawlRules, RecrawlRule{Pattern: pattern, Interval: interval})
+	}
+}
+
+// WithDomainBudget limits the number of pages fetched from each host to budgets[host],
+// the "*" entry applies to the hosts without one of their own. Urls past the budget of their host are skipped.
+// An entry for a registrable domain, such as golang.co.uk, is shared by the hosts of the domain without one
+// of their own. Internationalized hosts can be given in either form.
+func WithDomainBudget(budgets map[string]int) Option {
+	return func(c *Crawler) {
+		c.domainBudgets = make(map[string]int, len(budgets))
+		for host, budget := range budgets {
+			c.domainBudgets[ToASCIIHost(host)] = budget
+		}
+	}
+}
+
+// WithRobots skips the urls disallowed by the robots.txt of their host, as read by robots.
+// The check happens in the workers right before fetching, so waiting for a robots.txt never holds up the frontier.
+// Crawls ignore robots.txt without this option.
+func WithRobots(robots *Robots) Option {
+	return func(c *Crawler) {
+		c.robots = robots
+	}
+}
+
+// WithSitemaps adds the urls of the sitemaps of the sites of the seeds as additional seeds, found with sitemaps.Discover.
+func WithSitemaps(sitemaps *Sitemaps) Option {
+	return func(c *Crawler) {
+		c.sitemaps = sitemaps
+	}
+}
+
+// WithScope only follows the links within scope of the seeds, such as to the hosts of the seeds with ScopeHost.
+// Crawls follow links to any host without this option.
+func WithScope(scope Scope) Option {
+	return func(c *Crawler) {
+		c.scope = scope
+	}
+}
+
+// WithExternalDepth follows the links out of the scope, the external ones, for depth links from the last page
+// within the scope, whatever the depth of that page, such as 1 to only check that the external links work.
+// The scope is the one of WithScope, or the hosts of the seeds with ScopeOpen.
+func WithExternalDepth(depth int) Option {
+	return func(c *Crawler) {
+		c.externalDepth = depth
+	}
+}
+
+// WithInclude only follows the links matching one of patterns, such as those compiled by CompileGlob.
+// It can be given several times, the links matching any of the patterns are followed.
+// The seeds are crawled whether they match or not.
+func WithInclude(patterns ...*regexp.Regexp) Option {
+	return func(c *Crawler) {
+		c.include = append(c.include, patterns...)
+	}
+}
+
+// WithExclude does not follow the links matching one of patterns, even when they match WithInclude.
+// It can be given several times.
+func WithExclude(patterns ...*regexp.Regexp) Option {
+	return func(c *Crawler) {
+		c.exclude = append(c.exclude, patterns...)
+	}
+}
+
+// WithIgnoreNofollow follows the links of the pages asking not to, with rel="nofollow" or a robots meta tag or
+// header, and does not set PageResult.NoIndex. Crawls honor them without this option.
+func WithIgnoreNofollow() Option {
+	return func(c *Crawler) {
+		c.ignoreNofollow = true
+	}
+}
+
+// WithRewrite maps the seeds and the links found with rewrite before they are enqueued, after normalizing them,
+// dropping the urls it reports false for. It can be given several times, the rewrites apply in order.
+// Rewrites are called by a single goroutine at a time.
+func WithRewrite(rewrite RewriteFunc) Option {
+	return func(c *Crawler) {
+		c.rewrites = append(c.rewrites, rewrite)
+	}
+}
+
+// WithRouter hands the pages fetched without error to the handlers router routes them to, reporting what they
+// extract in PageResult.Data.
+func WithRouter(router *Router) Option {
+	return func(c *Crawler) {
+		c.router = router
+	}
+}
+
+// WithSkipExtensions does not fetch the links whose path has one of the extensions, such as ".pdf",
+// or one of DefaultSkipExtensions without extensions. They are counted in Stats.Skipped, or checked with a HEAD
+// request with check, so broken links to them are still reported, without downloading them. Seeds are fetched
+// whatever their extension.
+func WithSkipExtensions(check bool, extensions ...string) Option {
+	return func(c *Crawler) {
+		if len(extensions) == 0 {
+			extensions = DefaultSkipExtensions
+		}
+		c.skipExtensions = make(map[string]bool, len(extensions))
+		for _, ext := range extensions {
+			if !strings.HasPrefix(ext, ".") {
+				ext = "." + ext
+			}
+			c.skipExtensions[strings.ToLower(ext)] = true
+		}
+		c.checkSkipped = check
+	}
+}
+
+// WithMaxLinks enqueues at most n of the links found on a page that were not visited yet, those with the highest
+// score with WithPriority, or the first ones. The others are counted in Stats.Skipped, they can still be
+// enqueued from another page. It defends against pages with so many links they would swamp the frontier.
+func WithMaxLinks(n int) Option {
+	return func(c *Crawler) {
+		c.maxLinks = n
+	}
+}
+
+// WithSink writes every crawled page to sink as it is crawled, along with handing it out. It can be given several
+// times. Sinks are written to by a single goroutine, slow ones hold up the crawl. They are not closed by the crawl,
+// so several crawls can write to them. LifecycleSinks are also told when the crawl starts and ends.
+func WithSink(sink Sink) Option {
+	return func(c *Crawler) {
+		c.sinks = append(c.sinks, sink)
+	}
+}
+
+// WithLogger logs the crawl to logger: its start and end, the fetches and the links that are not followed,
+// with the component logging them. Crawls do not log without this option.
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *Crawler) {
+		c.logger = logger
+	}
+}
+
+// WithProgress reports the progress of the crawl to report every interval, and once more when the crawl ends,
+// such as to the Update of a ProgressDisplay. report is called by the goroutine dispatching the pages, so it must
+// return quickly.
+func WithProgress(interval time.Duration, report func(Progress)) Option {
+	return func(c *Crawler) {
+		c.progress = report
+		c.progressInterval = interval
+	}
+}
+
+// WithMetrics collects the metrics of the crawl, and of the pages fetched again by Monitor, into metrics.
+func WithMetrics(metrics *Metrics) Option {
+	return func(c *Crawler) {
+		c.metrics = metrics
+	}
+}
+
+// WithTracer exports a trace of every crawled page to tracer, with a span per stage of the pipeline.
+func WithTracer(tracer *Tracer) Option {
+	return func(c *Crawler) {
+		c.tracer = tracer
+	}
+}
+
+// WithTrapDetector drops the links that detector suspects belong to a crawler trap, an url space without end
+// such as a calendar, instead of descending into it. The traps are reported in CrawlResult.Traps.
+func WithTrapDetector(detector *TrapDetector) Option {
+	return func(c *Crawler) {
+		c.traps = detector
+	}
+}
+
+// WithNormalizer rewrites the seeds and the links found on the pages with normalizer before they are enqueued,
+// instead of with a Normalizer keeping trailing slashes. A nil normalizer crawls the urls as they are found.
+func WithNormalizer(normalizer *Normalizer) Option {
+	return func(c *Crawler) {
+		c.normalizer = normalizer
+	}
+}
+
+// WithDedup hashes the bodies of the crawled pages to find the urls serving the same content as a page crawled
+// before, such as its ?sort= variants, reported in PageResult.DuplicateOf and CrawlResult.Duplicates.
+// With skipLinks the links of the duplicates are not followed, since they are the links of the page they duplicate.
+// Bodies are compared as kept by WithBodyLimit.
+func WithDedup(skipLinks bool) Option {
+	return func(c *Crawler) {
+		c.dedup = true
+		c.dedupSkipLinks = skipLinks
+	}
+}
+
+// WithCanonicalDedup takes the pages declaring the same canonical url, with a <link rel="canonical"> or
+// a Link header, for the same page: the pages after the first are reported in PageResult.DuplicateOf and
+// CrawlResult.Duplicates, and their links are not followed. The canonical url itself is not fetched
+// once a page declared it.
+func WithCanonicalDedup() Option {
+	return func(c *Crawler) {
+		c.canonicalDedup = true
+	}
+}
+
+// WithBodyLimit keeps only the first n bytes of the bodies of streamed pages in PageResult.Body, and none when n is 0.
+// Pages are streamed when the fetcher of the Crawler, with its middlewares, is a StreamFetcher.
+// The links of HTML pages are still extracted from their whole bodies.
+func WithBodyLimit(n int64) Option {
+	return func(c *Crawler) {
+		c.bodyLimit = n
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// pathDepth is the maximum depth of the urls under prefix, set by WithPathDepth.
+type pathDepth struct {
+	prefix string
+	depth  int
+}
+
+// depthOf returns the maximum depth of url, that of the longest prefix of WithPathDepth it is under,
+// or the depth of the crawler.
+func (c *Crawler) depthOf(rawURL URL) int {
+	if len(c.pathDepths) == 0 {
+		return c.depth
+	}
+	path := rawURL
+	if u, err := url.Parse(rawURL); err == nil {
+		path = u.EscapedPath()
+	}
+	depth, longest := c.depth, -1
+	for _, d := range c.pathDepths {
+		subject := rawURL
+		if strings.HasPrefix(d.prefix, "/") {
+			subject = path
+		}
+		if strings.HasPrefix(subject, d.prefix) && len(d.prefix) > longest {
+			depth, longest = d.depth, len(d.prefix)
+		}
+	}
+	return depth
+}
+
+// pathDepthsFlag is a flag.Value collecting prefix=depth pairs into Options, it can be repeated.
+type pathDepthsFlag struct {
+	opts *[]Option
+}
+
+func (f *pathDepthsFlag) String() string {
+	return ""
+}
+
+func (f *pathDepthsFlag) Set(s string) error {
+	i := strings.LastIndexByte(s, '=')
+	if i <= 0 {
+		return fmt.Errorf("%q is not prefix=depth", s)
+	}
+	depth, err := strconv.Atoi(s[i+1:])
+	if err != nil {
+		return fmt.Errorf("%q is not prefix=depth", s)
+	}
+	*f.opts = append(*f.opts, WithPathDepth(s[:i], depth))
+	return nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Progress is a snapshot of a crawl while it runs, reported by WithProgress.
+type Progress struct {
+	// Elapsed is the time since the crawl started.
+	Elapsed time.Duration
+	// Pages is the number of pages crawled so far, including failed and cached ones.
+	Pages int
+	// Errors is the number of failed pages so far.
+	Errors int
+	// CacheHits is the number of pages served by a FetcherCache so far.
+	CacheHits int
+	// BytesDownloaded is the total size of the bodies downloaded so far, as Stats.BytesDownloaded.
+	BytesDownloaded int64
+	// Frontier is the number of urls waiting to be fetched.
+	Frontier int
+	// Busy is the number of workers fetching a page, out of Workers.
+	Busy    int
+	Workers int
+	// Done is set on the last report, once the crawl is over.
+	Done bool
+}
+
+// CacheHitRate returns the share of the pages served by a FetcherCache, between 0 and 1.
+func (p Progress) CacheHitRate() float64 {
+	if p.Pages == 0 {
+		return 0
+	}
+	return float64(p.CacheHits) / float64(p.Pages)
+}
+
+// progress returns the Progress of the run.
+func (r *run) progress() Progress {
+	stats := &r.result.Stats
+	failed := 0
+	for _, n := range stats.Errors {
+		failed += n
+	}
+	return Progress{
+		Elapsed:         time.Since(r.start),
+		Pages:           stats.PagesFetched,
+		Errors:          failed,
+		CacheHits:       stats.CacheHits,
+		BytesDownloaded: stats.BytesDownloaded,
+		Frontier:        r.frontier.Len(),
+		Busy:            int(atomic.LoadInt32(&r.busy)),
+		Workers:         r.c.concurrency,
+	}
+}
+
+// reportProgress reports the Progress of the run to the function of WithProgress, if any.
+func (r *run) reportProgress(done bool) {
+	if r.c.progress == nil {
+		return
+	}
+	p := r.progress()
+	p.Done = done
+	r.c.progress(p)
+}
+
+// ProgressDisplay shows the Progress of a crawl on a line of W, such as a terminal, for WithProgress:
+//
+//	1204 pages  18.3 pages/s  frontier 5320  workers 7/8  errors 12  cache 34%  1m05s
+//
+// The pages per second are those since the previous update, and the average of the crawl on the last one.
+// Writes to the ProgressDisplay go to W above the line, so logs can share the terminal with it.
+type ProgressDisplay struct {
+	W io.Writer
+	// Terminal redraws the line in place, W being a terminal, instead of writing every update on a line of its own.
+	Terminal bool
+
+	mu   sync.Mutex
+	line string
+	last Progress
+}
+
+// Update shows p, it is the function to give WithProgress.
+func (d *ProgressDisplay) Update(p Progress) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	since := d.last
+	if p.Done {
+		since = Progress{}
+	}
+	rate := 0.0
+	if elapsed := (p.Elapsed - since.Elapsed).Seconds(); elapsed > 0 {
+		rate = float64(p.Pages-since.Pages) / elapsed
+	}
+	d.last = p
+	d.line = fmt.Sprintf("%d pages  %.1f pages/s  frontier %d  workers %d/%d  errors %d  cache %.0f%%  %s",
+		p.Pages, rate, p.Frontier, p.Busy, p.Workers, p.Errors, 100*p.CacheHitRate(), p.Elapsed.Round(time.Second))
+	if !d.Terminal || p.Done {
+		fmt.Fprintf(d.W, "%s%s\n", d.erase(), d.line)
+		// the last line stays, what is written next goes below it
+		d.line = ""
+		return
+	}
+	fmt.Fprintf(d.W, "%s%s", d.erase(), d.line)
+}
+
+// Write writes p to W, above the line of the progress.
+func (d *ProgressDisplay) Write(p []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.Terminal || d.line == "" {
+		return d.W.Write(p)
+	}
+	fmt.Fprint(d.W, d.erase())
+	n, err := d.W.Write(p)
+	if len(p) > 0 && p[len(p)-1] == '\n' {
+		fmt.Fprint(d.W, d.line)
+	}
+	return n, err
+}
+
+// erase returns what clears the line of the progress, with Terminal.
+func (d *ProgressDisplay) erase() string {
+	if !d.Terminal {
+		return ""
+	}
+	// back to the start of the line, which is cleared to its end
+	return "\r\x1b[K"
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMaxProxyFailures is the number of failures in a row that take a proxy of a ProxyPool out of rotation.
+const DefaultMaxProxyFailures = 3
+
+// DefaultProxyCoolDown is how long a proxy of a ProxyPool without CoolDown stays out of rotation.
+const DefaultProxyCoolDown = 30 * time.Second
+
+// ErrNoProxy is the error of the requests of an HTTPFetcher when every proxy of its ProxyPool is out of rotation.
+var ErrNoProxy = errors.New("no healthy proxy")
+
+// Proxy is an HTTP or HTTPS proxy of a ProxyPool.
+type Proxy struct {
+	URL *url.URL
+	// Weight is the share of the requests sent through the proxy, relative to the other proxies. 0 counts as 1.
+	Weight int
+
+	// current is the smooth weighted round-robin counter
+	current  int
+	failures int
+	down     bool
+	// downSince is when the proxy was taken out of rotation, or last failed a probe
+	downSince time.Time
+	probing   bool
+}
+
+// ProxyPool spreads the requests of an HTTPFetcher over proxies by weighted round-robin.
+// Proxies whose connections fail MaxFailures times in a row are taken out of rotation. Once CoolDown has passed,
+// a single request probes a proxy, putting it back in rotation when it goes through. Check can also put them back,
+// or take them out, with a request to CheckURL.
+type ProxyPool struct {
+	Proxies []*Proxy
+	// MaxFailures is the number of failures in a row that take a proxy out of rotation, DefaultMaxProxyFailures when 0.
+	MaxFailures int
+	// CoolDown is how long a proxy stays out of rotation before probing it, DefaultProxyCoolDown when 0.
+	CoolDown time.Duration
+	// CheckURL is requested through every proxy by Check.
+	CheckURL string
+
+	lock sync.Mutex
+}
+
+// ParseProxies returns the proxies of a comma separated list of urls, all with the same weight.
+func ParseProxies(list string) ([]*Proxy, error) {
+	var proxies []*Proxy
+	for _, rawURL := range strings.Split(list, ",") {
+		rawURL = strings.TrimSpace(rawURL)
+		if rawURL == "" {
+			continue
+		}
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		proxies = append(proxies, &Proxy{URL: u})
+	}
+	return proxies, nil
+}
+
+// pick returns the proxy the next request goes through, a proxy out of rotation to probe once its CoolDown has passed.
+func (p *ProxyPool) pick() (*Proxy, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	coolDown := p.CoolDown
+	if coolDown <= 0 {
+		coolDown = DefaultProxyCoolDown
+	}
+	for _, proxy := range p.Proxies {
+		if proxy.down && !proxy.probing && time.Since(proxy.downSince) >= coolDown {
+			proxy.probing = true
+			return proxy, nil
+		}
+	}
+	var best *Proxy
+	total := 0
+	for _, proxy := range p.Proxies {
+		if proxy.down {
+			continue
+		}
+		weight := proxy.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		proxy.current += weight
+		total += weight
+		if best == nil || proxy.current > best.current {
+			best = proxy
+		}
+	}
+	if best == nil {
+		return nil, ErrNoProxy
+	}
+	best.current -= total
+	return best, nil
+}
+
+// report accounts for a request sent through proxy, which got resp or failed with err.
+func (p *ProxyPool) report(proxy *Proxy, resp *http.Response, err error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	probe := proxy.probing
+	proxy.probing = false
+	switch {
+	case isContextError(err):
+		// the request was given up, which tells nothing about the proxy
+	case isProxyFailure(resp, err):
+		proxy.failures++
+		max := p.MaxFailures
+		if max <= 0 {
+			max = DefaultMaxProxyFailures
+		}
+		if probe || proxy.failures >= max {
+			proxy.down = true
+			proxy.downSince = time.Now()
+		}
+	default:
+		proxy.failures = 0
+		proxy.down = false
+	}
+}
+
+// Check requests CheckURL through every proxy, putting the working ones back in rotation and taking the others out.
+// It fails with ErrNoProxy when no proxy works, and without CheckURL, rather than taking them all out.
+func (p *ProxyPool) Check(ctx context.Context) error {
+	if p.CheckURL == "" {
+		return errors.New("proxy pool: no CheckURL to check the proxies with")
+	}
+	healthy := 0
+	for _, proxy := range p.Proxies {
+		ok := checkProxy(ctx, proxy.URL, p.CheckURL)
+		p.lock.Lock()
+		proxy.down = !ok
+		proxy.downSince = time.Now()
+		proxy.failures = 0
+		p.lock.Unlock()
+		if ok {
+			healthy++
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if healthy == 0 {
+		return ErrNoProxy
+	}
+	return nil
+}
+
+// checkProxy reports whether checkURL can be requested through proxyURL.
+func checkProxy(ctx context.Context, proxyURL *url.URL, checkURL string) bool {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyURL(proxyURL)
+	defer transport.CloseIdleConnections()
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, checkURL, nil)
+	if err != nil {
+		return false
+	}
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode < http.StatusInternalServerError && resp.StatusCode != http.StatusProxyAuthRequired
+}
+
+// isProxyFailure reports whether a request sent through a proxy failed because of the proxy: it could not be
+// connected to, refused the CONNECT request of an HTTPS url, or asked for credentials. The other errors, such as
+// timeouts, TLS errors of the target or too many redirects, are not the proxy's.
+func isProxyFailure(resp *http.Response, err error) bool {
+	if err == nil {
+		return resp.StatusCode == http.StatusProxyAuthRequired
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "proxyconnect"
+}
+
+// checkProxyConnect is the OnProxyConnectResponse function of the transport of an HTTPFetcher with a ProxyPool,
+// it fails the CONNECT requests the proxy refused with an error isProxyFailure recognizes, as the dial errors.
+func checkProxyConnect(ctx context.Context, proxyURL *url.URL, connectReq *http.Request, connectRes *http.Response) error {
+	if connectRes.StatusCode != http.StatusOK {
+		return &net.OpError{Op: "proxyconnect", Net: "tcp", Err: errors.New(connectRes.Status)}
+	}
+	return nil
+}
+
+// proxyTransport is the transport of an HTTPFetcher with a ProxyPool, it sends every request through a proxy of pool.
+type proxyTransport struct {
+	pool *ProxyPool
+	next *http.Transport
+}
+
+func (t *proxyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	proxy, err := t.pool.pick()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.next.RoundTrip(req.WithContext(context.WithValue(req.Context(), proxyKey{}, proxy)))
+	t.pool.report(proxy, resp, err)
+	return resp, err
+}
+
+func (t *proxyTransport) CloseIdleConnections() {
+	t.next.CloseIdleConnections()
+}
+
+type proxyKey struct{}
+
+// proxyFromContext is the Proxy function of the transport of an HTTPFetcher with a ProxyPool,
+// it returns the proxy proxyTransport picked for the request.
+func proxyFromContext(req *http.Request) (*url.URL, error) {
+	if proxy, ok := req.Context().Value(proxyKey{}).(*Proxy); ok {
+		return proxy.URL, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// PublicSuffixList are the rules of the public suffix list, https://publicsuffix.org/list/, telling apart
+// the suffixes under which domains are registered, such as co.uk or github.io, from the domains themselves.
+type PublicSuffixList struct {
+	rules map[string]suffixRule
+}
+
+// suffixRule is the kind of a rule of a PublicSuffixList.
+type suffixRule int
+
+const (
+	// suffixNormal rules are suffixes, such as co.uk
+	suffixNormal suffixRule = 1 << iota
+	// suffixWildcard rules make every child of the domain a suffix, such as *.ck
+	suffixWildcard
+	// suffixException rules are the domains that are not suffixes despite a wildcard, such as !www.ck
+	suffixException
+)
+
+// DefaultPublicSuffixList is the list used to group hosts by registrable domain, a subset of the public suffix list
+// with the most common suffixes. Replace it before crawling with ParsePublicSuffixList to use the full list.
+var DefaultPublicSuffixList = mustParsePublicSuffixList(defaultPublicSuffixes)
+
+// ParsePublicSuffixList reads a list in the format of public_suffix_list.dat: a rule per line,
+// with // comments. Unicode rules are stored in their ASCII form.
+func ParsePublicSuffixList(r io.Reader) (*PublicSuffixList, error) {
+	l := &PublicSuffixList{rules: make(map[string]suffixRule)}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "//") {
+			continue
+		}
+		rule, kind := fields[0], suffixNormal
+		switch {
+		case strings.HasPrefix(rule, "!"):
+			rule, kind = rule[1:], suffixException
+		case strings.HasPrefix(rule, "*."):
+			rule, kind = rule[2:], suffixWildcard
+		}
+		rule = ToASCIIHost(rule)
+		l.rules[rule] |= kind
+	}
+	return l, scanner.Err()
+}
+
+func mustParsePublicSuffixList(rules string) *PublicSuffixList {
+	l, err := ParsePublicSuffixList(strings.NewReader(rules))
+	if err != nil {
+		panic(err)
+	}
+	return l
+}
+
+// PublicSuffix returns the public suffix of host, which is its last label when no rule matches.
+func (l *PublicSuffixList) PublicSuffix(host string) string {
+	labels := strings.Split(strings.TrimSuffix(ToASCIIHost(host), "."), ".")
+	for i := range labels {
+		suffix := strings.Join(labels[i:], ".")
+		kind := l.rules[suffix]
+		if kind&suffixException != 0 {
+			return strings.Join(labels[i+1:], ".")
+		}
+		if kind&suffixNormal != 0 || i+1 < len(labels) && l.rules[strings.Join(labels[i+1:], ".")]&suffixWildcard != 0 {
+			return suffix
+		}
+	}
+	return labels[len(labels)-1]
+}
+
+// RegistrableDomain returns the domain of host that can be registered, its public suffix and the label before it,
+// such as golang.co.uk for blog.golang.co.uk, or host itself when it is a public suffix.
+func (l *PublicSuffixList) RegistrableDomain(host string) string {
+	host = strings.TrimSuffix(ToASCIIHost(host), ".")
+	suffix := l.PublicSuffix(host)
+	if len(suffix) >= len(host) {
+		return host
+	}
+	domain := host[:len(host)-len(suffix)-1]
+	return domain[strings.LastIndexByte(domain, '.')+1:] + "." + suffix
+}
+
+// defaultPublicSuffixes are the rules of DefaultPublicSuffixList, the top level domains are implied.
+const defaultPublicSuffixes = `
+// ICANN
+ac.uk
+co.uk
+gov.uk
+ltd.uk
+me.uk
+net.uk
+nhs.uk
+org.uk
+plc.uk
+police.uk
+*.sch.uk
+asn.au
+com.au
+edu.au
+gov.au
+id.au
+net.au
+org.au
+ac.nz
+co.nz
+govt.nz
+net.nz
+org.nz
+ac.jp
+ad.jp
+co.jp
+ed.jp
+go.jp
+gr.jp
+lg.jp
+ne.jp
+or.jp
+*.kawasaki.jp
+!city.kawasaki.jp
+ac.kr
+co.kr
+go.kr
+ne.kr
+or.kr
+re.kr
+ac.cn
+com.cn
+edu.cn
+gov.cn
+net.cn
+org.cn
+com.hk
+edu.hk
+gov.hk
+net.hk
+org.hk
+com.tw
+edu.tw
+gov.tw
+net.tw
+org.tw
+ac.in
+co.in
+edu.in
+firm.in
+gen.in
+gov.in
+ind.in
+net.in
+org.in
+com.sg
+edu.sg
+gov.sg
+net.sg
+org.sg
+com.my
+edu.my
+gov.my
+net.my
+org.my
+ac.id
+co.id
+go.id
+or.id
+web.id
+ac.th
+co.th
+go.th
+in.th
+or.th
+ac.il
+co.il
+gov.il
+net.il
+org.il
+com.tr
+edu.tr
+gov.tr
+net.tr
+org.tr
+ac.za
+co.za
+gov.za
+net.za
+org.za
+web.za
+art.br
+blog.br
+com.br
+edu.br
+gov.br
+net.br
+org.br
+com.ar
+gob.ar
+net.ar
+org.ar
+com.mx
+edu.mx
+gob.mx
+net.mx
+org.mx
+com.ua
+gov.ua
+net.ua
+org.ua
+com.pl
+net.pl
+org.pl
+com.es
+org.es
+*.ck
+!www.ck
+*.bd
+*.np
+
+// private
+appspot.com
+azurewebsites.net
+blogspot.com
+cloudfront.net
+firebaseapp.com
+fly.dev
+github.io
+gitlab.io
+glitch.me
+herokuapp.com
+netlify.app
+onrender.com
+pages.dev
+readthedocs.io
+s3.amazonaws.com
+vercel.app
+web.app
+workers.dev
+*.compute.amazonaws.com
+`
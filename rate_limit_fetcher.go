@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// RateLimitFetcher spaces the fetches of Delegate to the same host, whatever the concurrency of the crawl.
+// Hosts are told apart by hostname, so the ports of a server share its limit.
+type RateLimitFetcher struct {
+	// Delegate is the Fetcher whose fetches are limited.
+	Delegate Fetcher
+	// Delay is the minimum time between two fetches from a host, on average when Burst is above 1.
+	Delay time.Duration
+	// Burst is the number of fetches a host allows at once after being idle, like a token bucket.
+	// 0 and 1 both keep every fetch Delay apart.
+	Burst int
+	// PerDomain makes the hosts of the same registrable domain share their limit, such as blog.golang.org
+	// and golang.org.
+	PerDomain bool
+	// Robots, when set, makes the fetches from a host wait the Crawl-delay of its robots.txt when it is longer
+	// than Delay.
+	Robots *Robots
+
+	lock sync.Mutex
+	// hosts are the times at which the next fetch from every host is due, once its burst is spent
+	hosts map[string]time.Time
+}
+
+// Fetch is the implementation of Fetcher for RateLimitFetcher.
+func (f *RateLimitFetcher) Fetch(url string) (body string, urls []string, err error) {
+	return f.FetchContext(context.Background(), url)
+}
+
+// FetchContext is the implementation of ContextFetcher for RateLimitFetcher.
+// Waiting for its turn gives up once ctx is done, with the error of ctx.
+func (f *RateLimitFetcher) FetchContext(ctx context.Context, rawURL string) (body string, urls []string, err error) {
+	if wait := f.reserve(ctx, rawURL); wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return "", nil, ctx.Err()
+		}
+	}
+	return fetchContext(ctx, f.Delegate, rawURL)
+}
+
+// reserve takes a turn to fetch rawURL, and returns how long to wait for it.
+func (f *RateLimitFetcher) reserve(ctx context.Context, rawURL string) time.Duration {
+	delay := f.Delay
+	host := rawURL
+	if u, err := url.Parse(rawURL); err == nil {
+		host = ToASCIIHost(u.Hostname())
+		if f.Robots != nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" {
+			rules, err := f.Robots.Rules(ctx, u.Scheme+"://"+ToASCIIHost(u.Host))
+			if err == nil && rules.CrawlDelay > delay {
+				delay = rules.CrawlDelay
+			}
+		}
+	}
+	if delay <= 0 {
+		return 0
+	}
+	if f.PerDomain {
+		host = registrableDomain(host)
+	}
+	burst := f.Burst
+	if burst < 1 {
+		burst = 1
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.hosts == nil {
+		f.hosts = make(map[string]time.Time)
+	}
+	now := time.Now()
+	due := f.hosts[host]
+	if due.Before(now) {
+		due = now
+	}
+	f.hosts[host] = due.Add(delay)
+	return due.Add(-time.Duration(burst-1) * delay).Sub(now)
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultRedisPrefix is the prefix of the keys of a RedisStore without Prefix.
+const DefaultRedisPrefix = "crawler:"
+
+// Serialization formats of the results of a RedisStore.
+const (
+	FormatJSON = "json"
+	FormatGob  = "gob"
+)
+
+// RedisStore is a CacheStore keeping the results in Redis, so several crawler processes can share them.
+// It speaks the Redis protocol itself over a small pool of connections.
+// Failing commands make the result a miss, the first such error is reported by Err.
+type RedisStore struct {
+	// Addr is the host:port of the Redis server.
+	Addr string
+	// Password, when not empty, authenticates the connections.
+	Password string
+	// DB is the number of the database the results are kept in.
+	DB int
+	// Prefix is prepended to the urls to make the keys, DefaultRedisPrefix when empty.
+	// Processes sharing results must use the same Prefix and Format.
+	Prefix string
+	// TTL, when set, makes Redis drop the results after that long.
+	TTL time.Duration
+	// Format is the serialization of the results, FormatJSON or FormatGob, FormatJSON when empty.
+	Format string
+	// Timeout bounds every command, 5 seconds when 0.
+	Timeout time.Duration
+
+	lock sync.Mutex
+	idle []*redisConn
+	err  error
+}
+
+// redisConn is a connection to Redis.
+type redisConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// redisError is an error reply of Redis.
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// maxIdleRedisConns is the number of idle connections kept open by a RedisStore.
+const maxIdleRedisConns = 8
+
+func (s *RedisStore) key(url URL) string {
+	if s.Prefix != "" {
+		return s.Prefix + url
+	}
+	return DefaultRedisPrefix + url
+}
+
+// Get is the implementation of CacheStore for RedisStore.
+func (s *RedisStore) Get(url URL) (*FetchResult, bool) {
+	reply, err := s.do("GET", s.key(url))
+	if err != nil {
+		s.fail(err)
+		return nil, false
+	}
+	data, ok := reply.([]byte)
+	if !ok {
+		return nil, false
+	}
+	var record cacheRecord
+	if s.Format == FormatGob {
+		err = gob.NewDecoder(bytes.NewReader(data)).Decode(&record)
+	} else {
+		err = json.Unmarshal(data, &record)
+	}
+	if err != nil {
+		s.fail(err)
+		return nil, false
+	}
+	return record.result(), true
+}
+
+// Set is the implementation of CacheStore for RedisStore.
+// Results expiring before TTL are dropped by Redis when they expire.
+func (s *RedisStore) Set(url URL, result *FetchResult) {
+	record := newCacheRecord(url, result)
+	var data []byte
+	var err error
+	if s.Format == FormatGob {
+		var buf bytes.Buffer
+		err = gob.NewEncoder(&buf).Encode(record)
+		data = buf.Bytes()
+	} else {
+		data, err = json.Marshal(record)
+	}
+	if err != nil {
+		s.fail(err)
+		return
+	}
+	args := []string{"SET", s.key(url), string(data)}
+	ttl := s.TTL
+	if !result.expires.IsZero() {
+		if left := time.Until(result.expires); ttl <= 0 || left < ttl {
+			ttl = left
+		}
+		if ttl < time.Millisecond {
+			ttl = time.Millisecond
+		}
+	}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(int64(ttl/time.Millisecond), 10))
+	}
+	if _, err := s.do(args...); err != nil {
+		s.fail(err)
+	}
+}
+
+// Delete is the implementation of CacheStore for RedisStore.
+func (s *RedisStore) Delete(url URL) {
+	if _, err := s.do("DEL", s.key(url)); err != nil {
+		s.fail(err)
+	}
+}
+
+// Len is the implementation of CacheStore for RedisStore, it scans the keys with the prefix of the store.
+func (s *RedisStore) Len() int {
+	prefix := s.key("")
+	n := 0
+	cursor := "0"
+	for {
+		reply, err := s.do("SCAN", cursor, "MATCH", redisEscapeGlob(prefix)+"*", "COUNT", "1000")
+		if err != nil {
+			s.fail(err)
+			return n
+		}
+		parts, ok := reply.([]interface{})
+		if !ok || len(parts) != 2 {
+			s.fail(errors.New("redis: unexpected SCAN reply"))
+			return n
+		}
+		next, _ := parts[0].([]byte)
+		keys, _ := parts[1].([]interface{})
+		n += len(keys)
+		cursor = string(next)
+		if cursor == "0" || cursor == "" {
+			return n
+		}
+	}
+}
+
+// Err returns the first error talking to Redis, if any.
+func (s *RedisStore) Err() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.err
+}
+
+func (s *RedisStore) fail(err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+// do sends a command and returns its reply, an error reply is returned as a redisError.
+func (s *RedisStore) do(args ...string) (interface{}, error) {
+	c, err := s.conn()
+	if err != nil {
+		return nil, err
+	}
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	c.conn.SetDeadline(time.Now().Add(timeout))
+	reply, err := c.command(args...)
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		// the connection is in an unknown state
+		c.conn.Close()
+		return nil, err
+	}
+	s.release(c)
+	return reply, err
+}
+
+// conn returns an idle connection, or a new one.
+func (s *RedisStore) conn() (*redisConn, error) {
+	s.lock.Lock()
+	if n := len(s.idle); n > 0 {
+		c := s.idle[n-1]
+		s.idle = s.idle[:n-1]
+		s.lock.Unlock()
+		return c, nil
+	}
+	s.lock.Unlock()
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	conn, err := net.DialTimeout("tcp", s.Addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+	c := &redisConn{conn: conn, r: bufio.NewReader(conn)}
+	if s.Password != "" {
+		if _, err := c.command("AUTH", s.Password); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if s.DB != 0 {
+		if _, err := c.command("SELECT", strconv.Itoa(s.DB)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// release hands c back to the pool of idle connections.
+func (s *RedisStore) release(c *redisConn) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.idle) >= maxIdleRedisConns {
+		c.conn.Close()
+		return
+	}
+	s.idle = append(s.idle, c)
+}
+
+// command sends args as a RESP array of bulk strings and reads the reply.
+func (c *redisConn) command(args ...string) (interface{}, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&buf, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := c.conn.Write(buf.Bytes()); err != nil {
+		return nil, err
+	}
+	return readRedisReply(c.r)
+}
+
+// readRedisReply reads a RESP reply: simple strings and bulk strings are returned as []byte, integers as int64,
+// arrays as []interface{}, and nil replies as nil.
+func readRedisReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("redis: malformed reply %q", line)
+	}
+	kind, value := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return []byte(value), nil
+	case '-':
+		return nil, redisError(value)
+	case ':':
+		return strconv.ParseInt(value, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	case '*':
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = readRedisReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: malformed reply %q", line)
+}
+
+// redisEscapeGlob escapes the glob characters of s for a MATCH pattern.
+func redisEscapeGlob(s string) string {
+	var b bytes.Buffer
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis is an in-memory Redis server speaking enough of the protocol for RedisStore.
+type fakeRedis struct {
+	password string
+	listener net.Listener
+
+	mu   sync.Mutex
+	dbs  map[string]map[string]string
+	ttls map[string]time.Duration
+	// commands are the names of the commands received, such as "SET"
+	commands []string
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &fakeRedis{password: password, listener: l, dbs: make(map[string]map[string]string), ttls: make(map[string]time.Duration)}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go r.serve(conn)
+		}
+	}()
+	return r
+}
+
+// readCommand reads a RESP array of bulk strings.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, err
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		args[i] = string(data[:size])
+	}
+	return args, nil
+}
+
+func bulk(s string) string {
+	return fmt.Sprintf("$%d\r\n%s\r\n", len(s), s)
+}
+
+func (r *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+	db := "0"
+	authed := r.password == ""
+	for {
+		args, err := readCommand(br)
+		if err != nil {
+			return
+		}
+		r.mu.Lock()
+		r.commands = append(r.commands, args[0])
+		if r.dbs[db] == nil {
+			r.dbs[db] = make(map[string]string)
+		}
+		keys := r.dbs[db]
+		var reply string
+		switch {
+		case args[0] == "AUTH":
+			authed = args[1] == r.password
+			reply = "+OK\r\n"
+			if !authed {
+				reply = "-WRONGPASS invalid password\r\n"
+			}
+		case !authed:
+			reply = "-NOAUTH Authentication required.\r\n"
+		case args[0] == "SELECT":
+			db = args[1]
+			reply = "+OK\r\n"
+		case args[0] == "GET":
+			if value, ok := keys[args[1]]; ok {
+				reply = bulk(value)
+			} else {
+				reply = "$-1\r\n"
+			}
+		case args[0] == "SET":
+			keys[args[1]] = args[2]
+			delete(r.ttls, args[1])
+			if len(args) == 5 && args[3] == "PX" {
+				ms, _ := strconv.Atoi(args[4])
+				r.ttls[args[1]] = time.Duration(ms) * time.Millisecond
+			}
+			reply = "+OK\r\n"
+		case args[0] == "DEL":
+			_, ok := keys[args[1]]
+			delete(keys, args[1])
+			reply = ":0\r\n"
+			if ok {
+				reply = ":1\r\n"
+			}
+		case args[0] == "SCAN":
+			// the keys are returned in one go, the MATCH patterns of RedisStore are escaped prefixes followed by *
+			prefix := strings.NewReplacer(`\\`, `\`, `\*`, "*", `\?`, "?", `\[`, "[", `\]`, "]").Replace(strings.TrimSuffix(args[3], "*"))
+			var matched []string
+			for key := range keys {
+				if strings.HasPrefix(key, prefix) {
+					matched = append(matched, key)
+				}
+			}
+			sort.Strings(matched)
+			reply = "*2\r\n" + bulk("0") + fmt.Sprintf("*%d\r\n", len(matched))
+			for _, key := range matched {
+				reply += bulk(key)
+			}
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+		r.mu.Unlock()
+		io.WriteString(conn, reply)
+	}
+}
+
+func (r *fakeRedis) ttl(key string) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.ttls[key]
+}
+
+func TestRedisStore(t *testing.T) {
+	for _, format := range []string{"", FormatJSON, FormatGob} {
+		r := newFakeRedis(t, "secret")
+		store := &RedisStore{Addr: r.listener.Addr().String(), Password: "secret", DB: 2, Format: format}
+		testCacheStore(t, store)
+		r.mu.Lock()
+		n := len(r.dbs["2"])
+		r.mu.Unlock()
+		if n != len(storedResults())-1 {
+			t.Errorf("format %q: %d keys in database 2, want %d", format, n, len(storedResults())-1)
+		}
+	}
+}
+
+func TestRedisStorePrefixes(t *testing.T) {
+	r := newFakeRedis(t, "")
+	addr := r.listener.Addr().String()
+	first := &RedisStore{Addr: addr, Prefix: "first:"}
+	second := &RedisStore{Addr: addr, Prefix: "second:"}
+	first.Set("https://example.com/", &FetchResult{body: "first"})
+	first.Set("https://example.com/a", &FetchResult{body: "a"})
+	second.Set("https://example.com/", &FetchResult{body: "second"})
+	if result, ok := second.Get("https://example.com/"); !ok || result.body != "second" {
+		t.Errorf("Get of the second store = %v, %t, want its own result", result, ok)
+	}
+	if first.Len() != 2 || second.Len() != 1 {
+		t.Errorf("Len = %d and %d, want 2 and 1", first.Len(), second.Len())
+	}
+	r.mu.Lock()
+	_, ok := r.dbs["0"][DefaultRedisPrefix+"https://example.com/"]
+	r.mu.Unlock()
+	if ok {
+		t.Errorf("%s prefix used by a store with a Prefix", DefaultRedisPrefix)
+	}
+}
+
+func TestRedisStoreTTL(t *testing.T) {
+	r := newFakeRedis(t, "")
+	store := &RedisStore{Addr: r.listener.Addr().String(), TTL: time.Hour}
+	store.Set("https://example.com/", &FetchResult{body: "page"})
+	store.Set("https://example.com/soon", &FetchResult{body: "soon", expires: time.Now().Add(time.Minute)})
+	if ttl := r.ttl(DefaultRedisPrefix + "https://example.com/"); ttl != time.Hour {
+		t.Errorf("ttl = %s, want the TTL of the store", ttl)
+	}
+	if ttl := r.ttl(DefaultRedisPrefix + "https://example.com/soon"); ttl <= 0 || ttl > time.Minute {
+		t.Errorf("ttl = %s, want the minute left of the result", ttl)
+	}
+}
+
+func TestRedisStoreErrors(t *testing.T) {
+	r := newFakeRedis(t, "secret")
+	store := &RedisStore{Addr: r.listener.Addr().String(), Password: "wrong"}
+	store.Set("https://example.com/", &FetchResult{body: "page"})
+	if _, ok := store.Get("https://example.com/"); ok {
+		t.Error("Get found a result despite the failed authentication")
+	}
+	if err := store.Err(); err == nil || !strings.Contains(err.Error(), "WRONGPASS") {
+		t.Errorf("Err = %v, want the error reply of AUTH", err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	store = &RedisStore{Addr: addr, Timeout: time.Second}
+	if _, ok := store.Get("https://example.com/"); ok || store.Err() == nil {
+		t.Errorf("Get of an unreachable server = %t with Err %v, want a miss and an error", ok, store.Err())
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// DefaultRenderWait is the time scripts get to run before RenderingFetcher reads the DOM.
+const DefaultRenderWait = 5 * time.Second
+
+// browserNames are looked up in PATH when RenderingFetcher.Browser is not set.
+var browserNames = []string{"chromium", "chromium-browser", "google-chrome", "google-chrome-stable", "chrome"}
+
+// ErrNoBrowser is returned by RenderingFetcher when no browser binary is found.
+var ErrNoBrowser = errors.New("no headless browser found")
+
+// RenderingFetcher is a Fetcher rendering pages with a headless Chrome or Chromium, so the links of pages
+// built by JavaScript are found too. The body is the serialized DOM once the scripts had Wait to run.
+// The browser is run once per page with --dump-dom, which needs nothing but the browser binary, but it is not
+// driven over the DevTools protocol: the FetchMeta of the fetch has no status code, headers, redirects or final url,
+// so error pages are rendered like any other page and links are resolved against the requested url. There is no
+// waiting for the navigation or the network to settle either, the DOM is read once Wait of virtual time has passed,
+// and the only timeout is that of ctx, which kills the browser.
+type RenderingFetcher struct {
+	// Browser is the path of the browser binary, the first of browserNames found in PATH when empty.
+	Browser string
+	// Wait is the virtual time scripts get to run before the DOM is read, DefaultRenderWait when not positive.
+	Wait time.Duration
+	// UserAgent is the user agent of the browser, DefaultUserAgent when empty.
+	UserAgent string
+	// Args are extra command line flags for the browser.
+	Args []string
+}
+
+// Fetch is the implementation of Fetcher for RenderingFetcher.
+func (f *RenderingFetcher) Fetch(url string) (body string, urls []string, err error) {
+	return f.FetchContext(context.Background(), url)
+}
+
+// FetchContext is the implementation of ContextFetcher for RenderingFetcher, the browser is killed once ctx is done.
+func (f *RenderingFetcher) FetchContext(ctx context.Context, url string) (body string, urls []string, err error) {
+	browser, err := f.browser()
+	if err != nil {
+		return "", nil, err
+	}
+	wait := f.Wait
+	if wait <= 0 {
+		wait = DefaultRenderWait
+	}
+	userAgent := f.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+	args := []string{
+		"--headless",
+		"--disable-gpu",
+		"--dump-dom",
+		fmt.Sprintf("--virtual-time-budget=%d", wait.Milliseconds()),
+		"--user-agent=" + userAgent,
+	}
+	args = append(args, f.Args...)
+	args = append(args, url)
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, browser, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return "", nil, ctx.Err()
+		}
+		return "", nil, fmt.Errorf("render %s: %w: %s", url, err, strings.TrimSpace(lastLine(stderr.String())))
+	}
+	body = stdout.String()
+	urls, err = extractLinks(ctx, strings.NewReader(body), url)
+	return body, urls, err
+}
+
+func (f *RenderingFetcher) browser() (string, error) {
+	if f.Browser != "" {
+		return f.Browser, nil
+	}
+	for _, name := range browserNames {
+		if path, err := exec.LookPath(name); err == nil {
+			return path, nil
+		}
+	}
+	return "", ErrNoBrowser
+}
+
+// lastLine returns the last non empty line of s.
+func lastLine(s string) string {
+	s = strings.TrimRight(s, "\n")
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		return s[i+1:]
+	}
+	return s
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// DefaultReportTop is the number of pages a ReportSink without Top lists among the slowest, largest and deepest.
+const DefaultReportTop = 10
+
+// Report is the summary of a crawl made by a ReportSink.
+type Report struct {
+	StopReason string
+	Duration   time.Duration
+	// Pages is the number of crawled pages, Failed the number of failed ones, and CacheHits those served
+	// by a FetcherCache.
+	Pages     int
+	Failed    int
+	CacheHits int
+	// BytesDownloaded is the total size of the bodies that were not served from cache, as transferred.
+	BytesDownloaded int64
+	MaxDepth        int
+	// Errors counts the failed pages by error class, Skipped the urls not fetched by reason, and Filtered
+	// the links dropped from the pages by reason, as in Stats.
+	Errors   map[string]int `json:",omitempty"`
+	Skipped  map[string]int `json:",omitempty"`
+	Filtered map[string]int `json:",omitempty"`
+	// Slowest, Largest and Deepest are the pages that took the longest to fetch, with the largest bodies and
+	// the furthest from the seeds, in that order.
+	Slowest []ReportPage
+	Largest []ReportPage
+	Deepest []ReportPage
+	// Hosts are the totals of every host, those with the most pages first.
+	Hosts []HostReport
+}
+
+// ReportPage is a page listed in a Report.
+type ReportPage struct {
+	URL        URL
+	Depth      int
+	StatusCode int `json:",omitempty"`
+	// Duration is the time the fetch took, in nanoseconds.
+	Duration time.Duration
+	// Size is the size of the body as transferred.
+	Size  int64
+	Error string `json:",omitempty"`
+}
+
+// HostReport are the totals of a host in a Report.
+type HostReport struct {
+	// Host is the host in its Unicode form.
+	Host   string
+	Pages  int
+	Failed int
+	Bytes  int64
+	// ErrorRate is the share of the failed pages of the host.
+	ErrorRate float64
+	// MeanDuration is the mean time the fetches from the host took, and P50 and P95 their median and 95th percentile
+	// as estimated by HostStats, without the pages served from cache, in nanoseconds.
+	MeanDuration time.Duration
+	P50, P95     time.Duration
+}
+
+// ReportSink is a LifecycleSink summing up a crawl into a Report, written as text by WriteText,
+// or as JSON by WriteJSON. The report is of the last crawl written to the sink.
+type ReportSink struct {
+	// Top is the number of pages listed among the slowest, largest and deepest, DefaultReportTop when not positive.
+	Top int
+
+	report  Report
+	slowest topPages
+	largest topPages
+	deepest topPages
+	hosts   map[string]*hostTotals
+}
+
+// hostTotals are the totals of a host while a ReportSink collects them.
+type hostTotals struct {
+	pages, failed int
+	bytes         int64
+}
+
+// Start is the implementation of LifecycleSink for ReportSink.
+func (s *ReportSink) Start(seeds []URL) error {
+	top := s.Top
+	if top <= 0 {
+		top = DefaultReportTop
+	}
+	s.report = Report{}
+	s.slowest = topPages{n: top, less: func(a, b ReportPage) bool { return a.Duration > b.Duration }}
+	s.largest = topPages{n: top, less: func(a, b ReportPage) bool { return a.Size > b.Size }}
+	s.deepest = topPages{n: top, less: func(a, b ReportPage) bool { return a.Depth > b.Depth }}
+	s.hosts = make(map[string]*hostTotals)
+	return nil
+}
+
+// Write is the implementation of Sink for ReportSink.
+func (s *ReportSink) Write(page PageResult) error {
+	if s.hosts == nil {
+		s.Start(nil)
+	}
+	p := ReportPage{URL: page.URL, Depth: page.Depth, StatusCode: page.Meta.StatusCode, Duration: page.Duration}
+	if page.Err != nil {
+		p.Error = page.Err.Error()
+	} else {
+		p.Size = bodySize(page)
+	}
+	s.slowest.add(p)
+	if p.Size > 0 {
+		s.largest.add(p)
+	}
+	if p.Depth > 0 {
+		s.deepest.add(p)
+	}
+	host := s.hosts[hostOf(page.URL)]
+	if host == nil {
+		host = &hostTotals{}
+		s.hosts[hostOf(page.URL)] = host
+	}
+	host.pages++
+	host.bytes += p.Size
+	if page.Err != nil {
+		host.failed++
+	}
+	return nil
+}
+
+// Finish is the implementation of LifecycleSink for ReportSink, it completes the report with the result.
+func (s *ReportSink) Finish(result *CrawlResult) error {
+	if s.hosts == nil {
+		s.Start(nil)
+	}
+	stats := result.Stats
+	r := &s.report
+	r.StopReason = result.StopReason.String()
+	r.Duration = stats.Duration
+	r.Pages = stats.PagesFetched
+	r.CacheHits = stats.CacheHits
+	r.BytesDownloaded = stats.BytesDownloaded
+	r.MaxDepth = stats.MaxDepth
+	r.Errors = copyCounts(stats.Errors)
+	r.Skipped = copyCounts(stats.Skipped)
+	r.Filtered = copyCounts(stats.Filtered)
+	r.Failed = 0
+	for _, n := range stats.Errors {
+		r.Failed += n
+	}
+	r.Slowest = s.slowest.sorted()
+	r.Largest = s.largest.sorted()
+	r.Deepest = s.deepest.sorted()
+	r.Hosts = r.Hosts[:0]
+	for host, totals := range s.hosts {
+		report := HostReport{
+			Host:      ToUnicodeHost(host),
+			Pages:     totals.pages,
+			Failed:    totals.failed,
+			Bytes:     totals.bytes,
+			ErrorRate: float64(totals.failed) / float64(totals.pages),
+		}
+		if hostStats := stats.HostStats[host]; hostStats != nil {
+			report.MeanDuration = hostStats.MeanLatency()
+			report.P50, report.P95 = hostStats.Latency(0.5), hostStats.Latency(0.95)
+		}
+		r.Hosts = append(r.Hosts, report)
+	}
+	sort.Slice(r.Hosts, func(i, j int) bool {
+		if r.Hosts[i].Pages != r.Hosts[j].Pages {
+			return r.Hosts[i].Pages > r.Hosts[j].Pages
+		}
+		return r.Hosts[i].Host < r.Hosts[j].Host
+	})
+	return nil
+}
+
+// Close is the implementation of Sink for ReportSink, the report is still available afterwards.
+func (s *ReportSink) Close() error {
+	return nil
+}
+
+// Report returns the report of the crawl, complete once the crawl is over.
+func (s *ReportSink) Report() *Report {
+	return &s.report
+}
+
+// WriteJSON writes the report to w as JSON.
+func (s *ReportSink) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s.report)
+}
+
+// WriteText writes the report to w as text, with a table of the hosts.
+func (s *ReportSink) WriteText(w io.Writer) error {
+	r := &s.report
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "crawled %d pages in %s, stopped: %s\n", r.Pages, r.Duration.Round(time.Millisecond), r.StopReason)
+	fmt.Fprintf(tw, "%d failed, %d cache hits, %s downloaded, max depth %d\n", r.Failed, r.CacheHits,
+		formatBytes(r.BytesDownloaded), r.MaxDepth)
+	writeCountsText(tw, "errors", r.Errors)
+	writeCountsText(tw, "skipped", r.Skipped)
+	writeCountsText(tw, "filtered links", r.Filtered)
+	writePagesText(tw, "slowest pages", r.Slowest, func(p ReportPage) string { return p.Duration.Round(time.Microsecond).String() })
+	writePagesText(tw, "largest pages", r.Largest, func(p ReportPage) string { return formatBytes(p.Size) })
+	writePagesText(tw, "deepest pages", r.Deepest, func(p ReportPage) string { return fmt.Sprint("depth ", p.Depth) })
+	if len(r.Hosts) > 0 {
+		fmt.Fprintln(tw, "\nhost\tpages\tfailed\terror rate\tdownloaded\tmean fetch\tp50\tp95")
+		for _, host := range r.Hosts {
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%.1f%%\t%s\t%s\t%s\t%s\n", host.Host, host.Pages, host.Failed, 100*host.ErrorRate,
+				formatBytes(host.Bytes), host.MeanDuration.Round(time.Microsecond), host.P50.Round(time.Microsecond),
+				host.P95.Round(time.Microsecond))
+		}
+	}
+	return tw.Flush()
+}
+
+// writeCountsText writes the counts titled title on a line, the largest first, unless there are none.
+func writeCountsText(w io.Writer, title string, counts map[string]int) {
+	if len(counts) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = fmt.Sprintf("%s %d", key, counts[key])
+	}
+	fmt.Fprintf(w, "%s: %s\n", title, strings.Join(parts, ", "))
+}
+
+// writePagesText writes the pages titled title, a line per page with its value, unless there are none.
+func writePagesText(w io.Writer, title string, pages []ReportPage, value func(ReportPage) string) {
+	if len(pages) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\n%s:\n", title)
+	for _, p := range pages {
+		fmt.Fprintf(w, "  %s\t%s\n", value(p), DisplayURL(p.URL))
+	}
+}
+
+// formatBytes returns n bytes in the largest unit it makes at least one of, such as 1.5 MB.
+func formatBytes(n int64) string {
+	const unit = 1000
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	value, exp := float64(n)/unit, 0
+	for value >= unit && exp < 3 {
+		value /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", value, "kMGT"[exp])
+}
+
+// topPages keeps the first n pages in the order of less.
+type topPages struct {
+	n     int
+	less  func(a, b ReportPage) bool
+	pages []ReportPage
+}
+
+func (t *topPages) add(p ReportPage) {
+	t.pages = append(t.pages, p)
+	// the pages are sorted and truncated once there are twice too many, rather than on every page
+	if len(t.pages) >= 2*t.n {
+		t.pages = t.sorted()
+	}
+}
+
+// sorted returns the first n pages, in order.
+func (t *topPages) sorted() []ReportPage {
+	sort.SliceStable(t.pages, func(i, j int) bool { return t.less(t.pages[i], t.pages[j]) })
+	if len(t.pages) > t.n {
+		t.pages = t.pages[:t.n]
+	}
+	return append([]ReportPage(nil), t.pages...)
+}
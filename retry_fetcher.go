@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"syscall"
+	"time"
+)
+
+// DefaultMaxAttempts is the number of attempts of a RetryFetcher without MaxAttempts.
+const DefaultMaxAttempts = 3
+
+// DefaultBackoff is the delay before the first retry of a RetryFetcher without Backoff.
+const DefaultBackoff = 500 * time.Millisecond
+
+// RetryFetcher retries the transient failures of Delegate, such as timeouts, 5xx responses and connection resets.
+type RetryFetcher struct {
+	// Delegate is the Fetcher whose failures are retried.
+	Delegate Fetcher
+	// MaxAttempts is the number of fetches made before giving up, DefaultMaxAttempts when 0.
+	MaxAttempts int
+	// Backoff is the delay before the first retry, DefaultBackoff when 0.
+	// It doubles with every retry, and is jittered to spread retries of many urls.
+	Backoff time.Duration
+}
+
+// RetryError is returned by a RetryFetcher that gave up, it unwraps to the error of the last attempt.
+type RetryError struct {
+	URL URL
+	// Attempts are the errors of all the attempts, in order.
+	Attempts []error
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("fetch %s: giving up after %d attempts: %v", e.URL, len(e.Attempts), e.Unwrap())
+}
+
+// Unwrap returns the error of the last attempt.
+func (e *RetryError) Unwrap() error {
+	return e.Attempts[len(e.Attempts)-1]
+}
+
+// Fetch is the implementation of Fetcher for RetryFetcher.
+func (f *RetryFetcher) Fetch(url string) (body string, urls []string, err error) {
+	return f.FetchContext(context.Background(), url)
+}
+
+// FetchContext is the implementation of ContextFetcher for RetryFetcher.
+// Waiting for a retry gives up once ctx is done, with the error of ctx.
+func (f *RetryFetcher) FetchContext(ctx context.Context, url string) (body string, urls []string, err error) {
+	attempts := f.MaxAttempts
+	if attempts <= 0 {
+		attempts = DefaultMaxAttempts
+	}
+	backoff := f.Backoff
+	if backoff <= 0 {
+		backoff = DefaultBackoff
+	}
+	var errs []error
+	for {
+		body, urls, err = fetchContext(ctx, f.Delegate, url)
+		if err == nil || ctx.Err() != nil || !isTransient(err) {
+			return body, urls, err
+		}
+		errs = append(errs, err)
+		if len(errs) == attempts {
+			return "", nil, &RetryError{URL: url, Attempts: errs}
+		}
+		timer := time.NewTimer(jitter(backoff))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return "", nil, ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// isTransient reports whether a fetch failing with err may succeed when retried.
+func isTransient(err error) bool {
+	var netErr net.Error
+	var httpErr *HTTPError
+	switch {
+	case errors.Is(err, ErrFetchTimeout), errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return true
+	case errors.As(err, &httpErr):
+		return httpErr.StatusCode >= 500
+	}
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// jitter returns a random delay between half of d and d.
+func jitter(d time.Duration) time.Duration {
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// RewriteFunc maps the url of a seed or of a link before it is enqueued, such as to force https.
+// It reports false to drop the url.
+type RewriteFunc func(url URL) (URL, bool)
+
+// ForceHTTPS returns a RewriteFunc crawling http urls over https instead.
+func ForceHTTPS() RewriteFunc {
+	return func(rawURL URL) (URL, bool) {
+		if len(rawURL) > 5 && strings.EqualFold(rawURL[:5], "http:") {
+			return "https:" + rawURL[5:], true
+		}
+		return rawURL, true
+	}
+}
+
+// MapHost returns a RewriteFunc crawling the urls of the host from on the host to instead, such as
+// a staging host on the production one. An empty to drops the urls of from, such as those of a mirror.
+func MapHost(from, to string) RewriteFunc {
+	return func(rawURL URL) (URL, bool) {
+		u, err := url.Parse(rawURL)
+		if err != nil || !strings.EqualFold(u.Host, from) {
+			return rawURL, true
+		}
+		if to == "" {
+			return "", false
+		}
+		u.Host = to
+		return u.String(), true
+	}
+}
+
+// rewrite returns url rewritten by the rewrites of the crawler in order, and normalized,
+// reporting false when one of them dropped it.
+func (c *Crawler) rewrite(url URL) (URL, bool) {
+	for _, rewrite := range c.rewrites {
+		var ok bool
+		if url, ok = rewrite(url); !ok {
+			return "", false
+		}
+	}
+	if len(c.rewrites) > 0 {
+		url = c.normalize(url)
+	}
+	return url, true
+}
+
+// hostMapFlag is a flag.Value collecting from=to host pairs into MapHost rewrites, it can be repeated.
+type hostMapFlag struct {
+	rewrites *[]RewriteFunc
+}
+
+func (f *hostMapFlag) String() string {
+	return ""
+}
+
+func (f *hostMapFlag) Set(s string) error {
+	i := strings.IndexByte(s, '=')
+	if i <= 0 {
+		return fmt.Errorf("%q is not from=to", s)
+	}
+	*f.rewrites = append(*f.rewrites, MapHost(s[:i], s[i+1:]))
+	return nil
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SkipRobots is the Stats.Skipped reason of urls disallowed by robots.txt.
+const SkipRobots = "robots.txt"
+
+// maxRobotsSize is the most of a robots.txt file that is read, as recommended by RFC 9309.
+const maxRobotsSize = 500 << 10
+
+// DefaultRobotsRetry is how long a robots.txt that could not be fetched disallows its host, in a Robots
+// without RetryAfter.
+const DefaultRobotsRetry = time.Minute
+
+// MaxCrawlDelay is the longest Crawl-delay of a robots.txt that is honored, longer ones are cut to it.
+const MaxCrawlDelay = time.Minute
+
+// Robots fetches and caches the robots.txt of every host, and tells which urls they allow for UserAgent.
+// A robots.txt that does not exist allows everything, one that cannot be fetched, or fails with a 5xx status,
+// disallows everything until it is fetched again after RetryAfter.
+type Robots struct {
+	// Client fetches the robots.txt files, http.DefaultClient when nil.
+	Client *http.Client
+	// UserAgent is matched against the User-agent lines and sent with the requests, DefaultUserAgent when empty.
+	UserAgent string
+	// RetryAfter is how long a robots.txt that could not be fetched is kept, DefaultRobotsRetry when 0.
+	RetryAfter time.Duration
+
+	lock  sync.Mutex
+	hosts map[string]*robotsEntry
+}
+
+// robotsEntry is the cached robots.txt of a host, ready is closed once rules is set.
+type robotsEntry struct {
+	ready chan struct{}
+	rules *RobotsRules
+	// expires is set when the robots.txt could not be fetched, for it to be fetched again
+	expires time.Time
+}
+
+// stale reports whether the robots.txt of the entry must be fetched again.
+func (e *robotsEntry) stale(now time.Time) bool {
+	select {
+	case <-e.ready:
+		return !e.expires.IsZero() && !now.Before(e.expires)
+	default:
+		return false
+	}
+}
+
+// Allowed reports whether rawURL may be crawled. Urls that do not parse are allowed, fetching them fails anyway,
+// and so are urls other than http and https ones, which have no robots.txt.
+func (r *Robots) Allowed(ctx context.Context, rawURL URL) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return true
+	}
+	rules, err := r.Rules(ctx, u.Scheme+"://"+ToASCIIHost(u.Host))
+	if err != nil {
+		return true
+	}
+	return rules.Allowed(u.RequestURI())
+}
+
+// Rules returns the robots.txt rules of the site at origin, such as "https://golang.org", fetching them once,
+// or again after RetryAfter when they could not be fetched. The error is only set when ctx is done while
+// waiting for them.
+func (r *Robots) Rules(ctx context.Context, origin string) (*RobotsRules, error) {
+	r.lock.Lock()
+	if r.hosts == nil {
+		r.hosts = make(map[string]*robotsEntry)
+	}
+	entry, ok := r.hosts[origin]
+	if ok && entry.stale(time.Now()) {
+		ok = false
+	}
+	if !ok {
+		entry = &robotsEntry{ready: make(chan struct{})}
+		r.hosts[origin] = entry
+	}
+	r.lock.Unlock()
+	if !ok {
+		var fetched bool
+		entry.rules, fetched = r.fetch(ctx, origin)
+		if !fetched {
+			retry := r.RetryAfter
+			if retry <= 0 {
+				retry = DefaultRobotsRetry
+			}
+			entry.expires = time.Now().Add(retry)
+		}
+		close(entry.ready)
+	}
+	select {
+	case <-entry.ready:
+		return entry.rules, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// fetch downloads and parses the robots.txt of origin, reporting false when it could not be fetched.
+func (r *Robots) fetch(ctx context.Context, origin string) (*RobotsRules, bool) {
+	// the robots.txt is shared by every crawl of the host, so it is not bound to the fetch that asked first
+	ctx, cancel := context.WithTimeout(detachedContext{ctx}, 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, origin+"/robots.txt", nil)
+	if err != nil {
+		return disallowAll, false
+	}
+	req.Header.Set("User-Agent", r.userAgent())
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return disallowAll, false
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode <= 299:
+		return ParseRobots(io.LimitReader(resp.Body, maxRobotsSize), r.userAgent()), true
+	case resp.StatusCode >= 400 && resp.StatusCode <= 499:
+		return allowAll, true
+	}
+	return disallowAll, false
+}
+
+func (r *Robots) userAgent() string {
+	if r.UserAgent != "" {
+		return r.UserAgent
+	}
+	return DefaultUserAgent
+}
+
+// RobotsRules are the rules of a robots.txt that apply to one user agent.
+type RobotsRules struct {
+	rules []robotsRule
+	// CrawlDelay is the delay between requests asked for by the Crawl-delay line, if any, up to MaxCrawlDelay.
+	// A RateLimitFetcher with Robots spaces the fetches from the host by at least CrawlDelay.
+	CrawlDelay time.Duration
+	// Sitemaps are the urls of the Sitemap lines, which apply to every user agent.
+	Sitemaps []URL
+}
+
+type robotsRule struct {
+	allow   bool
+	pattern string
+}
+
+var (
+	allowAll    = &RobotsRules{}
+	disallowAll = &RobotsRules{rules: []robotsRule{{allow: false, pattern: "/"}}}
+)
+
+// ParseRobots parses a robots.txt, keeping the rules of the groups matching userAgent,
+// or of the "*" group when none does.
+func ParseRobots(r io.Reader, userAgent string) *RobotsRules {
+	token := strings.ToLower(userAgent)
+	if i := strings.IndexAny(token, "/ "); i >= 0 {
+		token = token[:i]
+	}
+	rules := &RobotsRules{}
+	var matched, wildcard []robotsRule
+	var matchedDelay, wildcardDelay time.Duration
+	// named is set once a group names the user agent, even without rules it then overrides the "*" group
+	named := false
+	// agents of the group being read, a new group starts with a User-agent line following a rule
+	var agents []string
+	inRules := false
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		colon := strings.IndexByte(line, ':')
+		if colon < 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:colon]))
+		value := strings.TrimSpace(line[colon+1:])
+		switch key {
+		case "user-agent":
+			if inRules {
+				agents = nil
+				inRules = false
+			}
+			agent := strings.ToLower(value)
+			agents = append(agents, agent)
+			named = named || (agent != "*" && agentMatches(agent, token))
+		case "allow", "disallow":
+			inRules = true
+			if key == "disallow" && value == "" {
+				// an empty Disallow allows everything
+				continue
+			}
+			rule := robotsRule{allow: key == "allow", pattern: value}
+			for _, agent := range agents {
+				if agent == "*" {
+					wildcard = append(wildcard, rule)
+				} else if agentMatches(agent, token) {
+					matched = append(matched, rule)
+				}
+			}
+		case "crawl-delay":
+			inRules = true
+			seconds, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			for _, agent := range agents {
+				if agent == "*" {
+					wildcardDelay = time.Duration(seconds * float64(time.Second))
+				} else if agentMatches(agent, token) {
+					matchedDelay = time.Duration(seconds * float64(time.Second))
+				}
+			}
+		case "sitemap":
+			rules.Sitemaps = append(rules.Sitemaps, value)
+		}
+	}
+	if named {
+		rules.rules, rules.CrawlDelay = matched, matchedDelay
+	} else {
+		rules.rules, rules.CrawlDelay = wildcard, wildcardDelay
+	}
+	if rules.CrawlDelay > MaxCrawlDelay {
+		rules.CrawlDelay = MaxCrawlDelay
+	}
+	return rules
+}
+
+// agentMatches reports whether the User-agent value agent, in lower case, names the product token of the crawler.
+// The whole token must match as RFC 9309 has it, a version after the token of agent is ignored.
+func agentMatches(agent, token string) bool {
+	if i := strings.IndexAny(agent, "/ "); i >= 0 {
+		agent = agent[:i]
+	}
+	return agent != "" && agent == token
+}
+
+// Allowed reports whether the path, with its query, may be crawled.
+// The longest matching rule wins, and Allow wins between rules of the same length.
+func (rr *RobotsRules) Allowed(path string) bool {
+	allowed := true
+	longest := -1
+	for _, rule := range rr.rules {
+		if !robotsMatch(rule.pattern, path) {
+			continue
+		}
+		if n := len(rule.pattern); n > longest || (n == longest && rule.allow) {
+			longest = n
+			allowed = rule.allow
+		}
+	}
+	return allowed
+}
+
+// robotsMatch matches path against a robots.txt pattern, where '*' matches any run of characters
+// and a trailing '$' anchors the pattern at the end of the path.
+func robotsMatch(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = pattern[:len(pattern)-1]
+	}
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	rest := path[len(parts[0]):]
+	for _, part := range parts[1:] {
+		i := strings.Index(rest, part)
+		if i < 0 {
+			return false
+		}
+		rest = rest[i+len(part):]
+	}
+	if !anchored {
+		return true
+	}
+	if len(parts) == 1 {
+		return rest == ""
+	}
+	// with a wildcard, the last part may match later on so it ends the path
+	return strings.HasSuffix(path, parts[len(parts)-1])
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseRobots(t *testing.T) {
+	tests := []struct {
+		name   string
+		robots string
+		agent  string
+		// paths tell whether every path is allowed
+		paths map[string]bool
+		delay time.Duration
+	}{
+		{
+			name:   "wildcard group",
+			robots: "User-agent: *\nDisallow: /private/\n",
+			agent:  "crawler",
+			paths:  map[string]bool{"/": true, "/private/": false, "/private/a": false, "/privateer": true},
+		},
+		{
+			name:   "named group wins over wildcard",
+			robots: "User-agent: *\nDisallow: /\n\nUser-agent: crawler\nDisallow: /private/\n",
+			agent:  "Crawler/1.0 (+https://example.com)",
+			paths:  map[string]bool{"/": true, "/private/": false},
+		},
+		{
+			name:   "named group without rules",
+			robots: "User-agent: *\nDisallow: /\n\nUser-agent: crawler\nCrawl-delay: 2\n",
+			agent:  "crawler",
+			paths:  map[string]bool{"/": true},
+			delay:  2 * time.Second,
+		},
+		{
+			name:   "prefix of the token does not match",
+			robots: "User-agent: c\nDisallow: /\n\nUser-agent: crawlerbot\nDisallow: /\n",
+			agent:  "crawler",
+			paths:  map[string]bool{"/": true},
+		},
+		{
+			name:   "version of the group ignored",
+			robots: "User-agent: Crawler/2.0\nDisallow: /a\n",
+			agent:  "crawler/1.0",
+			paths:  map[string]bool{"/a": false, "/b": true},
+		},
+		{
+			name:   "groups with several agents and merged groups",
+			robots: "User-agent: other\nUser-agent: crawler\nDisallow: /a\n\nUser-agent: crawler\nDisallow: /b\n",
+			agent:  "crawler",
+			paths:  map[string]bool{"/a": false, "/b": false, "/c": true},
+		},
+		{
+			name:   "longest match wins",
+			robots: "User-agent: *\nDisallow: /docs/\nAllow: /docs/public/\n",
+			agent:  "crawler",
+			paths:  map[string]bool{"/docs/a": false, "/docs/public/a": true},
+		},
+		{
+			name:   "allow wins a tie",
+			robots: "User-agent: *\nDisallow: /page\nAllow: /page\n",
+			agent:  "crawler",
+			paths:  map[string]bool{"/page": true},
+		},
+		{
+			name:   "wildcards and anchors",
+			robots: "User-agent: *\nDisallow: /*.pdf$\nDisallow: /search*q=\n",
+			agent:  "crawler",
+			paths:  map[string]bool{"/a.pdf": false, "/a.pdf?x": true, "/b/c.pdf": false, "/search?q=go": false, "/search": true},
+		},
+		{
+			name:   "empty disallow and comments",
+			robots: "# robots\nUser-agent: * # everyone\nDisallow:\n",
+			agent:  "crawler",
+			paths:  map[string]bool{"/": true, "/a": true},
+		},
+		{
+			name:   "crawl delay of the wildcard group",
+			robots: "User-agent: *\nCrawl-delay: 0.5\n\nUser-agent: other\nCrawl-delay: 10\n",
+			agent:  "crawler",
+			paths:  map[string]bool{"/": true},
+			delay:  500 * time.Millisecond,
+		},
+		{
+			name:   "crawl delay cut to the maximum",
+			robots: "User-agent: *\nCrawl-delay: 86400\n",
+			agent:  "crawler",
+			paths:  map[string]bool{"/": true},
+			delay:  MaxCrawlDelay,
+		},
+	}
+	for _, test := range tests {
+		rules := ParseRobots(strings.NewReader(test.robots), test.agent)
+		for path, allowed := range test.paths {
+			if got := rules.Allowed(path); got != allowed {
+				t.Errorf("%s: Allowed(%q) = %t, want %t", test.name, path, got, allowed)
+			}
+		}
+		if rules.CrawlDelay != test.delay {
+			t.Errorf("%s: CrawlDelay = %s, want %s", test.name, rules.CrawlDelay, test.delay)
+		}
+	}
+}
+
+func TestParseRobotsSitemaps(t *testing.T) {
+	robots := "Sitemap: https://example.com/a.xml\nUser-agent: other\nDisallow: /\nSitemap: https://example.com/b.xml\n"
+	rules := ParseRobots(strings.NewReader(robots), "crawler")
+	if len(rules.Sitemaps) != 2 || rules.Sitemaps[0] != "https://example.com/a.xml" || rules.Sitemaps[1] != "https://example.com/b.xml" {
+		t.Errorf("Sitemaps = %q, want both sitemaps", rules.Sitemaps)
+	}
+}
+
+// robotsTransport answers the requests for robots.txt files with the responses of responses in turn, the last one
+// repeating, a nil one failing the request.
+type robotsTransport struct {
+	mu        sync.Mutex
+	responses []*robotsResponse
+	requests  int
+}
+
+type robotsResponse struct {
+	status int
+	body   string
+}
+
+func (rt *robotsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	resp := rt.responses[min(rt.requests, len(rt.responses)-1)]
+	rt.requests++
+	if resp == nil {
+		return nil, errors.New("connection refused")
+	}
+	return &http.Response{StatusCode: resp.status, Body: io.NopCloser(strings.NewReader(resp.body)), Request: req}, nil
+}
+
+func (rt *robotsTransport) count() int {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	return rt.requests
+}
+
+func newTestRobots(retry time.Duration, responses ...*robotsResponse) (*Robots, *robotsTransport) {
+	rt := &robotsTransport{responses: responses}
+	return &Robots{Client: &http.Client{Transport: rt}, UserAgent: "crawler", RetryAfter: retry}, rt
+}
+
+func TestRobotsFetch(t *testing.T) {
+	disallow := &robotsResponse{200, "User-agent: *\nDisallow: /private/\n"}
+	tests := []struct {
+		name      string
+		responses []*robotsResponse
+		allowed   bool
+	}{
+		{"found", []*robotsResponse{disallow}, false},
+		{"not found", []*robotsResponse{{404, ""}}, true},
+		{"server error", []*robotsResponse{{503, ""}}, false},
+		{"unreachable", []*robotsResponse{nil}, false},
+	}
+	for _, test := range tests {
+		robots, rt := newTestRobots(time.Hour, test.responses...)
+		for i := 0; i < 3; i++ {
+			if got := robots.Allowed(context.Background(), "https://example.com/private/a"); got != test.allowed {
+				t.Errorf("%s: Allowed = %t, want %t", test.name, got, test.allowed)
+			}
+		}
+		if !robots.Allowed(context.Background(), "ftp://example.com/private/a") {
+			t.Errorf("%s: ftp url disallowed", test.name)
+		}
+		if n := rt.count(); n != 1 {
+			t.Errorf("%s: robots.txt fetched %d times, want 1", test.name, n)
+		}
+	}
+}
+
+func TestRobotsRetriesFailures(t *testing.T) {
+	for _, failure := range []*robotsResponse{nil, {500, ""}} {
+		robots, rt := newTestRobots(20*time.Millisecond, failure, &robotsResponse{200, "User-agent: *\nDisallow: /private/\n"})
+		if robots.Allowed(context.Background(), "https://example.com/public") {
+			t.Errorf("failure %v: allowed before the retry", failure)
+		}
+		time.Sleep(30 * time.Millisecond)
+		if !robots.Allowed(context.Background(), "https://example.com/public") {
+			t.Errorf("failure %v: disallowed after the retry", failure)
+		}
+		if robots.Allowed(context.Background(), "https://example.com/private/a") {
+			t.Errorf("failure %v: rules of the retry not applied", failure)
+		}
+		time.Sleep(30 * time.Millisecond)
+		robots.Allowed(context.Background(), "https://example.com/public")
+		if n := rt.count(); n != 2 {
+			t.Errorf("failure %v: robots.txt fetched %d times, want 2", failure, n)
+		}
+	}
+}
+
+func TestCrawlRobots(t *testing.T) {
+	tests := []struct {
+		name   string
+		robots bool
+		// skipped is whether https://golang.org/pkg/os/ is skipped
+		skipped bool
+	}{
+		{"with robots", true, true},
+		// -ignore-robots crawls without WithRobots
+		{"without robots", false, false},
+	}
+	for _, test := range tests {
+		var opts []Option
+		if test.robots {
+			robots, _ := newTestRobots(time.Hour, &robotsResponse{200, "User-agent: *\nDisallow: /pkg/os/\n"})
+			opts = append(opts, WithRobots(robots))
+		}
+		result := NewCrawler(fetcher, opts...).Crawl(context.Background(), "https://golang.org/")
+		fetched := false
+		for _, page := range result.Pages {
+			fetched = fetched || page.URL == "https://golang.org/pkg/os/"
+		}
+		if fetched == test.skipped {
+			t.Errorf("%s: https://golang.org/pkg/os/ fetched = %t, want %t", test.name, fetched, !test.skipped)
+		}
+		if want := map[bool]int{true: 1}[test.skipped]; result.Stats.Skipped[SkipRobots] != want {
+			t.Errorf("%s: Skipped[%s] = %d, want %d", test.name, SkipRobots, result.Stats.Skipped[SkipRobots], want)
+		}
+	}
+}
+
+func TestRateLimitFetcherCrawlDelay(t *testing.T) {
+	tests := []struct {
+		name   string
+		delay  time.Duration
+		robots string
+		// wait is the least time the second fetch waits for
+		wait time.Duration
+	}{
+		{"crawl delay longer than delay", 0, "User-agent: *\nCrawl-delay: 0.05\n", 50 * time.Millisecond},
+		{"delay longer than crawl delay", 50 * time.Millisecond, "User-agent: *\nCrawl-delay: 0.001\n", 50 * time.Millisecond},
+		{"no crawl delay", 0, "User-agent: *\nDisallow:\n", 0},
+	}
+	for _, test := range tests {
+		robots, _ := newTestRobots(time.Hour, &robotsResponse{200, test.robots})
+		f := &RateLimitFetcher{Delegate: fetcher, Delay: test.delay, Robots: robots}
+		start := time.Now()
+		f.Fetch("https://golang.org/")
+		f.Fetch("https://golang.org/pkg/")
+		if elapsed := time.Since(start); elapsed < test.wait || test.wait == 0 && elapsed > 40*time.Millisecond {
+			t.Errorf("%s: fetches took %s, want %s", test.name, elapsed, test.wait)
+		}
+	}
+}
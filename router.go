@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"regexp"
+)
+
+// PageHandler extracts data from a crawled page, such as the price of a product page. The data is reported
+// in PageResult.Data, and the error in PageResult.HandlerErr. Handlers are called by the workers, concurrently,
+// and only for the pages fetched without error.
+type PageHandler func(ctx context.Context, page PageResult) (interface{}, error)
+
+// Router hands the crawled pages to the PageHandler of the first of its routes matching their url, so one crawl
+// drives several extractions, such as a price extractor for product pages and a date extractor for blog posts.
+// The zero value routes no page. Routes must not be added once the crawl started.
+type Router struct {
+	routes []route
+	// Default handles the pages matching no route, when not nil.
+	Default PageHandler
+}
+
+// route is a route of a Router.
+type route struct {
+	name    string
+	pattern *regexp.Regexp
+	handler PageHandler
+}
+
+// Handle routes the pages whose url matches pattern to handler, reporting name in PageResult.Route.
+// Patterns can be compiled with CompileGlob to match paths.
+func (r *Router) Handle(name string, pattern *regexp.Regexp, handler PageHandler) {
+	r.routes = append(r.routes, route{name: name, pattern: pattern, handler: handler})
+}
+
+// Route returns the name and the handler of the first route matching url, or Default with an empty name,
+// reporting false when there is neither.
+func (r *Router) Route(url URL) (string, PageHandler, bool) {
+	for _, route := range r.routes {
+		if route.pattern.MatchString(url) {
+			return route.name, route.handler, true
+		}
+	}
+	return "", r.Default, r.Default != nil
+}
+
+// ExtractMatch returns a PageHandler extracting the submatches of the first match of re in the body of the pages,
+// or the whole match when re has no group. The pages where re does not match have no data.
+func ExtractMatch(re *regexp.Regexp) PageHandler {
+	return func(ctx context.Context, page PageResult) (interface{}, error) {
+		match := re.FindStringSubmatch(page.Body)
+		if match == nil {
+			return nil, nil
+		}
+		if len(match) == 1 {
+			return match, nil
+		}
+		return match[1:], nil
+	}
+}
+
+// route runs the handler the router of the crawler routes the page of o to, if any.
+func (r *run) route(ctx context.Context, o *outcome) {
+	name, handler, ok := r.c.router.Route(o.task.URL)
+	if !ok {
+		return
+	}
+	o.route = name
+	o.data, o.handlerErr = handler(ctx, PageResult{
+		URL:    o.task.URL,
+		Body:   o.body,
+		Links:  o.urls,
+		Depth:  o.task.Depth,
+		Parent: o.task.Parent,
+		Meta:   o.meta,
+	})
+}
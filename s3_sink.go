@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultS3KeyLayout is the key layout of an S3Sink without KeyLayout.
+	DefaultS3KeyLayout = "{host}/{hash}"
+	// DefaultS3Concurrency is the number of uploads an S3Sink without Concurrency runs at once.
+	DefaultS3Concurrency = 4
+)
+
+// S3Sink uploads the body and the PageRecord of every page to an S3 compatible bucket, such as AWS S3, MinIO or
+// R2, as the objects key.body and key.json, so a crawl running on an ephemeral worker keeps its results.
+// Requests are signed with AWS Signature Version 4. The uploads run in the background, Close waits for them.
+type S3Sink struct {
+	// Endpoint is the url of the service, https://s3.Region.amazonaws.com when empty.
+	Endpoint string
+	// Region is the region of the bucket, us-east-1 when empty.
+	Region string
+	Bucket string
+	// AccessKey, SecretKey and SessionToken are the credentials signing the requests, the SessionToken
+	// of temporary credentials only.
+	AccessKey, SecretKey, SessionToken string
+	// PathStyle addresses the bucket in the path of the urls, as most S3 compatible services need,
+	// instead of in the host.
+	PathStyle bool
+	// KeyLayout is the key of the objects of a page, DefaultS3KeyLayout when empty. {host}, {path}, {hash} and
+	// {date} are replaced by the host of the url of the page, its path, the hex SHA-256 of the url, and the date
+	// of the upload as 2006-01-02.
+	KeyLayout string
+	// Gzip compresses the bodies, uploaded as key.body.gz with a gzip Content-Encoding.
+	Gzip bool
+	// Concurrency is the number of uploads running at once, DefaultS3Concurrency when not positive.
+	Concurrency int
+	// Client sends the requests, http.DefaultClient when nil.
+	Client *http.Client
+
+	once    sync.Once
+	uploads chan s3Object
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	// err is the first error of an upload
+	err error
+}
+
+// s3Object is an object waiting to be uploaded.
+type s3Object struct {
+	key         string
+	body        []byte
+	contentType string
+	gzipped     bool
+}
+
+// Write is the implementation of Sink for S3Sink, it queues the objects of page for upload and returns
+// the first error of the uploads so far.
+func (s *S3Sink) Write(page PageResult) error {
+	s.once.Do(s.start)
+	key := s.key(page)
+	record, err := json.Marshal(NewPageRecord(page))
+	if err != nil {
+		return err
+	}
+	if page.Err == nil {
+		body := s3Object{key: key + ".body", body: []byte(page.Body), contentType: page.Meta.Header.Get("Content-Type")}
+		if s.Gzip {
+			var buf bytes.Buffer
+			zw := gzip.NewWriter(&buf)
+			zw.Write(body.body)
+			zw.Close()
+			body.key, body.body, body.gzipped = body.key+".gz", buf.Bytes(), true
+		}
+		s.uploads <- body
+	}
+	s.uploads <- s3Object{key: key + ".json", body: record, contentType: "application/json"}
+	return s.firstErr()
+}
+
+// Close is the implementation of Sink for S3Sink, it waits for the uploads to finish.
+func (s *S3Sink) Close() error {
+	s.once.Do(s.start)
+	close(s.uploads)
+	s.wg.Wait()
+	return s.firstErr()
+}
+
+func (s *S3Sink) start() {
+	concurrency := s.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultS3Concurrency
+	}
+	s.uploads = make(chan s3Object, concurrency)
+	for i := 0; i < concurrency; i++ {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			for object := range s.uploads {
+				if err := s.put(object); err != nil {
+					s.mu.Lock()
+					if s.err == nil {
+						s.err = err
+					}
+					s.mu.Unlock()
+				}
+			}
+		}()
+	}
+}
+
+func (s *S3Sink) firstErr() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// key returns the key of the objects of page, without their extensions.
+func (s *S3Sink) key(page PageResult) string {
+	layout := s.KeyLayout
+	if layout == "" {
+		layout = DefaultS3KeyLayout
+	}
+	host, path := "", ""
+	if u, err := url.Parse(page.URL); err == nil {
+		host, path = strings.ReplaceAll(u.Host, ":", "_"), strings.TrimPrefix(u.Path, "/")
+	}
+	if path == "" || strings.HasSuffix(path, "/") {
+		path += "index"
+	}
+	sum := sha256.Sum256([]byte(page.URL))
+	return strings.NewReplacer(
+		"{host}", host,
+		"{path}", path,
+		"{hash}", hex.EncodeToString(sum[:]),
+		"{date}", time.Now().UTC().Format("2006-01-02"),
+	).Replace(layout)
+}
+
+// put uploads object with a PUT request.
+func (s *S3Sink) put(object s3Object) error {
+	endpoint := s.Endpoint
+	region := s.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	if endpoint == "" {
+		endpoint = "https://s3." + region + ".amazonaws.com"
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return err
+	}
+	key := object.key
+	if s.PathStyle {
+		key = s.Bucket + "/" + key
+	} else {
+		u.Host = s.Bucket + "." + u.Host
+	}
+	// the path is sent escaped as it is signed
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = awsEscape(segment)
+	}
+	u.Path, u.RawPath = strings.TrimSuffix(u.Path, "/")+"/"+key, strings.TrimSuffix(u.EscapedPath(), "/")+"/"+strings.Join(segments, "/")
+	req, err := http.NewRequest(http.MethodPut, u.String(), bytes.NewReader(object.body))
+	if err != nil {
+		return err
+	}
+	if object.contentType != "" {
+		req.Header.Set("Content-Type", object.contentType)
+	}
+	if object.gzipped {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+	signV4(req, object.body, s.AccessKey, s.SecretKey, region, "s3", time.Now())
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return fmt.Errorf("put s3://%s/%s: %s: %s", s.Bucket, object.key, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// signV4 signs req, whose body is payload, with AWS Signature Version 4 for service in region, at t.
+// Every header of req is signed, along with its host.
+func signV4(req *http.Request, payload []byte, accessKey, secretKey, region, service string, t time.Time) {
+	t = t.UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+	payloadHash := sha256.Sum256(payload)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.Join(values, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.Join(strings.Fields(headers[name]), " ") + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+	key := []byte("AWS4" + secretKey)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// canonicalQuery returns the query of a Signature Version 4 canonical request, sorted and escaped.
+func canonicalQuery(query url.Values) string {
+	var params []string
+	for name, values := range query {
+		for _, value := range values {
+			params = append(params, awsEscape(name)+"="+awsEscape(value))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+// awsEscape escapes s as Signature Version 4 does, all but the unreserved characters of RFC 3986.
+func awsEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// SchemeFetcher routes every url to the Fetcher registered for its scheme, such as "https" or "file".
+type SchemeFetcher map[string]Fetcher
+
+// Fetch is the implementation of Fetcher for SchemeFetcher.
+func (f SchemeFetcher) Fetch(url string) (body string, urls []string, err error) {
+	return f.FetchContext(context.Background(), url)
+}
+
+// FetchContext is the implementation of ContextFetcher for SchemeFetcher.
+func (f SchemeFetcher) FetchContext(ctx context.Context, rawURL string) (body string, urls []string, err error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", nil, err
+	}
+	fetcher, ok := f[strings.ToLower(u.Scheme)]
+	if !ok {
+		return "", nil, fmt.Errorf("%s: unsupported scheme %q", rawURL, u.Scheme)
+	}
+	return fetchContext(ctx, fetcher, rawURL)
+}
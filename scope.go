@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Scope decides which of the links found a crawl follows, relative to its seeds.
+type Scope int
+
+const (
+	// ScopeOpen follows links to any host.
+	ScopeOpen Scope = iota
+	// ScopeHost only follows links to the hosts of the seeds.
+	ScopeHost
+	// ScopeDomain only follows links to the registrable domains of the seeds and their subdomains,
+	// such as blog.golang.org from a golang.org seed.
+	ScopeDomain
+)
+
+// ParseScope returns the Scope named open, host or domain.
+func ParseScope(name string) (Scope, error) {
+	switch name {
+	case "open":
+		return ScopeOpen, nil
+	case "host":
+		return ScopeHost, nil
+	case "domain":
+		return ScopeDomain, nil
+	}
+	return 0, fmt.Errorf("unknown scope %q", name)
+}
+
+// key returns what rawURL is compared on within the scope, reporting false when it has no host.
+func (s Scope) key(rawURL URL) (string, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return "", false
+	}
+	host := ToASCIIHost(u.Hostname())
+	if s == ScopeDomain {
+		return registrableDomain(host), true
+	}
+	return host, true
+}
+
+// registrableDomain returns the domain of host that can be registered according to DefaultPublicSuffixList,
+// or host itself when it is an IP address or a public suffix.
+func registrableDomain(host string) string {
+	if strings.Contains(host, ":") || isIPv4(host) {
+		return host
+	}
+	return DefaultPublicSuffixList.RegistrableDomain(host)
+}
+
+// isIPv4 reports whether host is a dotted IPv4 address.
+func isIPv4(host string) bool {
+	parts := strings.Split(host, ".")
+	if len(parts) != 4 {
+		return false
+	}
+	for _, part := range parts {
+		if part == "" || strings.Trim(part, "0123456789") != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// internalScope returns the scope telling the internal links from the external ones, the scope of the crawler,
+// or ScopeHost when it is open.
+func (c *Crawler) internalScope() Scope {
+	if c.scope == ScopeOpen {
+		return ScopeHost
+	}
+	return c.scope
+}
+
+// addScope adds the host or domain of the seed url to the scope of the run.
+func (r *run) addScope(url URL) {
+	if r.c.scope == ScopeOpen && r.c.externalDepth == 0 {
+		return
+	}
+	if key, ok := r.c.internalScope().key(url); ok {
+		r.scopes[key] = true
+	}
+}
+
+// internal reports whether the link url is within the scope of the run, see internalScope.
+func (r *run) internal(url URL) bool {
+	key, ok := r.c.internalScope().key(url)
+	return ok && r.scopes[key]
+}
+
+// inScope reports whether the link url may be followed according to the scope of the run: when it is within it,
+// or anywhere with ScopeOpen or an external depth.
+func (r *run) inScope(url URL) bool {
+	if r.c.scope == ScopeOpen || r.c.externalDepth > 0 {
+		return true
+	}
+	return r.internal(url)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// PatternWeight is the weight WeightedScore adds to the score of the urls matching Pattern.
+type PatternWeight struct {
+	Pattern *regexp.Regexp
+	Weight  int
+}
+
+// WeightedScore returns a ScoreFunc for WithPriority adding up the weights of the patterns an url matches,
+// such as 10 for /docs/** and -10 for /tag/**, and taking depthWeight off for every link between the seed
+// and the url, so shallow pages are preferred. Combined with WithMaxPages, the crawl fetches the most valuable pages.
+func WeightedScore(depthWeight int, weights ...PatternWeight) ScoreFunc {
+	return func(url URL, depth int, parent URL) int {
+		score := -depth * depthWeight
+		for _, w := range weights {
+			if w.Pattern.MatchString(url) {
+				score += w.Weight
+			}
+		}
+		return score
+	}
+}
+
+// weightsFlag is a flag.Value collecting glob=weight pairs, it can be repeated.
+type weightsFlag struct {
+	weights *[]PatternWeight
+}
+
+func (f *weightsFlag) String() string {
+	return ""
+}
+
+func (f *weightsFlag) Set(s string) error {
+	i := strings.LastIndexByte(s, '=')
+	if i <= 0 {
+		return fmt.Errorf("%q is not glob=weight", s)
+	}
+	weight, err := strconv.Atoi(s[i+1:])
+	if err != nil {
+		return fmt.Errorf("%q is not glob=weight", s)
+	}
+	pattern, err := CompileGlob(s[:i])
+	if err != nil {
+		return err
+	}
+	*f.weights = append(*f.weights, PatternWeight{Pattern: pattern, Weight: weight})
+	return nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// ReadSeeds reads the seeds listed in r, one url per line. Blank lines, lines starting with # and what follows
+// the url on its line are ignored, so lists can be commented. Sitemaps, gzipped or not, are read as lists of
+// their page urls. Every url must be absolute, and duplicates are dropped.
+func ReadSeeds(r io.Reader) ([]URL, error) {
+	body, err := decompressSitemap(r)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(body)
+	if isXML(br) {
+		return readSitemapSeeds(br)
+	}
+	var seeds []URL
+	scanner := bufio.NewScanner(br)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if err := checkSeed(fields[0]); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		seeds = append(seeds, fields[0])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return uniqueURLs(seeds), nil
+}
+
+// isXML reports whether the document read by br starts like an XML one.
+func isXML(br *bufio.Reader) bool {
+	for {
+		c, err := br.ReadByte()
+		if err != nil {
+			return false
+		}
+		if !isHTMLSpace(c) && c != 0xef && c != 0xbb && c != 0xbf {
+			// the space and the byte order mark read are not needed
+			br.UnreadByte()
+			return c == '<'
+		}
+	}
+}
+
+// readSitemapSeeds returns the page urls of the sitemap read from r.
+func readSitemapSeeds(r io.Reader) ([]URL, error) {
+	doc := &sitemapDoc{}
+	if err := xml.NewDecoder(io.LimitReader(r, maxSitemapSize)).Decode(doc); err != nil {
+		return nil, fmt.Errorf("sitemap: %w", err)
+	}
+	if len(doc.URLs) == 0 && len(doc.Sitemaps) > 0 {
+		return nil, errors.New("sitemap: a sitemap index lists sitemaps, not pages")
+	}
+	var seeds []URL
+	for _, loc := range doc.URLs {
+		seed := strings.TrimSpace(loc.Loc)
+		if err := checkSeed(seed); err != nil {
+			return nil, fmt.Errorf("sitemap: %w", err)
+		}
+		seeds = append(seeds, seed)
+	}
+	return uniqueURLs(seeds), nil
+}
+
+// checkSeed fails when seed is not an absolute url with a host, or a file url.
+func checkSeed(seed string) error {
+	u, err := url.Parse(seed)
+	if err != nil {
+		return err
+	}
+	if !u.IsAbs() || u.Host == "" && u.Scheme != "file" {
+		return fmt.Errorf("seed %q is not an absolute url", seed)
+	}
+	return nil
+}
+
+// uniqueURLs returns urls without the duplicates, in order.
+func uniqueURLs(urls []URL) []URL {
+	seen := make(map[URL]bool, len(urls))
+	unique := urls[:0]
+	for _, u := range urls {
+		if !seen[u] {
+			seen[u] = true
+			unique = append(unique, u)
+		}
+	}
+	return unique
+}
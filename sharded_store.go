@@ -0,0 +1,106 @@
+package main
+
+// DefaultShards is the number of shards of a ShardedStore created with less than one.
+const DefaultShards = 16
+
+// ShardedStore is a CacheStore spreading the results over MapStores by the hash of their url,
+// so workers fetching different urls rarely wait on the same lock.
+// Each shard evicts its own least recently used results, so eviction is only approximately least recently used.
+type ShardedStore struct {
+	// Shards are the stores of the results, picked by the hash of the url.
+	Shards []*MapStore
+}
+
+// NewShardedStore returns a ShardedStore of n MapStores, sharing the bounds maxEntries and maxBytes.
+// There are fewer shards when a bound is below n, so none of them is left with a bound of 0, which is no bound.
+func NewShardedStore(n int, maxEntries int, maxBytes int64) *ShardedStore {
+	if n < 1 {
+		n = DefaultShards
+	}
+	if maxEntries > 0 && n > maxEntries {
+		n = maxEntries
+	}
+	if maxBytes > 0 && int64(n) > maxBytes {
+		n = int(maxBytes)
+	}
+	s := &ShardedStore{Shards: make([]*MapStore, n)}
+	for i := range s.Shards {
+		// the bounds are split evenly, the first shards getting the extra units, 0 keeps them unbounded
+		shard := &MapStore{MaxEntries: maxEntries / n, MaxBytes: maxBytes / int64(n)}
+		if i < maxEntries%n {
+			shard.MaxEntries++
+		}
+		if int64(i) < maxBytes%int64(n) {
+			shard.MaxBytes++
+		}
+		s.Shards[i] = shard
+	}
+	return s
+}
+
+// shard returns the shard of url.
+func (s *ShardedStore) shard(url URL) *MapStore {
+	// FNV-1a, inlined so picking a shard does not allocate
+	h := uint32(2166136261)
+	for i := 0; i < len(url); i++ {
+		h ^= uint32(url[i])
+		h *= 16777619
+	}
+	return s.Shards[h%uint32(len(s.Shards))]
+}
+
+// Get is the implementation of CacheStore for ShardedStore.
+func (s *ShardedStore) Get(url URL) (*FetchResult, bool) {
+	return s.shard(url).Get(url)
+}
+
+// Set is the implementation of CacheStore for ShardedStore.
+func (s *ShardedStore) Set(url URL, result *FetchResult) {
+	s.shard(url).Set(url, result)
+}
+
+// Delete is the implementation of CacheStore for ShardedStore.
+func (s *ShardedStore) Delete(url URL) {
+	s.shard(url).Delete(url)
+}
+
+// Len is the implementation of CacheStore for ShardedStore.
+func (s *ShardedStore) Len() int {
+	n := 0
+	for _, shard := range s.Shards {
+		n += shard.Len()
+	}
+	return n
+}
+
+// Range is the implementation of CacheRanger for ShardedStore, one shard at a time.
+func (s *ShardedStore) Range(fn func(url URL, result *FetchResult) bool) {
+	more := true
+	for _, shard := range s.Shards {
+		shard.Range(func(url URL, result *FetchResult) bool {
+			more = fn(url, result)
+			return more
+		})
+		if !more {
+			return
+		}
+	}
+}
+
+// Bytes returns the size of the results of all the shards.
+func (s *ShardedStore) Bytes() int64 {
+	var n int64
+	for _, shard := range s.Shards {
+		n += shard.Bytes()
+	}
+	return n
+}
+
+// Evictions returns the number of results evicted by all the shards.
+func (s *ShardedStore) Evictions() int {
+	n := 0
+	for _, shard := range s.Shards {
+		n += shard.Evictions()
+	}
+	return n
+}
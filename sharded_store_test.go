@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+// benchmarkStore gets and sets results of store from 64 goroutines per CPU, a set for every 8 gets,
+// with more urls than the store keeps so it evicts.
+func benchmarkStore(b *testing.B, store CacheStore) {
+	urls := make([]URL, 1<<14)
+	for i := range urls {
+		urls[i] = "https://example.com/page/" + strconv.Itoa(i)
+	}
+	result := &FetchResult{body: "<html>page</html>"}
+	var next uint32
+	b.SetParallelism(64)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := atomic.AddUint32(&next, 7919)
+		for pb.Next() {
+			i++
+			url := urls[i%uint32(len(urls))]
+			if i%9 == 0 {
+				store.Set(url, result)
+			} else {
+				store.Get(url)
+			}
+		}
+	})
+}
+
+func BenchmarkMapStore(b *testing.B) {
+	benchmarkStore(b, &MapStore{MaxEntries: 1 << 13})
+}
+
+func BenchmarkShardedStore(b *testing.B) {
+	benchmarkStore(b, NewShardedStore(DefaultShards, 1<<13, 0))
+}
+
+func TestShardedStoreBounds(t *testing.T) {
+	result := &FetchResult{body: "<html>page</html>"}
+	size := result.size("https://example.com/page/0000")
+	tests := []struct {
+		name       string
+		maxEntries int
+		maxBytes   int64
+		// the results are spread unevenly over the shards, some shards evict while others have room left
+		minLen, maxLen int
+	}{
+		{"entries above the shards", 100, 0, 50, 100},
+		{"entries below the shards", 4, 0, 1, 4},
+		{"bytes above the shards", 0, 100 * size, 50, 100},
+		// a shard bound below the size of a result keeps none
+		{"bytes below the shards", 0, 10, 0, 0},
+		{"both", 8, 100 * size, 1, 8},
+	}
+	for _, test := range tests {
+		s := NewShardedStore(DefaultShards, test.maxEntries, test.maxBytes)
+		for i := 0; i < 1000; i++ {
+			s.Set(URL(fmt.Sprintf("https://example.com/page/%04d", i)), result)
+		}
+		if got := s.Len(); got < test.minLen || got > test.maxLen {
+			t.Errorf("%s: Len() = %d, want between %d and %d", test.name, got, test.minLen, test.maxLen)
+		}
+		if got := int64(s.Len()) * size; got != s.Bytes() {
+			t.Errorf("%s: Bytes() = %d, want %d for %d results", test.name, s.Bytes(), got, s.Len())
+		}
+		if test.maxBytes > 0 && s.Bytes() > test.maxBytes {
+			t.Errorf("%s: Bytes() = %d, want at most %d", test.name, s.Bytes(), test.maxBytes)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Sink receives the pages of a crawl as they are crawled, see WithSink. The export formats are Sinks.
+type Sink interface {
+	// Write records a crawled page.
+	Write(page PageResult) error
+	// Close flushes the pages written, the Sink is not written to afterwards.
+	Close() error
+}
+
+// LifecycleSink is a Sink also told when the crawls it is given to with WithSink start and end.
+type LifecycleSink interface {
+	Sink
+	// Start is called when a crawl of seeds starts, before its first page is written.
+	Start(seeds []URL) error
+	// Finish is called with the result of the crawl once its last page was written, Pages excepted.
+	Finish(result *CrawlResult) error
+}
+
+// PageRecord is the serialized form of a PageResult written by the sinks of structured formats.
+type PageRecord struct {
+	URL         URL
+	Depth       int
+	Parent      URL    `json:",omitempty"`
+	StatusCode  int    `json:",omitempty"`
+	Title       string `json:",omitempty"`
+	Error       string `json:",omitempty"`
+	Links       []URL  `json:",omitempty"`
+	DuplicateOf URL    `json:",omitempty"`
+	Canonical   URL    `json:",omitempty"`
+	NoIndex     bool   `json:",omitempty"`
+	External    bool   `json:",omitempty"`
+	Route       string `json:",omitempty"`
+	// Latency is the time the response took to start arriving, in nanoseconds.
+	Latency time.Duration `json:",omitempty"`
+	// Data is what the handler of the page extracted from it, it must marshal to JSON.
+	Data interface{} `json:",omitempty"`
+}
+
+// NewPageRecord returns the PageRecord of page.
+func NewPageRecord(page PageResult) PageRecord {
+	record := PageRecord{
+		URL:         page.URL,
+		Depth:       page.Depth,
+		Parent:      page.Parent,
+		StatusCode:  page.Meta.StatusCode,
+		Title:       page.Meta.Title,
+		Links:       page.Links,
+		DuplicateOf: page.DuplicateOf,
+		Canonical:   page.Canonical,
+		NoIndex:     page.NoIndex,
+		External:    page.External,
+		Route:       page.Route,
+		Data:        page.Data,
+		Latency:     page.Meta.Latency,
+	}
+	if page.Err != nil {
+		record.Error = page.Err.Error()
+	}
+	return record
+}
+
+// TextSink writes a line per page to W, os.Stdout when nil, as the crawler command prints them:
+// the url and the body of the page, or its error.
+type TextSink struct {
+	W io.Writer
+}
+
+// Write is the implementation of Sink for TextSink.
+func (s *TextSink) Write(page PageResult) error {
+	w := s.W
+	if w == nil {
+		w = os.Stdout
+	}
+	var err error
+	switch {
+	case page.Err != nil && page.Parent != "":
+		_, err = fmt.Fprintf(w, "%v (linked from %s)\n", page.Err, DisplayURL(page.Parent))
+	case page.Err != nil:
+		_, err = fmt.Fprintln(w, page.Err)
+	case page.DuplicateOf != "":
+		_, err = fmt.Fprintf(w, "duplicate: %s of %s\n", DisplayURL(page.URL), DisplayURL(page.DuplicateOf))
+	default:
+		_, err = fmt.Fprintf(w, "found: %s %q\n", DisplayURL(page.URL), page.Body)
+	}
+	return err
+}
+
+// Close is the implementation of Sink for TextSink.
+func (s *TextSink) Close() error {
+	return nil
+}
+
+// JSONSink writes the pages to W as a JSON array of PageRecords, a record per line.
+// The array is only complete once the JSONSink is closed.
+type JSONSink struct {
+	W io.Writer
+
+	// written is the number of pages written
+	written int
+}
+
+// Write is the implementation of Sink for JSONSink.
+func (s *JSONSink) Write(page PageResult) error {
+	data, err := json.Marshal(NewPageRecord(page))
+	if err != nil {
+		return err
+	}
+	sep := ",\n"
+	if s.written == 0 {
+		sep = "[\n"
+	}
+	s.written++
+	_, err = fmt.Fprintf(s.W, "%s%s", sep, data)
+	return err
+}
+
+// Close is the implementation of Sink for JSONSink, it ends the array.
+func (s *JSONSink) Close() error {
+	end := "\n]\n"
+	if s.written == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(s.W, end)
+	return err
+}
+
+// JSONLinesSink writes the pages to W as JSON Lines, a PageRecord per line, for tools such as jq
+// or the bulk loaders of databases. Unlike the output of a JSONSink, the lines written so far are valid
+// if the crawl is interrupted.
+type JSONLinesSink struct {
+	W io.Writer
+}
+
+// Write is the implementation of Sink for JSONLinesSink.
+func (s *JSONLinesSink) Write(page PageResult) error {
+	data, err := json.Marshal(NewPageRecord(page))
+	if err != nil {
+		return err
+	}
+	_, err = s.W.Write(append(data, '\n'))
+	return err
+}
+
+// Close is the implementation of Sink for JSONLinesSink.
+func (s *JSONLinesSink) Close() error {
+	return nil
+}
+
+// NullSink discards the pages, for crawls run for their side effects, such as filling a cache.
+type NullSink struct{}
+
+// Write is the implementation of Sink for NullSink.
+func (NullSink) Write(PageResult) error {
+	return nil
+}
+
+// Close is the implementation of Sink for NullSink.
+func (NullSink) Close() error {
+	return nil
+}
+
+// bodySize returns the size of the body of page as transferred, as counted in Stats.BytesDownloaded.
+func bodySize(page PageResult) int64 {
+	if page.Meta.EncodedSize > 0 {
+		return page.Meta.EncodedSize
+	}
+	return int64(len(page.Body))
+}
+
+// writeSinks writes page to the sinks of the crawler, keeping the first error in the result.
+func (r *run) writeSinks(page PageResult) {
+	for _, sink := range r.c.sinks {
+		if err := sink.Write(page); err != nil {
+			r.sinkFailed(err, "url", page.URL)
+		}
+	}
+}
+
+// startSinks tells the LifecycleSinks of the crawler that the crawl of seeds starts.
+func (r *run) startSinks(seeds []URL) {
+	for _, sink := range r.c.sinks {
+		if sink, ok := sink.(LifecycleSink); ok {
+			if err := sink.Start(seeds); err != nil {
+				r.sinkFailed(err)
+			}
+		}
+	}
+}
+
+// finishSinks tells the LifecycleSinks of the crawler that the crawl is over.
+func (r *run) finishSinks() {
+	for _, sink := range r.c.sinks {
+		if sink, ok := sink.(LifecycleSink); ok {
+			if err := sink.Finish(r.result); err != nil {
+				r.sinkFailed(err)
+			}
+		}
+	}
+}
+
+// sinkFailed logs the error of a sink, with args, keeping the first one in the result.
+func (r *run) sinkFailed(err error, args ...interface{}) {
+	r.log.Error("sink failed", append(args, "err", err)...)
+	if r.result.SinkErr == nil {
+		r.result.SinkErr = fmt.Errorf("sink: %w", err)
+	}
+}
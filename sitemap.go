@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+const (
+	// maxSitemapSize is the largest uncompressed sitemap the protocol allows.
+	maxSitemapSize = 50 << 20
+	// maxSitemapNesting bounds how deep sitemap indexes are followed.
+	maxSitemapNesting = 3
+)
+
+// Sitemaps reads sitemap.xml files and sitemap index files, gzipped or not.
+type Sitemaps struct {
+	// Client fetches the sitemaps, http.DefaultClient when nil.
+	Client *http.Client
+	// UserAgent is sent with the requests, DefaultUserAgent when empty.
+	UserAgent string
+	// Robots, when set, is used by Discover to find the sitemaps listed in robots.txt.
+	Robots *Robots
+}
+
+// sitemapDoc is either a urlset or a sitemapindex.
+type sitemapDoc struct {
+	XMLName  xml.Name
+	URLs     []sitemapLoc `xml:"url"`
+	Sitemaps []sitemapLoc `xml:"sitemap"`
+}
+
+type sitemapLoc struct {
+	Loc string `xml:"loc"`
+}
+
+// Discover returns the page urls of the sitemaps of the site at origin, such as "https://golang.org".
+// The sitemaps are the ones listed in robots.txt when Robots is set, /sitemap.xml otherwise or when it lists none.
+// A site without a sitemap has no urls and no error.
+func (s *Sitemaps) Discover(ctx context.Context, origin string) ([]URL, error) {
+	base, err := url.Parse(origin)
+	if err != nil {
+		return nil, err
+	}
+	var sitemaps []URL
+	if s.Robots != nil {
+		rules, err := s.Robots.Rules(ctx, origin)
+		if err != nil {
+			return nil, err
+		}
+		// Sitemap lines should be absolute, but relative ones are common enough
+		for _, sitemap := range rules.Sitemaps {
+			if u, ok := resolveLink(base, sitemap); ok {
+				sitemaps = append(sitemaps, u)
+			}
+		}
+	}
+	if len(sitemaps) == 0 {
+		sitemaps = []URL{origin + "/sitemap.xml"}
+	}
+	var urls []URL
+	seen := make(map[URL]bool)
+	for _, sitemap := range sitemaps {
+		found, err := s.Read(ctx, sitemap)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return urls, err
+		}
+		for _, u := range found {
+			if !seen[u] {
+				seen[u] = true
+				urls = append(urls, u)
+			}
+		}
+	}
+	return urls, nil
+}
+
+// Read returns the page urls of the sitemap at sitemapURL, following sitemap indexes.
+func (s *Sitemaps) Read(ctx context.Context, sitemapURL URL) ([]URL, error) {
+	var urls []URL
+	err := s.read(ctx, sitemapURL, 0, &urls)
+	return urls, err
+}
+
+func (s *Sitemaps) read(ctx context.Context, sitemapURL URL, nesting int, urls *[]URL) error {
+	doc, err := s.fetch(ctx, sitemapURL)
+	if err != nil {
+		return err
+	}
+	base, err := url.Parse(sitemapURL)
+	if err != nil {
+		return err
+	}
+	for _, loc := range doc.URLs {
+		if u, ok := resolveLink(base, loc.Loc); ok {
+			*urls = append(*urls, u)
+		}
+	}
+	if len(doc.Sitemaps) > 0 && nesting >= maxSitemapNesting {
+		return fmt.Errorf("sitemap %s: indexes nested too deep", sitemapURL)
+	}
+	for _, loc := range doc.Sitemaps {
+		u, ok := resolveLink(base, loc.Loc)
+		if !ok {
+			continue
+		}
+		if err := s.read(ctx, u, nesting+1, urls); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetch downloads and decodes a single sitemap.
+func (s *Sitemaps) fetch(ctx context.Context, sitemapURL URL) (*sitemapDoc, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sitemapURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	userAgent := s.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+	req.Header.Set("User-Agent", userAgent)
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &HTTPError{URL: sitemapURL, StatusCode: resp.StatusCode}
+	}
+	body, err := decompressSitemap(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("sitemap %s: %w", sitemapURL, err)
+	}
+	doc := &sitemapDoc{}
+	if err := xml.NewDecoder(io.LimitReader(body, maxSitemapSize)).Decode(doc); err != nil {
+		return nil, fmt.Errorf("sitemap %s: %w", sitemapURL, err)
+	}
+	return doc, nil
+}
+
+// decompressSitemap returns r, gunzipped when it starts with the gzip magic number.
+// Gzipped sitemaps are usually served as files rather than with a Content-Encoding, so the body itself is checked.
+func decompressSitemap(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(2)
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		return gzip.NewReader(br)
+	}
+	return br, nil
+}
+
+// sitemapSeeds returns the urls of the sitemaps of the sites of seeds.
+func (r *run) sitemapSeeds(seeds []URL) []URL {
+	var found []URL
+	origins := make(map[string]bool)
+	for _, seed := range seeds {
+		u, err := url.Parse(seed)
+		if err != nil || u.Host == "" {
+			continue
+		}
+		origin := u.Scheme + "://" + u.Host
+		if origins[origin] {
+			continue
+		}
+		origins[origin] = true
+		urls, err := r.c.sitemaps.Discover(r.ctx, origin)
+		if err != nil {
+			r.log.Warn("sitemaps failed", "origin", origin, "err", err)
+			if r.result.SitemapErr == nil {
+				r.result.SitemapErr = err
+			}
+		}
+		found = append(found, urls...)
+	}
+	return found
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxSitemapURLs is the most urls a sitemap can list, the larger crawls are split into several sitemaps.
+	MaxSitemapURLs = 50000
+	// sitemapNamespace is the namespace of sitemaps and sitemap indexes.
+	sitemapNamespace = "http://www.sitemaps.org/schemas/sitemap/0.9"
+)
+
+// SitemapSink writes the pages crawled successfully to a sitemap.xml in Dir when closed, for the site owners
+// crawling their site to generate its sitemap. Failed pages, duplicates, pages asking not to be indexed, pages
+// declaring another canonical url and external pages are left out. A crawl of more than MaxURLs pages, or of more
+// than the 50MB a sitemap can take, is split into sitemap-1.xml, sitemap-2.xml, ... listed by a sitemap index
+// in sitemap.xml.
+type SitemapSink struct {
+	// Dir is the directory the sitemaps are written to, created when missing, the current directory when empty.
+	Dir string
+	// BaseURL is the url Dir is served at, the sitemap index lists the sitemaps under it.
+	// It is the root of the host of the first page when empty.
+	BaseURL URL
+	// MaxURLs is the most urls listed by a sitemap, MaxSitemapURLs when not positive.
+	MaxURLs int
+
+	// entries are the <url> elements of the pages, in the order they were crawled
+	entries []sitemapEntry
+	seen    map[URL]bool
+}
+
+// sitemapEntry is a <url> of a sitemap, or a <sitemap> of a sitemap index.
+type sitemapEntry struct {
+	XMLName xml.Name
+	Loc     string `xml:"loc"`
+	// LastMod is in the W3C datetime format
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// Write is the implementation of Sink for SitemapSink.
+func (s *SitemapSink) Write(page PageResult) error {
+	status := page.Meta.StatusCode
+	if page.Err != nil || status != 0 && (status < 200 || status > 299) || page.DuplicateOf != "" || page.NoIndex ||
+		page.External || page.Canonical != "" && page.Canonical != page.URL || strings.Contains(page.URL, "#") {
+		return nil
+	}
+	if s.seen[page.URL] {
+		return nil
+	}
+	if s.seen == nil {
+		s.seen = make(map[URL]bool)
+	}
+	s.seen[page.URL] = true
+	entry := sitemapEntry{XMLName: xml.Name{Local: "url"}, Loc: page.URL}
+	if t, err := http.ParseTime(page.Meta.LastModified); err == nil {
+		entry.LastMod = t.UTC().Format(time.RFC3339)
+	}
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+// Close is the implementation of Sink for SitemapSink, it writes the sitemaps.
+func (s *SitemapSink) Close() error {
+	chunks, err := s.split()
+	if err != nil {
+		return err
+	}
+	if s.Dir != "" {
+		if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+			return err
+		}
+	}
+	index := filepath.Join(s.Dir, "sitemap.xml")
+	if len(chunks) == 1 {
+		return writeAtomic(index, func(w io.Writer) error {
+			return writeSitemap(w, "urlset", chunks[0])
+		})
+	}
+	base, err := s.baseURL()
+	if err != nil {
+		return err
+	}
+	sitemaps := make([]sitemapEntry, len(chunks))
+	for i, chunk := range chunks {
+		name := fmt.Sprintf("sitemap-%d.xml", i+1)
+		err := writeAtomic(filepath.Join(s.Dir, name), func(w io.Writer) error {
+			return writeSitemap(w, "urlset", chunk)
+		})
+		if err != nil {
+			return err
+		}
+		sitemaps[i] = sitemapEntry{XMLName: xml.Name{Local: "sitemap"}, Loc: base + name, LastMod: lastMod(chunk)}
+	}
+	return writeAtomic(index, func(w io.Writer) error {
+		return writeSitemap(w, "sitemapindex", sitemaps)
+	})
+}
+
+// split returns the entries in chunks of at most MaxURLs entries and maxSitemapSize bytes, one chunk without entries.
+func (s *SitemapSink) split() ([][]sitemapEntry, error) {
+	maxURLs := s.MaxURLs
+	if maxURLs <= 0 {
+		maxURLs = MaxSitemapURLs
+	}
+	empty := len(xml.Header) + len(sitemapStart("urlset")) + len(sitemapEnd("urlset"))
+	chunks := [][]sitemapEntry{nil}
+	size := empty
+	for _, entry := range s.entries {
+		data, err := xml.Marshal(entry)
+		if err != nil {
+			return nil, err
+		}
+		last := len(chunks) - 1
+		if len(chunks[last]) > 0 && (len(chunks[last]) >= maxURLs || size+len(data)+1 > maxSitemapSize) {
+			chunks = append(chunks, nil)
+			last++
+			size = empty
+		}
+		chunks[last] = append(chunks[last], entry)
+		size += len(data) + 1
+	}
+	return chunks, nil
+}
+
+// baseURL returns the url the sitemaps are listed under, ending with a slash.
+func (s *SitemapSink) baseURL() (URL, error) {
+	base := s.BaseURL
+	if base == "" {
+		u, err := url.Parse(s.entries[0].Loc)
+		if err != nil {
+			return "", err
+		}
+		base = u.Scheme + "://" + u.Host + "/"
+	}
+	if !strings.HasSuffix(base, "/") {
+		base += "/"
+	}
+	return base, nil
+}
+
+// writeSitemap writes entries to w as a sitemap document whose root element is root, urlset or sitemapindex.
+func writeSitemap(w io.Writer, root string, entries []sitemapEntry) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(xml.Header)
+	bw.WriteString(sitemapStart(root))
+	for _, entry := range entries {
+		data, err := xml.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		bw.Write(data)
+		bw.WriteByte('\n')
+	}
+	bw.WriteString(sitemapEnd(root))
+	return bw.Flush()
+}
+
+func sitemapStart(root string) string {
+	return "<" + root + ` xmlns="` + sitemapNamespace + `">` + "\n"
+}
+
+func sitemapEnd(root string) string {
+	return "</" + root + ">\n"
+}
+
+// lastMod returns the latest lastmod of entries, or an empty string when none has one.
+func lastMod(entries []sitemapEntry) string {
+	var latest string
+	for _, entry := range entries {
+		// the lastmods are all in UTC, so they sort as strings
+		if entry.LastMod > latest {
+			latest = entry.LastMod
+		}
+	}
+	return latest
+}
+
+// writeAtomic writes the file path with write, replacing it atomically so readers never see a partial file.
+func writeAtomic(path string, write func(w io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	// the files are published, temporary files are only readable by their owner
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// sitemapFile is a sitemap or a sitemap index as read back from a file.
+type sitemapFile struct {
+	XMLName xml.Name
+	Entries []struct {
+		Loc     string `xml:"loc"`
+		LastMod string `xml:"lastmod"`
+	} `xml:",any"`
+}
+
+func readSitemap(t *testing.T, name string) sitemapFile {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc sitemapFile
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return doc
+}
+
+func (doc sitemapFile) locs() []string {
+	var locs []string
+	for _, entry := range doc.Entries {
+		locs = append(locs, entry.Loc)
+	}
+	return locs
+}
+
+func TestSitemapSink(t *testing.T) {
+	pages := []PageResult{
+		{URL: "https://example.com/", Meta: FetchMeta{StatusCode: 200, LastModified: "Mon, 02 Jan 2023 15:04:05 GMT"}},
+		{URL: "https://example.com/failed", Err: errors.New("failed")},
+		{URL: "https://example.com/missing", Meta: FetchMeta{StatusCode: 404}},
+		{URL: "https://example.com/a", Meta: FetchMeta{StatusCode: 200}},
+		{URL: "https://example.com/a"},
+		{URL: "https://example.com/copy", DuplicateOf: "https://example.com/a"},
+		{URL: "https://example.com/private", NoIndex: true},
+		{URL: "https://example.com/b?print", Canonical: "https://example.com/b"},
+		{URL: "https://other.example/", External: true},
+		{URL: "https://example.com/b", Meta: FetchMeta{LastModified: "Tue, 03 Jan 2023 15:04:05 GMT"}},
+		{URL: "https://example.com/c"},
+		{URL: "https://example.com/d"},
+		{URL: "https://example.com/e"},
+	}
+	tests := []struct {
+		name    string
+		maxURLs int
+		// sitemaps are the urls of every sitemap, a single one being sitemap.xml
+		sitemaps [][]string
+		lastMods []string
+	}{
+		{"single sitemap", 0, [][]string{{
+			"https://example.com/", "https://example.com/a", "https://example.com/b",
+			"https://example.com/c", "https://example.com/d", "https://example.com/e",
+		}}, nil},
+		{"split", 4, [][]string{
+			{"https://example.com/", "https://example.com/a", "https://example.com/b", "https://example.com/c"},
+			{"https://example.com/d", "https://example.com/e"},
+		}, []string{"2023-01-03T15:04:05Z", ""}},
+		{"split evenly", 3, [][]string{
+			{"https://example.com/", "https://example.com/a", "https://example.com/b"},
+			{"https://example.com/c", "https://example.com/d", "https://example.com/e"},
+		}, []string{"2023-01-03T15:04:05Z", ""}},
+	}
+	for _, test := range tests {
+		// the directory is created when missing
+		dir := filepath.Join(t.TempDir(), "site", "sitemaps")
+		sink := &SitemapSink{Dir: dir, MaxURLs: test.maxURLs}
+		for _, page := range pages {
+			if err := sink.Write(page); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := sink.Close(); err != nil {
+			t.Errorf("%s: Close: %v", test.name, err)
+			continue
+		}
+		index := readSitemap(t, filepath.Join(dir, "sitemap.xml"))
+		if len(test.sitemaps) == 1 {
+			if index.XMLName.Local != "urlset" || !reflect.DeepEqual(index.locs(), test.sitemaps[0]) {
+				t.Errorf("%s: sitemap.xml = %s %q, want urlset %q", test.name, index.XMLName.Local, index.locs(), test.sitemaps[0])
+			}
+			if index.Entries[0].LastMod != "2023-01-02T15:04:05Z" {
+				t.Errorf("%s: lastmod = %q", test.name, index.Entries[0].LastMod)
+			}
+			continue
+		}
+		if index.XMLName.Local != "sitemapindex" || len(index.Entries) != len(test.sitemaps) {
+			t.Errorf("%s: sitemap.xml = %s of %d entries, want sitemapindex of %d", test.name, index.XMLName.Local, len(index.Entries), len(test.sitemaps))
+			continue
+		}
+		for i, want := range test.sitemaps {
+			name := fmt.Sprintf("sitemap-%d.xml", i+1)
+			if index.Entries[i].Loc != "https://example.com/"+name || index.Entries[i].LastMod != test.lastMods[i] {
+				t.Errorf("%s: entry %d = %+v", test.name, i, index.Entries[i])
+			}
+			if got := readSitemap(t, filepath.Join(dir, name)); got.XMLName.Local != "urlset" || !reflect.DeepEqual(got.locs(), want) {
+				t.Errorf("%s: %s = %s %q, want urlset %q", test.name, name, got.XMLName.Local, got.locs(), want)
+			}
+		}
+	}
+}
+
+func TestSitemapSinkBaseURL(t *testing.T) {
+	dir := t.TempDir()
+	sink := &SitemapSink{Dir: dir, MaxURLs: 1, BaseURL: "https://cdn.example.com/maps"}
+	sink.Write(PageResult{URL: "https://example.com/", Meta: FetchMeta{StatusCode: http.StatusOK}})
+	sink.Write(PageResult{URL: "https://example.com/a", Meta: FetchMeta{StatusCode: http.StatusOK}})
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"https://cdn.example.com/maps/sitemap-1.xml", "https://cdn.example.com/maps/sitemap-2.xml"}
+	if got := readSitemap(t, filepath.Join(dir, "sitemap.xml")).locs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("sitemaps = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// SQLiteSchema is the schema of the databases written by a SQLiteSink. A database can collect several crawls,
+// a page crawled again replaces its previous row.
+const SQLiteSchema = `
+-- a row per crawled page
+CREATE TABLE IF NOT EXISTS pages (
+	url          TEXT PRIMARY KEY,
+	depth        INTEGER NOT NULL,
+	parent       TEXT,    -- the page the url was first found on, NULL for the seeds
+	status       INTEGER, -- the HTTP status code, NULL without one
+	content_type TEXT,
+	title        TEXT,
+	size         INTEGER NOT NULL, -- the size of the body as transferred, in bytes
+	latency_ms   REAL,             -- the time the response took to start arriving
+	duplicate_of TEXT,
+	canonical    TEXT,
+	external     INTEGER NOT NULL, -- 1 for the pages outside the scope
+	crawled_at   TEXT NOT NULL     -- in RFC 3339 format, UTC
+);
+CREATE INDEX IF NOT EXISTS pages_status ON pages (status);
+
+-- a row per link found on a crawled page, crawled or not
+CREATE TABLE IF NOT EXISTS links (
+	source TEXT NOT NULL,
+	target TEXT NOT NULL,
+	PRIMARY KEY (source, target)
+);
+CREATE INDEX IF NOT EXISTS links_target ON links (target);
+
+-- a row per page that failed
+CREATE TABLE IF NOT EXISTS errors (
+	url     TEXT PRIMARY KEY,
+	class   TEXT NOT NULL, -- the class of Stats.Errors, such as not_found or timeout
+	message TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS errors_class ON errors (class);
+`
+
+// sqliteBatch is the number of pages a SQLiteSink writes per transaction.
+const sqliteBatch = 500
+
+// SQLiteSink writes the pages, their links and their errors to the SQLite database at Path, with SQLiteSchema,
+// for ad hoc SQL queries over the crawl. The module has no dependencies, so instead of linking SQLite the sink
+// pipes SQL to the sqlite3 command line shell.
+type SQLiteSink struct {
+	// Path is the database file, created when it does not exist.
+	Path string
+	// Command is the sqlite3 shell, found in the PATH when empty.
+	Command string
+	// Script, when set, is written the SQL instead of running Command, to be run later with sqlite3.
+	Script io.Writer
+
+	w      *bufio.Writer
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stderr bytes.Buffer
+	// pending is the number of pages written in the current transaction
+	pending int
+}
+
+// Write is the implementation of Sink for SQLiteSink.
+func (s *SQLiteSink) Write(page PageResult) error {
+	if err := s.start(); err != nil {
+		return err
+	}
+	if s.pending == 0 {
+		s.w.WriteString("BEGIN;\n")
+	}
+	var latency interface{}
+	if page.Meta.Latency > 0 {
+		latency = float64(page.Meta.Latency) / float64(time.Millisecond)
+	}
+	external := 0
+	if page.External {
+		external = 1
+	}
+	fmt.Fprintf(s.w, "INSERT OR REPLACE INTO pages VALUES (%s, %d, %s, %s, %s, %s, %d, %s, %s, %s, %d, %s);\n",
+		sqlValue(page.URL), page.Depth, sqlValue(page.Parent), sqlValue(page.Meta.StatusCode),
+		sqlValue(page.Meta.Header.Get("Content-Type")), sqlValue(page.Meta.Title), bodySize(page), sqlValue(latency),
+		sqlValue(page.DuplicateOf), sqlValue(page.Canonical), external, sqlValue(time.Now().UTC().Format(time.RFC3339)))
+	fmt.Fprintf(s.w, "DELETE FROM links WHERE source = %s;\n", sqlValue(page.URL))
+	for _, link := range page.Links {
+		fmt.Fprintf(s.w, "INSERT OR IGNORE INTO links VALUES (%s, %s);\n", sqlValue(page.URL), sqlValue(link))
+	}
+	if page.Err != nil {
+		fmt.Fprintf(s.w, "INSERT OR REPLACE INTO errors VALUES (%s, %s, %s);\n",
+			sqlValue(page.URL), sqlValue(errorClass(page.Err)), sqlValue(page.Err.Error()))
+	} else {
+		fmt.Fprintf(s.w, "DELETE FROM errors WHERE url = %s;\n", sqlValue(page.URL))
+	}
+	s.pending++
+	if s.pending < sqliteBatch {
+		return nil
+	}
+	s.pending = 0
+	s.w.WriteString("COMMIT;\n")
+	return s.w.Flush()
+}
+
+// Close is the implementation of Sink for SQLiteSink, it commits the pages and waits for sqlite3 to exit.
+func (s *SQLiteSink) Close() error {
+	if err := s.start(); err != nil {
+		return err
+	}
+	if s.pending > 0 {
+		s.pending = 0
+		s.w.WriteString("COMMIT;\n")
+	}
+	err := s.w.Flush()
+	if s.cmd == nil {
+		return err
+	}
+	if closeErr := s.stdin.Close(); err == nil {
+		err = closeErr
+	}
+	if waitErr := s.cmd.Wait(); waitErr != nil {
+		return fmt.Errorf("sqlite3 %s: %w: %s", s.Path, waitErr, strings.TrimSpace(lastLine(s.stderr.String())))
+	}
+	return err
+}
+
+// start starts sqlite3, unless it is started or the SQL goes to Script, and creates the tables.
+func (s *SQLiteSink) start() error {
+	if s.w != nil {
+		return nil
+	}
+	out := s.Script
+	if out == nil {
+		command := s.Command
+		if command == "" {
+			command = "sqlite3"
+		}
+		// -bail stops at the first failing statement, Close reports it
+		s.cmd = exec.Command(command, "-bail", s.Path)
+		s.cmd.Stderr = &s.stderr
+		stdin, err := s.cmd.StdinPipe()
+		if err != nil {
+			return err
+		}
+		if err := s.cmd.Start(); err != nil {
+			return err
+		}
+		s.stdin, out = stdin, stdin
+	}
+	s.w = bufio.NewWriter(out)
+	s.w.WriteString(SQLiteSchema)
+	return nil
+}
+
+// sqlValue returns v as a SQL literal, NULL for empty strings, zero ints and nil.
+func sqlValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		if v == "" {
+			return "NULL"
+		}
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	case int:
+		if v == 0 {
+			return "NULL"
+		}
+		return fmt.Sprint(v)
+	case float64:
+		return fmt.Sprint(v)
+	}
+	return "NULL"
+}
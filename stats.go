@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ErrNotFound is returned by fetchers when a page does not exist.
+var ErrNotFound = errors.New("not found")
+
+// SkipDomainBudget is the Stats.Skipped reason of urls dropped because their host used up its domain budget.
+const SkipDomainBudget = "domain budget"
+
+// SkipLinkCap is the Stats.Skipped reason of the links dropped because their page had more than WithMaxLinks.
+const SkipLinkCap = "link cap"
+
+// SkippedResult is returned by fetchers that decided against fetching a page, the crawl counts it in Stats.Skipped.
+type SkippedResult struct {
+	URL URL
+	// Reason is the key of the page in Stats.Skipped.
+	Reason string
+	// Err is the error behind the decision, if any.
+	Err error
+}
+
+func (e *SkippedResult) Error() string {
+	return fmt.Sprintf("%s: skipped, %s", e.URL, e.Reason)
+}
+
+func (e *SkippedResult) Unwrap() error {
+	return e.Err
+}
+
+// Stats are counters collected while crawling.
+type Stats struct {
+	// PagesFetched is the number of crawled pages, including failed and cached ones.
+	PagesFetched int
+	// CacheHits is the number of pages served by a FetcherCache.
+	CacheHits int
+	// Errors counts failed pages by error class, see errorClass.
+	Errors map[string]int
+	// BytesDownloaded is the total size of the bodies that were not served from cache, as transferred.
+	BytesDownloaded int64
+	// Duration is the wall-clock time the crawl took.
+	Duration time.Duration
+	// MaxDepth is the depth of the deepest crawled page.
+	MaxDepth int
+	// Hosts counts crawled pages by host, in its ASCII form.
+	Hosts map[string]int
+	// HostStats are the error rates and the latencies of the hosts, by host in its ASCII form.
+	HostStats map[string]*HostStats
+	// Skipped counts the urls that were dropped from the frontier without being fetched, by reason.
+	Skipped map[string]int
+	// Filtered counts the links dropped from the pages because they cannot be pages, by reason, see FetchMeta.Filtered.
+	Filtered map[string]int
+	// Duplicates is the number of crawled pages with the same body, or the same canonical url, as a page crawled
+	// before, with WithDedup or WithCanonicalDedup.
+	Duplicates int
+	// External is the number of crawled pages outside the scope, with WithExternalDepth.
+	External int
+}
+
+func newStats() Stats {
+	return Stats{
+		Errors:   make(map[string]int),
+		Hosts:    make(map[string]int),
+		Skipped:  make(map[string]int),
+		Filtered: make(map[string]int),
+
+		HostStats: make(map[string]*HostStats),
+	}
+}
+
+// record accounts for a crawled page.
+func (s *Stats) record(page PageResult, cacheHit bool) {
+	s.PagesFetched++
+	if cacheHit {
+		s.CacheHits++
+	} else if page.Meta.EncodedSize > 0 {
+		s.BytesDownloaded += page.Meta.EncodedSize
+	} else {
+		s.BytesDownloaded += int64(len(page.Body))
+	}
+	if page.Err != nil {
+		s.Errors[errorClass(page.Err)]++
+	}
+	if page.DuplicateOf != "" {
+		s.Duplicates++
+	}
+	if page.External {
+		s.External++
+	}
+	for reason, n := range page.Meta.Filtered {
+		s.Filtered[reason] += n
+	}
+	if page.Depth > s.MaxDepth {
+		s.MaxDepth = page.Depth
+	}
+	host := hostOf(page.URL)
+	s.Hosts[host]++
+	hostStats := s.HostStats[host]
+	if hostStats == nil {
+		hostStats = &HostStats{}
+		s.HostStats[host] = hostStats
+	}
+	hostStats.record(page, cacheHit)
+}
+
+// statsLatencyBuckets are the buckets of the latency histograms of HostStats, from 10µs to 93s, each 20% wider
+// than the previous one.
+var statsLatencyBuckets = exponentialBuckets(0.00001, 1.2, 89)
+
+// HostStats are the fetches from a host in Stats.
+type HostStats struct {
+	// Fetches is the number of crawled pages of the host, Errors the number of failed ones.
+	Fetches int
+	Errors  int
+	// latency is a histogram of the time the fetches not served from cache took, in seconds
+	latency *histogram
+}
+
+func (h *HostStats) record(page PageResult, cacheHit bool) {
+	h.Fetches++
+	if page.Err != nil {
+		h.Errors++
+	}
+	// the pages served from cache say nothing of the host
+	if !cacheHit {
+		if h.latency == nil {
+			h.latency = newHistogram(statsLatencyBuckets)
+		}
+		h.latency.observe(page.Duration.Seconds())
+	}
+}
+
+// ErrorRate returns the share of the failed pages of the host, between 0 and 1.
+func (h *HostStats) ErrorRate() float64 {
+	if h.Fetches == 0 {
+		return 0
+	}
+	return float64(h.Errors) / float64(h.Fetches)
+}
+
+// Latency returns the q quantile of the time the fetches from the host took, such as 0.95 for their 95th
+// percentile. It is estimated from buckets 20% wide, so within 20% of the actual quantile from 10µs to 93s,
+// and between the shortest and the longest fetch otherwise. The pages served from cache are left out, and it is 0
+// without fetches, or for a HostStats that was not collected by a crawl, such as one decoded from JSON.
+func (h *HostStats) Latency(q float64) time.Duration {
+	if h.latency == nil {
+		return 0
+	}
+	return time.Duration(h.latency.quantile(q) * float64(time.Second))
+}
+
+// MeanLatency returns the mean time the fetches from the host took, the pages served from cache left out.
+func (h *HostStats) MeanLatency() time.Duration {
+	if h.latency == nil || h.latency.count == 0 {
+		return 0
+	}
+	return time.Duration(h.latency.sum / float64(h.latency.count) * float64(time.Second))
+}
+
+// errorClass groups fetch errors into coarse classes for Stats.Errors.
+func errorClass(err error) string {
+	var netErr net.Error
+	var httpErr *HTTPError
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return "not_found"
+	case errors.Is(err, ErrFetchTimeout), errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.As(err, &httpErr):
+		return fmt.Sprintf("http_%dxx", httpErr.StatusCode/100)
+	case errors.As(err, &netErr):
+		return "network"
+	}
+	return "other"
+}
+
+// hostOf returns the host of rawURL in its ASCII form, or an empty string when it does not parse.
+func hostOf(rawURL URL) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return ToASCIIHost(u.Host)
+}
+
+// fetchTrace collects details about a single fetch from the fetchers it passes through.
+type fetchTrace struct {
+	cacheHit bool
+	meta     FetchMeta
+	// keepRouteFragments is set by the crawl for the links to keep the fragments its Normalizer keeps
+	keepRouteFragments bool
+}
+
+type fetchTraceKey struct{}
+
+// withFetchTrace returns a context carrying a new fetchTrace.
+func withFetchTrace(ctx context.Context) (context.Context, *fetchTrace) {
+	trace := &fetchTrace{}
+	return context.WithValue(ctx, fetchTraceKey{}, trace), trace
+}
+
+// ensureFetchTrace returns the fetchTrace carried by ctx, adding one when there is none.
+func ensureFetchTrace(ctx context.Context) (context.Context, *fetchTrace) {
+	if trace := traceFromContext(ctx); trace != nil {
+		return ctx, trace
+	}
+	return withFetchTrace(ctx)
+}
+
+// traceFromContext returns the fetchTrace carried by ctx, or nil.
+func traceFromContext(ctx context.Context) *fetchTrace {
+	trace, _ := ctx.Value(fetchTraceKey{}).(*fetchTrace)
+	return trace
+}
+
+// FetchMeta are the details of a fetch beyond its body and links, set by the fetchers that know them.
+type FetchMeta struct {
+	// ContentEncoding is the encoding the body was transferred with, such as "gzip", and empty when it was not encoded.
+	ContentEncoding string `json:",omitempty"`
+	// EncodedSize is the size of the body as transferred, before decoding, and 0 when unknown.
+	EncodedSize int64 `json:",omitempty"`
+	// ETag and LastModified are the validators of the response, used to revalidate cached results.
+	ETag         string `json:",omitempty"`
+	LastModified string `json:",omitempty"`
+	// StatusCode is the status code of the response, including failed ones, and 0 without one.
+	StatusCode int `json:",omitempty"`
+	// Header are the headers of the response.
+	Header http.Header `json:",omitempty"`
+	// Redirects are the urls the page was redirected from, in order and starting with the fetched url.
+	Redirects []URL `json:",omitempty"`
+	// Latency is the time the response took to start arriving.
+	Latency time.Duration `json:",omitempty"`
+	// Robots are the directives of the <meta name="robots"> of an HTML page, comma separated, such as "noindex".
+	Robots string `json:",omitempty"`
+	// Nofollow are the links of an HTML page that are only linked with rel="nofollow".
+	Nofollow []URL `json:",omitempty"`
+	// Canonical is the url of the <link rel="canonical"> of an HTML page.
+	Canonical URL `json:",omitempty"`
+	// Title is the text of the <title> of an HTML page.
+	Title string `json:",omitempty"`
+	// Filtered counts the links of an HTML page that were dropped because they cannot be pages, by reason,
+	// such as "mailto" or FilterMalformed.
+	Filtered map[string]int `json:",omitempty"`
+}
+
+func (m *FetchMeta) hasValidators() bool {
+	return m.ETag != "" || m.LastModified != ""
+}
+
+// Validators identify a cached version of a page, for conditional requests.
+type Validators struct {
+	ETag         string
+	LastModified string
+}
+
+type validatorsKey struct{}
+
+// WithValidators returns a context asking the fetcher to fail with ErrNotModified if the page still matches v.
+func WithValidators(ctx context.Context, v Validators) context.Context {
+	return context.WithValue(ctx, validatorsKey{}, v)
+}
+
+// ValidatorsFromContext returns the Validators of ctx, reporting false when it carries none.
+func ValidatorsFromContext(ctx context.Context) (Validators, bool) {
+	v, ok := ctx.Value(validatorsKey{}).(Validators)
+	return v, ok
+}
+
+// FetchWithMeta fetches url with fetcher like Fetch, and also returns the details of the fetch recorded by fetcher.
+func FetchWithMeta(ctx context.Context, fetcher Fetcher, url string) (body string, urls []string, meta FetchMeta, err error) {
+	ctx, trace := withFetchTrace(ctx)
+	body, urls, err = fetchContext(ctx, fetcher, url)
+	return body, urls, trace.meta, err
+}
+
+// metaFromContext returns the FetchMeta a fetcher records details of the fetch of ctx into.
+// Outside of a crawl the details are recorded nowhere.
+func metaFromContext(ctx context.Context) *FetchMeta {
+	if trace := traceFromContext(ctx); trace != nil {
+		return &trace.meta
+	}
+	return &FetchMeta{}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHostStats(t *testing.T) {
+	h := &HostStats{}
+	for i := 1; i <= 100; i++ {
+		page := PageResult{URL: "https://a.example/", Duration: time.Duration(i) * time.Millisecond}
+		if i%4 == 0 {
+			page.Err = ErrNotFound
+		}
+		h.record(page, false)
+	}
+	// the pages served from cache count in the error rate only
+	h.record(PageResult{URL: "https://a.example/", Duration: time.Hour}, true)
+	if h.Fetches != 101 || h.Errors != 25 {
+		t.Errorf("Fetches = %d, Errors = %d, want 101 and 25", h.Fetches, h.Errors)
+	}
+	if rate := h.ErrorRate(); rate != 25.0/101 {
+		t.Errorf("ErrorRate = %g, want %g", rate, 25.0/101)
+	}
+	for q, want := range map[float64]time.Duration{0.5: 50 * time.Millisecond, 0.95: 95 * time.Millisecond, 1: 100 * time.Millisecond} {
+		// the buckets are 20% wide
+		if got := h.Latency(q); got < want*8/10 || got > want*12/10 {
+			t.Errorf("Latency(%g) = %s, want about %s", q, got, want)
+		}
+	}
+	if got := h.MeanLatency(); got < 50*time.Millisecond || got > 51*time.Millisecond {
+		t.Errorf("MeanLatency = %s, want 50.5ms", got)
+	}
+	if empty := (&HostStats{}); empty.ErrorRate() != 0 || empty.Latency(0.5) != 0 || empty.MeanLatency() != 0 {
+		t.Error("a HostStats without fetches has latencies or errors")
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import "sync"
+
+// TieredStore is a CacheStore keeping the most recently used results of a slower store in memory, such as a
+// DiskStore or a RedisStore, so revisited urls are served without reading the slower store.
+// Results are written through to both stores, Cold holds all of them.
+type TieredStore struct {
+	// Hot is the memory store, its MaxEntries and MaxBytes bound the memory used.
+	Hot *MapStore
+	// Cold is the slower store.
+	Cold CacheStore
+
+	lock  sync.Mutex
+	stats TierStats
+}
+
+// TierStats are the counters of a TieredStore.
+type TierStats struct {
+	// HotHits is the number of results served by Hot.
+	HotHits int
+	// ColdHits is the number of results served by Cold, and moved to Hot.
+	ColdHits int
+	// Misses is the number of urls found in neither store.
+	Misses int
+}
+
+// Get is the implementation of CacheStore for TieredStore.
+func (s *TieredStore) Get(url URL) (*FetchResult, bool) {
+	if result, ok := s.Hot.Get(url); ok {
+		s.count(func(stats *TierStats) { stats.HotHits++ })
+		return result, true
+	}
+	result, ok := s.Cold.Get(url)
+	if !ok {
+		s.count(func(stats *TierStats) { stats.Misses++ })
+		return nil, false
+	}
+	s.count(func(stats *TierStats) { stats.ColdHits++ })
+	s.Hot.Set(url, result)
+	return result, true
+}
+
+// Set is the implementation of CacheStore for TieredStore, it writes result to both stores.
+func (s *TieredStore) Set(url URL, result *FetchResult) {
+	s.Cold.Set(url, result)
+	s.Hot.Set(url, result)
+}
+
+// Delete is the implementation of CacheStore for TieredStore.
+func (s *TieredStore) Delete(url URL) {
+	s.Hot.Delete(url)
+	s.Cold.Delete(url)
+}
+
+// Len is the implementation of CacheStore for TieredStore, it returns the number of results in Cold.
+func (s *TieredStore) Len() int {
+	return s.Cold.Len()
+}
+
+// Range is the implementation of CacheRanger for TieredStore, it lists the results of Cold when Cold is a CacheRanger.
+func (s *TieredStore) Range(fn func(url URL, result *FetchResult) bool) {
+	if ranger, ok := s.Cold.(CacheRanger); ok {
+		ranger.Range(fn)
+	}
+}
+
+// Bytes returns the size of the results in Hot.
+func (s *TieredStore) Bytes() int64 {
+	return s.Hot.Bytes()
+}
+
+// Evictions returns the number of results evicted from Hot, they are still in Cold.
+func (s *TieredStore) Evictions() int {
+	return s.Hot.Evictions()
+}
+
+// Stats returns the counters of the store.
+func (s *TieredStore) Stats() TierStats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.stats
+}
+
+// Err returns the first error of Cold, when it reports its errors like DiskStore and RedisStore.
+func (s *TieredStore) Err() error {
+	if reporter, ok := s.Cold.(interface{ Err() error }); ok {
+		return reporter.Err()
+	}
+	return nil
+}
+
+func (s *TieredStore) count(update func(stats *TierStats)) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	update(&s.stats)
+}
@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestTieredStore(t *testing.T) {
+	testCacheStore(t, &TieredStore{Hot: &MapStore{MaxEntries: 2}, Cold: &DiskStore{Dir: t.TempDir()}})
+}
+
+func TestTieredStoreStats(t *testing.T) {
+	cold := &MapStore{}
+	s := &TieredStore{Hot: &MapStore{MaxEntries: 2}, Cold: cold}
+	for _, url := range []URL{"https://a/1", "https://a/2", "https://a/3"} {
+		s.Set(url, &FetchResult{body: url})
+	}
+	if s.Evictions() != 1 || s.Hot.Len() != 2 || s.Len() != 3 {
+		t.Errorf("Evictions = %d, hot Len = %d, Len = %d, want 1, 2 and 3", s.Evictions(), s.Hot.Len(), s.Len())
+	}
+	// https://a/1 was evicted from Hot, it is read from Cold and moved back to Hot
+	for _, url := range []URL{"https://a/3", "https://a/1", "https://a/1", "https://a/missing"} {
+		result, ok := s.Get(url)
+		if found := url != "https://a/missing"; ok != found || ok && result.body != url {
+			t.Errorf("Get(%s) = %v, %t", url, result, ok)
+		}
+	}
+	if want := (TierStats{HotHits: 2, ColdHits: 1, Misses: 1}); s.Stats() != want {
+		t.Errorf("Stats = %+v, want %+v", s.Stats(), want)
+	}
+	if _, ok := s.Hot.Get("https://a/2"); ok {
+		t.Error("https://a/2 still in Hot after https://a/1 moved back to it")
+	}
+
+	// results deleted from Cold by another process are still served by Hot until deleted from the TieredStore
+	cold.Delete("https://a/3")
+	if _, ok := s.Get("https://a/3"); !ok {
+		t.Error("https://a/3 not served by Hot")
+	}
+	s.Delete("https://a/3")
+	if _, ok := s.Get("https://a/3"); ok {
+		t.Error("https://a/3 served after Delete")
+	}
+}
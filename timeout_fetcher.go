@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrFetchTimeout is returned by a TimeoutFetcher whose Delegate took longer than its Timeout.
+var ErrFetchTimeout = errors.New("timed out")
+
+// TimeoutFetcher bounds the fetches of Delegate, any Fetcher, to Timeout.
+// Delegates that are not ContextFetchers cannot be stopped, they are abandoned and left to finish in the background.
+type TimeoutFetcher struct {
+	// Delegate is the Fetcher whose fetches are bounded.
+	Delegate Fetcher
+	// Timeout is the longest a fetch may take, fetches are not bounded when it is 0.
+	Timeout time.Duration
+}
+
+// Fetch is the implementation of Fetcher for TimeoutFetcher.
+func (f *TimeoutFetcher) Fetch(url string) (body string, urls []string, err error) {
+	return f.FetchContext(context.Background(), url)
+}
+
+// FetchContext is the implementation of ContextFetcher for TimeoutFetcher.
+func (f *TimeoutFetcher) FetchContext(ctx context.Context, url string) (body string, urls []string, err error) {
+	if f.Timeout <= 0 {
+		return fetchContext(ctx, f.Delegate, url)
+	}
+	fetchCtx, cancel := context.WithTimeout(ctx, f.Timeout)
+	defer cancel()
+	body, urls, err = fetchContext(fetchCtx, f.Delegate, url)
+	if err != nil && ctx.Err() == nil && errors.Is(fetchCtx.Err(), context.DeadlineExceeded) {
+		return "", nil, fmt.Errorf("fetch %s: %w after %s", url, ErrFetchTimeout, f.Timeout)
+	}
+	return body, urls, err
+}
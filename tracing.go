@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTraceBatchSize is the number of spans a Tracer without BatchSize exports per request.
+const DefaultTraceBatchSize = 512
+
+// traceFlushInterval is how often a Tracer exports the spans waiting, however few, so the traces of slow crawls
+// still show up.
+const traceFlushInterval = 5 * time.Second
+
+// Tracer exports a trace per crawled page to an OpenTelemetry collector, with OTLP over HTTP in JSON, for
+// WithTracer. The span of a page, crawl.page, has a span per stage of the pipeline:
+//
+//	crawl.fetch    the fetch of the page, with the extraction of the links of streamed HTML pages
+//	crawl.parse    the normalization and filtering of the links, and the handler of WithRouter
+//	crawl.enqueue  the links pushed to the frontier, for the pages whose links are followed
+//
+// The spans have the url.full, server.address, http.response.status_code, http.response.body.size and crawler.depth
+// attributes, and an error status for failed pages. Spans are exported in batches by a goroutine of their own, so
+// the crawl does not wait for the collector, and Close exports the last ones.
+type Tracer struct {
+	// Endpoint is the url of the collector, such as http://localhost:4318, the spans are posted to /v1/traces.
+	Endpoint string
+	// ServiceName is the service.name of the spans, crawler when empty.
+	ServiceName string
+	// Header is added to the requests, such as the credentials of the collector.
+	Header http.Header
+	// BatchSize is the number of spans exported per request, DefaultTraceBatchSize when not positive.
+	BatchSize int
+	// Client sends the requests, http.DefaultClient when nil.
+	Client *http.Client
+
+	mu      sync.Mutex
+	pending []otlpSpan
+	// flush asks the goroutine exporting the spans to export the pending ones, quit to export them and return
+	flush   chan struct{}
+	quit    chan struct{}
+	done    chan struct{}
+	started bool
+	closed  bool
+	err     error
+}
+
+// pageSpans are the times of the stages of a page for a Tracer, enqueue ones are zero when its links are not followed.
+type pageSpans struct {
+	fetchStart, fetchEnd, parseEnd time.Time
+	enqueueStart, enqueueEnd       time.Time
+}
+
+// tracePage records the spans of page.
+func (t *Tracer) tracePage(page PageResult, times pageSpans) {
+	traceID, rootID := newTraceID(), newSpanID()
+	attributes := []otlpAttribute{
+		stringAttribute("url.full", page.URL),
+		stringAttribute("server.address", hostOf(page.URL)),
+		intAttribute("crawler.depth", int64(page.Depth)),
+	}
+	if page.Meta.StatusCode != 0 {
+		attributes = append(attributes, intAttribute("http.response.status_code", int64(page.Meta.StatusCode)))
+	}
+	attributes = append(attributes, intAttribute("http.response.body.size", bodySize(page)))
+	if page.Parent != "" {
+		attributes = append(attributes, stringAttribute("crawler.parent", page.Parent))
+	}
+	var status otlpStatus
+	if page.Err != nil {
+		status = otlpStatus{Code: otlpStatusError, Message: page.Err.Error()}
+	}
+	end := times.parseEnd
+	if !times.enqueueEnd.IsZero() {
+		end = times.enqueueEnd
+	}
+	root := newSpan(traceID, rootID, "", "crawl.page", otlpKindInternal, times.fetchStart, end)
+	root.Attributes, root.Status = attributes, status
+	fetch := newSpan(traceID, newSpanID(), rootID, "crawl.fetch", otlpKindClient, times.fetchStart, times.fetchEnd)
+	fetch.Attributes, fetch.Status = attributes, status
+	parse := newSpan(traceID, newSpanID(), rootID, "crawl.parse", otlpKindInternal, times.fetchEnd, times.parseEnd)
+	parse.Attributes = []otlpAttribute{intAttribute("crawler.links", int64(len(page.Links)))}
+	spans := []otlpSpan{root, fetch, parse}
+	if !times.enqueueStart.IsZero() {
+		spans = append(spans, newSpan(traceID, newSpanID(), rootID, "crawl.enqueue", otlpKindInternal,
+			times.enqueueStart, times.enqueueEnd))
+	}
+	t.record(spans...)
+}
+
+// record queues spans for export, starting the goroutine exporting them if needed.
+func (t *Tracer) record(spans ...otlpSpan) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return
+	}
+	if !t.started {
+		t.started = true
+		t.flush = make(chan struct{}, 1)
+		t.quit = make(chan struct{})
+		t.done = make(chan struct{})
+		go t.export()
+	}
+	t.pending = append(t.pending, spans...)
+	if len(t.pending) >= t.batchSize() {
+		select {
+		case t.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (t *Tracer) batchSize() int {
+	if t.BatchSize > 0 {
+		return t.BatchSize
+	}
+	return DefaultTraceBatchSize
+}
+
+// export exports the pending spans when asked to and every traceFlushInterval, until quit is closed.
+func (t *Tracer) export() {
+	defer close(t.done)
+	ticker := time.NewTicker(traceFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.flush:
+		case <-ticker.C:
+		case <-t.quit:
+			t.exportPending()
+			return
+		}
+		t.exportPending()
+	}
+}
+
+// exportPending exports the pending spans in batches, keeping the first error.
+func (t *Tracer) exportPending() {
+	t.mu.Lock()
+	spans := t.pending
+	t.pending = nil
+	t.mu.Unlock()
+	for len(spans) > 0 {
+		n := t.batchSize()
+		if n > len(spans) {
+			n = len(spans)
+		}
+		if err := t.send(spans[:n]); err != nil {
+			t.mu.Lock()
+			if t.err == nil {
+				t.err = err
+			}
+			t.mu.Unlock()
+		}
+		spans = spans[n:]
+	}
+}
+
+// Close exports the spans recorded and stops the Tracer, returning the first error exporting spans.
+func (t *Tracer) Close() error {
+	t.mu.Lock()
+	started, closed := t.started, t.closed
+	t.closed = true
+	t.mu.Unlock()
+	if started && !closed {
+		close(t.quit)
+		<-t.done
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
+
+// send posts spans to the collector.
+func (t *Tracer) send(spans []otlpSpan) error {
+	service := t.ServiceName
+	if service == "" {
+		service = "crawler"
+	}
+	request := otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: []otlpAttribute{stringAttribute("service.name", service)}},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "crawler"}, Spans: spans}},
+	}}}
+	data, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(t.Endpoint, "/")+"/v1/traces", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	for name, values := range t.Header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := t.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("export %d spans: %w", len(spans), err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("export %d spans: %s: %s", len(spans), resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// tracePage records the spans of page with the tracer of the crawler, if any, enqueued from enqueueStart when
+// its links are followed, otherwise enqueueStart is zero.
+func (r *run) tracePage(page PageResult, o outcome, enqueueStart time.Time) {
+	if r.c.tracer == nil {
+		return
+	}
+	times := pageSpans{fetchStart: o.start, fetchEnd: o.start.Add(o.duration), enqueueStart: enqueueStart}
+	times.parseEnd = times.fetchEnd.Add(o.parsed)
+	if !enqueueStart.IsZero() {
+		times.enqueueEnd = time.Now()
+	}
+	r.c.tracer.tracePage(page, times)
+}
+
+// The messages of OTLP traces, in their JSON form.
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID      string          `json:"traceId"`
+		SpanID       string          `json:"spanId"`
+		ParentSpanID string          `json:"parentSpanId,omitempty"`
+		Name         string          `json:"name"`
+		Kind         int             `json:"kind"`
+		Start        string          `json:"startTimeUnixNano"`
+		End          string          `json:"endTimeUnixNano"`
+		Attributes   []otlpAttribute `json:"attributes,omitempty"`
+		Status       otlpStatus      `json:"status"`
+	}
+	otlpAttribute struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+	// otlpValue is an AnyValue, 64 bit integers are strings in JSON
+	otlpValue struct {
+		StringValue *string `json:"stringValue,omitempty"`
+		IntValue    *string `json:"intValue,omitempty"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+	}
+)
+
+// The span kinds and status codes of OTLP.
+const (
+	otlpKindInternal = 1
+	otlpKindClient   = 3
+	otlpStatusError  = 2
+)
+
+func newSpan(traceID, spanID, parentID, name string, kind int, start, end time.Time) otlpSpan {
+	return otlpSpan{
+		TraceID:      traceID,
+		SpanID:       spanID,
+		ParentSpanID: parentID,
+		Name:         name,
+		Kind:         kind,
+		Start:        strconv.FormatInt(start.UnixNano(), 10),
+		End:          strconv.FormatInt(end.UnixNano(), 10),
+	}
+}
+
+func stringAttribute(key, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpValue{StringValue: &value}}
+}
+
+func intAttribute(key string, value int64) otlpAttribute {
+	s := strconv.FormatInt(value, 10)
+	return otlpAttribute{Key: key, Value: otlpValue{IntValue: &s}}
+}
+
+// newTraceID and newSpanID return random ids, hex encoded as in the JSON form of OTLP.
+func newTraceID() string {
+	return randomHex(16)
+}
+
+func newSpanID() string {
+	return randomHex(8)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
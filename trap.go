@@ -0,0 +1,272 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SkipTrap is the Stats.Skipped reason of the links dropped because they look like a crawler trap, see TrapDetector.
+const SkipTrap = "trap"
+
+// Kinds of Trap.
+const (
+	// TrapRepeatedSegments are urls repeating a path segment, such as those of relative links resolved
+	// against each other without end.
+	TrapRepeatedSegments = "repeated segments"
+	// TrapPagination are urls paging further than TrapDetector.MaxPage.
+	TrapPagination = "pagination"
+	// TrapSessionID are urls only differing by a session id.
+	TrapSessionID = "session id"
+	// TrapCalendar are urls only differing by a date, such as those of the next and previous links of a calendar.
+	TrapCalendar = "calendar"
+)
+
+// Defaults of a TrapDetector.
+const (
+	DefaultMaxRepeats  = 2
+	DefaultMaxPage     = 100
+	DefaultMaxSessions = 1
+	DefaultMaxDates    = 100
+)
+
+// TrapDetector drops the links looking like they belong to an infinite url space, so the crawl does not descend
+// into it. The zero value uses the defaults.
+type TrapDetector struct {
+	// MaxRepeats is the number of times a segment may appear in the path of a url, DefaultMaxRepeats when 0.
+	MaxRepeats int
+	// MaxPage is the highest page number followed, in a page query parameter or after a /page/ segment,
+	// DefaultMaxPage when 0.
+	MaxPage int
+	// MaxSessions is the number of urls followed that only differ by a session id, DefaultMaxSessions when 0.
+	MaxSessions int
+	// MaxDates is the number of urls followed that only differ by a date, DefaultMaxDates when 0.
+	MaxDates int
+}
+
+// Trap is an url space suspected to never end, as reported in CrawlResult.Traps.
+type Trap struct {
+	// Kind is how the urls were recognized, such as TrapCalendar.
+	Kind string
+	// Pattern is the shape of the urls, with their varying part replaced by a placeholder,
+	// such as https://golang.org/events/{date}.
+	Pattern string
+	// Example is the first link dropped.
+	Example URL
+	// Dropped is the number of links dropped.
+	Dropped int
+}
+
+// pageParams are the names of the query parameters of pagination.
+var pageParams = map[string]bool{
+	"page":       true,
+	"pg":         true,
+	"paged":      true,
+	"pagenum":    true,
+	"pageno":     true,
+	"page_no":    true,
+	"pagenumber": true,
+}
+
+// sessionParams are the names of the query and path parameters of session ids.
+var sessionParams = map[string]bool{
+	"sid":          true,
+	"sessionid":    true,
+	"session_id":   true,
+	"jsessionid":   true,
+	"phpsessid":    true,
+	"aspsessionid": true,
+	"cfid":         true,
+	"cftoken":      true,
+}
+
+// dateParams are the names of the query parameters of calendars.
+var dateParams = map[string]bool{
+	"date":  true,
+	"day":   true,
+	"week":  true,
+	"month": true,
+	"year":  true,
+}
+
+// datePattern matches the dates of urls: years, optionally followed by a month and a day.
+var datePattern = regexp.MustCompile(`\b(?:19|20)\d\d(?:[-/_.](?:0?[1-9]|1[0-2])(?:[-/_.](?:0?[1-9]|[12]\d|3[01]))?)?\b`)
+
+func (d *TrapDetector) maxRepeats() int {
+	if d.MaxRepeats > 0 {
+		return d.MaxRepeats
+	}
+	return DefaultMaxRepeats
+}
+
+func (d *TrapDetector) maxPage() int {
+	if d.MaxPage > 0 {
+		return d.MaxPage
+	}
+	return DefaultMaxPage
+}
+
+func (d *TrapDetector) maxSessions() int {
+	if d.MaxSessions > 0 {
+		return d.MaxSessions
+	}
+	return DefaultMaxSessions
+}
+
+func (d *TrapDetector) maxDates() int {
+	if d.MaxDates > 0 {
+		return d.MaxDates
+	}
+	return DefaultMaxDates
+}
+
+// suspect returns the kind of trap rawURL looks like it belongs to and the pattern of its urls, or an empty kind.
+// limit is the number of urls of the pattern that are followed before the others are dropped, none when 0.
+func (d *TrapDetector) suspect(rawURL URL) (kind, pattern string, limit int) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Opaque != "" {
+		return "", "", 0
+	}
+	origin := u.Scheme + "://" + u.Host
+	segments := strings.Split(u.EscapedPath(), "/")
+	var params []string
+	if u.RawQuery != "" {
+		params = strings.Split(u.RawQuery, "&")
+	}
+	shape := func(segments, params []string) string {
+		pattern := origin + strings.Join(segments, "/")
+		if len(params) > 0 {
+			pattern += "?" + strings.Join(params, "&")
+		}
+		return pattern
+	}
+
+	// first and repeats are the index of the first occurrence of the segments, and their number of occurrences
+	first := make(map[string]int)
+	repeats := make(map[string]int)
+	for i, segment := range segments {
+		if segment == "" {
+			continue
+		}
+		if repeats[segment] == 0 {
+			first[segment] = i
+		}
+		if repeats[segment]++; repeats[segment] > d.maxRepeats() {
+			return TrapRepeatedSegments, origin + strings.Join(segments[:first[segment]+1], "/") + "/...", 0
+		}
+	}
+
+	for i := 0; i+1 < len(segments); i++ {
+		if strings.EqualFold(segments[i], "page") && d.beyondLastPage(segments[i+1]) {
+			return TrapPagination, shape(replaced(segments, i+1, "{page}"), params), 0
+		}
+	}
+	for i, param := range params {
+		name, value := splitParam(param)
+		if pageParams[strings.ToLower(name)] && d.beyondLastPage(value) {
+			return TrapPagination, shape(segments, replaced(params, i, name+"={page}")), 0
+		}
+	}
+
+	sessionPath := append([]string(nil), segments...)
+	sessionQuery := append([]string(nil), params...)
+	hasSession := false
+	for i, segment := range sessionPath {
+		// path parameters, such as /cart;jsessionid=0A1B2C
+		if j := strings.IndexByte(segment, ';'); j >= 0 {
+			if name, _ := splitParam(segment[j+1:]); sessionParams[strings.ToLower(name)] {
+				sessionPath[i] = segment[:j+1] + name + "={session}"
+				hasSession = true
+			}
+		}
+		// ASP.NET cookieless sessions, such as /(S(lit3py55t21z5v55vlm25s55))/default.aspx
+		if strings.HasPrefix(segment, "(S(") {
+			sessionPath[i] = "{session}"
+			hasSession = true
+		}
+	}
+	for i, param := range sessionQuery {
+		if name, _ := splitParam(param); sessionParams[strings.ToLower(name)] {
+			sessionQuery[i] = name + "={session}"
+			hasSession = true
+		}
+	}
+	if hasSession {
+		return TrapSessionID, shape(sessionPath, sessionQuery), d.maxSessions()
+	}
+
+	path := strings.Join(segments, "/")
+	datePath := datePattern.ReplaceAllString(path, "{date}")
+	dateQuery := append([]string(nil), params...)
+	hasDate := datePath != path
+	for i, param := range dateQuery {
+		if name, value := splitParam(param); dateParams[strings.ToLower(name)] || datePattern.MatchString(value) {
+			dateQuery[i] = name + "={date}"
+			hasDate = true
+		}
+	}
+	if hasDate {
+		return TrapCalendar, shape([]string{datePath}, dateQuery), d.maxDates()
+	}
+	return "", "", 0
+}
+
+// beyondLastPage reports whether the page number s is higher than MaxPage.
+func (d *TrapDetector) beyondLastPage(s string) bool {
+	page, err := strconv.Atoi(s)
+	return err == nil && page > d.maxPage()
+}
+
+// splitParam splits the query parameter param into its name and value.
+func splitParam(param string) (name, value string) {
+	if i := strings.IndexByte(param, '='); i >= 0 {
+		return param[:i], param[i+1:]
+	}
+	return param, ""
+}
+
+// replaced returns a copy of list with its item i replaced by s.
+func replaced(list []string, i int, s string) []string {
+	list = append([]string(nil), list...)
+	list[i] = s
+	return list
+}
+
+// trapped reports whether the link url is dropped as a crawler trap, recording the trap.
+func (r *run) trapped(url URL) bool {
+	kind, pattern, limit := r.c.traps.suspect(url)
+	if kind == "" {
+		return false
+	}
+	key := kind + " " + pattern
+	if r.trapVariants[key] < limit {
+		r.trapVariants[key]++
+		return false
+	}
+	trap, ok := r.traps[key]
+	if !ok {
+		trap = &Trap{Kind: kind, Pattern: pattern, Example: url}
+		r.traps[key] = trap
+		r.frontierLog.Info("trap detected", "kind", kind, "pattern", pattern, "example", url)
+	}
+	trap.Dropped++
+	r.result.Stats.Skipped[SkipTrap]++
+	return true
+}
+
+// trapReport returns the traps of the run, the ones with the most links dropped first.
+func (r *run) trapReport() []Trap {
+	var traps []Trap
+	for _, trap := range r.traps {
+		traps = append(traps, *trap)
+	}
+	sort.Slice(traps, func(i, j int) bool {
+		if traps[i].Dropped != traps[j].Dropped {
+			return traps[i].Dropped > traps[j].Dropped
+		}
+		return traps[i].Pattern < traps[j].Pattern
+	})
+	return traps
+}
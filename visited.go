@@ -0,0 +1,61 @@
+package main
+
+import "sync"
+
+// VisitedSet records the urls a crawl has already enqueued,
+// so every url is enqueued exactly once whether or not its fetch is cached.
+// Implementations must be safe for concurrent use, which lets a set be shared between crawls.
+type VisitedSet interface {
+	// Visit marks url as visited, reporting whether it was not visited before.
+	Visit(url URL) bool
+	// Visited reports whether url was already visited.
+	Visited(url URL) bool
+}
+
+// MapVisitedSet is the default VisitedSet, backed by a map.
+type MapVisitedSet struct {
+	lock sync.Mutex
+	urls map[URL]struct{}
+}
+
+// NewMapVisitedSet returns an empty MapVisitedSet.
+func NewMapVisitedSet() *MapVisitedSet {
+	return &MapVisitedSet{urls: make(map[URL]struct{})}
+}
+
+// Visit is the implementation of VisitedSet.Visit for MapVisitedSet.
+func (s *MapVisitedSet) Visit(url URL) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.urls[url]; ok {
+		return false
+	}
+	s.urls[url] = struct{}{}
+	return true
+}
+
+// Visited is the implementation of VisitedSet.Visited for MapVisitedSet.
+func (s *MapVisitedSet) Visited(url URL) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	_, ok := s.urls[url]
+	return ok
+}
+
+// Len returns the number of visited urls.
+func (s *MapVisitedSet) Len() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.urls)
+}
+
+// URLs is the implementation of VisitedLister for MapVisitedSet.
+func (s *MapVisitedSet) URLs() []URL {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	urls := make([]URL, 0, len(s.urls))
+	for u := range s.urls {
+		urls = append(urls, u)
+	}
+	return urls
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// WARCSink writes the pages to W as a WARC 1.1 file, the format of web archives, for replay tools such as pywb.
+// Each page fetched over HTTP gets a response record and the request record of its GET, rebuilt from what
+// the crawl keeps of the fetch: the status code, the headers and the body, decoded. Pages fetched without
+// a status code, from a fake or a file fetcher, get a resource record instead. Pages that failed without
+// a response are left out. Redirects are recorded under the crawled url, with the response of the last hop.
+// Records are as kept by WithBodyLimit, which should not be used with a WARCSink.
+type WARCSink struct {
+	W io.Writer
+	// Gzip compresses every record as a gzip member of its own, as .warc.gz files are.
+	Gzip bool
+	// UserAgent is the User-Agent of the request records, DefaultUserAgent when empty.
+	UserAgent string
+
+	// started is set once the warcinfo record is written
+	started bool
+}
+
+// Write is the implementation of Sink for WARCSink.
+func (s *WARCSink) Write(page PageResult) error {
+	if err := s.start(); err != nil {
+		return err
+	}
+	status := page.Meta.StatusCode
+	if status == 0 {
+		if page.Err != nil {
+			return nil
+		}
+		headers := []string{"WARC-Target-URI", page.URL, "Content-Type", resourceType(page)}
+		return s.writeRecord("resource", newWARCRecordID(), headers, []byte(page.Body))
+	}
+	u, err := url.Parse(page.URL)
+	if err != nil {
+		return nil
+	}
+	responseID := newWARCRecordID()
+	response := httpResponseBlock(page)
+	headers := []string{
+		"WARC-Target-URI", page.URL,
+		"Content-Type", "application/http;msgtype=response",
+		"WARC-Payload-Digest", warcDigest([]byte(page.Body)),
+	}
+	if err := s.writeRecord("response", responseID, headers, response); err != nil {
+		return err
+	}
+	userAgent := s.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+	request := fmt.Sprintf("GET %s HTTP/1.1\r\nHost: %s\r\nUser-Agent: %s\r\n\r\n", u.RequestURI(), u.Host, userAgent)
+	headers = []string{
+		"WARC-Target-URI", page.URL,
+		"Content-Type", "application/http;msgtype=request",
+		"WARC-Concurrent-To", responseID,
+	}
+	return s.writeRecord("request", newWARCRecordID(), headers, []byte(request))
+}
+
+// Close is the implementation of Sink for WARCSink, it writes the warcinfo record of a crawl without pages.
+func (s *WARCSink) Close() error {
+	return s.start()
+}
+
+// start writes the warcinfo record opening the file, describing the crawler.
+func (s *WARCSink) start() error {
+	if s.started {
+		return nil
+	}
+	s.started = true
+	info := "software: " + DefaultUserAgent + "\r\nformat: WARC File Format 1.1\r\n"
+	return s.writeRecord("warcinfo", newWARCRecordID(), []string{"Content-Type", "application/warc-fields"}, []byte(info))
+}
+
+// writeRecord writes a record of type kind with the WARC headers given as name, value pairs and block as content.
+func (s *WARCSink) writeRecord(kind, id string, headers []string, block []byte) error {
+	var record bytes.Buffer
+	fmt.Fprintf(&record, "WARC/1.1\r\nWARC-Type: %s\r\nWARC-Record-ID: %s\r\nWARC-Date: %s\r\n",
+		kind, id, time.Now().UTC().Format(time.RFC3339))
+	for i := 0; i+1 < len(headers); i += 2 {
+		fmt.Fprintf(&record, "%s: %s\r\n", headers[i], headers[i+1])
+	}
+	fmt.Fprintf(&record, "WARC-Block-Digest: %s\r\nContent-Length: %d\r\n\r\n", warcDigest(block), len(block))
+	record.Write(block)
+	record.WriteString("\r\n\r\n")
+	if !s.Gzip {
+		_, err := s.W.Write(record.Bytes())
+		return err
+	}
+	zw := gzip.NewWriter(s.W)
+	if _, err := zw.Write(record.Bytes()); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// httpResponseBlock returns the HTTP response of page as sent, but for its body being decoded.
+func httpResponseBlock(page PageResult) []byte {
+	var block bytes.Buffer
+	status := page.Meta.StatusCode
+	fmt.Fprintf(&block, "HTTP/1.1 %d %s\r\n", status, http.StatusText(status))
+	header := page.Meta.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	// the body is kept decoded and whole
+	header.Del("Content-Encoding")
+	header.Del("Transfer-Encoding")
+	header.Set("Content-Length", fmt.Sprint(len(page.Body)))
+	header.Write(&block)
+	block.WriteString("\r\n")
+	block.WriteString(page.Body)
+	return block.Bytes()
+}
+
+// resourceType returns the media type of the body of page, sniffed when its fetcher did not tell.
+func resourceType(page PageResult) string {
+	if contentType := page.Meta.Header.Get("Content-Type"); contentType != "" {
+		return contentType
+	}
+	return http.DetectContentType([]byte(page.Body))
+}
+
+// warcDigest returns the digest of data in the form of the digest headers of WARC records.
+func warcDigest(data []byte) string {
+	sum := sha1.Sum(data)
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
+
+// newWARCRecordID returns a new random record id, a version 4 UUID.
+func newWARCRecordID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
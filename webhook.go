@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The events posted by a Webhook.
+const (
+	// WebhookStarted is posted when a crawl starts.
+	WebhookStarted = "crawl.started"
+	// WebhookFinished is posted when a crawl ends, whatever the reason.
+	WebhookFinished = "crawl.finished"
+	// WebhookErrors is posted once per crawl, when the failed pages exceed MaxErrors or MaxErrorRate.
+	WebhookErrors = "crawl.errors"
+	// WebhookBrokenLink is posted for every broken link, with BrokenLinks.
+	WebhookBrokenLink = "link.broken"
+)
+
+// DefaultWebhookTimeout is how long a Webhook without Client waits for a request to be answered.
+const DefaultWebhookTimeout = 10 * time.Second
+
+// webhookQueue is the number of events a Webhook queues while posting one, the later ones are dropped.
+const webhookQueue = 64
+
+// webhookClient sends the requests of the Webhooks without Client.
+var webhookClient = &http.Client{Timeout: DefaultWebhookTimeout}
+
+// errorRatePages is the number of pages crawled before a Webhook checks their error rate, so the first failures
+// of a crawl are not taken for a failing crawl.
+const errorRatePages = 20
+
+// WebhookEvent is the JSON payload a Webhook posts, with the field names of webhook payloads.
+type WebhookEvent struct {
+	// Event is the name of the event, such as WebhookStarted.
+	Event string `json:"event"`
+	// Text describes the event, for the chat tools displaying it, such as Slack.
+	Text  string    `json:"text"`
+	Time  time.Time `json:"time"`
+	Seeds []URL     `json:"seeds,omitempty"`
+	// Pages and Errors are the numbers of pages crawled and of failed ones, so far for WebhookErrors,
+	// and ErrorClasses the failed pages by error class.
+	Pages        int            `json:"pages,omitempty"`
+	Errors       int            `json:"errors,omitempty"`
+	ErrorClasses map[string]int `json:"error_classes,omitempty"`
+	// StopReason and Duration, in seconds, are those of the finished crawl.
+	StopReason string  `json:"stop_reason,omitempty"`
+	Duration   float64 `json:"duration,omitempty"`
+	// URL, Status, Error and LinkedFrom are those of the broken link, linked from the page it was found on.
+	URL        URL    `json:"url,omitempty"`
+	Status     int    `json:"status,omitempty"`
+	Error      string `json:"error,omitempty"`
+	LinkedFrom URL    `json:"linked_from,omitempty"`
+}
+
+// Webhook is a LifecycleSink posting the events of the crawls to URL as WebhookEvents, so crawls can be wired
+// into chat or incident tools: their start and end, the failed pages exceeding a threshold, and the broken links
+// with BrokenLinks. Events are posted in order by a goroutine of their own, so the crawl does not wait for them,
+// and Close waits for the last ones. Events are dropped rather than waited for while 64 of them are queued,
+// such as when URL is slow to answer, and counted by Dropped.
+type Webhook struct {
+	URL string
+	// Header is added to the requests, such as an Authorization header.
+	Header http.Header
+	// MaxErrors posts WebhookErrors once more than MaxErrors pages failed, when positive.
+	MaxErrors int
+	// MaxErrorRate posts WebhookErrors once the share of the failed pages is above MaxErrorRate, when positive,
+	// checked from the 20th page.
+	MaxErrorRate float64
+	// BrokenLinks posts WebhookBrokenLink for every page that failed, with an error or a 4xx or 5xx status.
+	BrokenLinks bool
+	// Client sends the requests, a client giving up after DefaultWebhookTimeout when nil.
+	Client *http.Client
+
+	// pages and failed are the numbers of pages written in the crawl, and of failed ones, alerted is set once
+	// WebhookErrors was posted
+	pages, failed int
+	errorClasses  map[string]int
+	alerted       bool
+
+	events chan WebhookEvent
+	done   chan struct{}
+	// mu guards err, the first error posting an event, and dropped, the number of events dropped
+	mu      sync.Mutex
+	err     error
+	dropped int
+}
+
+// Start is the implementation of LifecycleSink for Webhook.
+func (h *Webhook) Start(seeds []URL) error {
+	h.pages, h.failed, h.alerted = 0, 0, false
+	h.errorClasses = make(map[string]int)
+	text := fmt.Sprintf("crawl of %d seeds started", len(seeds))
+	if len(seeds) == 1 {
+		text = fmt.Sprintf("crawl of %s started", DisplayURL(seeds[0]))
+	}
+	h.post(WebhookEvent{Event: WebhookStarted, Text: text, Seeds: seeds})
+	return nil
+}
+
+// Write is the implementation of Sink for Webhook.
+func (h *Webhook) Write(page PageResult) error {
+	if h.errorClasses == nil {
+		h.errorClasses = make(map[string]int)
+	}
+	h.pages++
+	if page.Err != nil {
+		h.failed++
+		h.errorClasses[errorClass(page.Err)]++
+	}
+	if h.BrokenLinks && (page.Err != nil || page.Meta.StatusCode >= 400) {
+		event := WebhookEvent{Event: WebhookBrokenLink, URL: page.URL, Status: page.Meta.StatusCode, LinkedFrom: page.Parent}
+		reason := fmt.Sprintf("%d %s", page.Meta.StatusCode, http.StatusText(page.Meta.StatusCode))
+		if page.Err != nil {
+			event.Error = page.Err.Error()
+			reason = event.Error
+		}
+		event.Text = fmt.Sprintf("broken link %s (%s)", DisplayURL(page.URL), reason)
+		if page.Parent != "" {
+			event.Text += " linked from " + DisplayURL(page.Parent)
+		}
+		h.post(event)
+	}
+	if !h.alerted && h.failing() {
+		h.alerted = true
+		h.post(WebhookEvent{
+			Event:        WebhookErrors,
+			Text:         fmt.Sprintf("crawl failing: %d of %d pages failed", h.failed, h.pages),
+			Pages:        h.pages,
+			Errors:       h.failed,
+			ErrorClasses: copyCounts(h.errorClasses),
+		})
+	}
+	return nil
+}
+
+// failing reports whether the failed pages exceed MaxErrors or MaxErrorRate.
+func (h *Webhook) failing() bool {
+	if h.MaxErrors > 0 && h.failed > h.MaxErrors {
+		return true
+	}
+	return h.MaxErrorRate > 0 && h.pages >= errorRatePages && float64(h.failed)/float64(h.pages) > h.MaxErrorRate
+}
+
+// Finish is the implementation of LifecycleSink for Webhook.
+func (h *Webhook) Finish(result *CrawlResult) error {
+	failed := 0
+	for _, n := range result.Stats.Errors {
+		failed += n
+	}
+	h.post(WebhookEvent{
+		Event: WebhookFinished,
+		Text: fmt.Sprintf("crawl finished (%s): %d pages, %d failed, in %s", result.StopReason,
+			result.Stats.PagesFetched, failed, result.Stats.Duration.Round(time.Millisecond)),
+		Pages:        result.Stats.PagesFetched,
+		Errors:       failed,
+		ErrorClasses: copyCounts(result.Stats.Errors),
+		StopReason:   result.StopReason.String(),
+		Duration:     result.Stats.Duration.Seconds(),
+	})
+	return nil
+}
+
+// Close is the implementation of Sink for Webhook, it waits for the events to be posted, returning the first
+// error posting them, or an error counting the dropped events.
+func (h *Webhook) Close() error {
+	if h.events != nil {
+		close(h.events)
+		<-h.done
+		h.events = nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.err == nil && h.dropped > 0 {
+		return fmt.Errorf("webhook: %d events dropped, the queue was full", h.dropped)
+	}
+	return h.err
+}
+
+// Dropped returns the number of events dropped because the queue was full.
+func (h *Webhook) Dropped() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.dropped
+}
+
+// post queues event to be posted, starting the goroutine posting the events if needed.
+// It drops event when the queue is full.
+func (h *Webhook) post(event WebhookEvent) {
+	if h.events == nil {
+		h.events = make(chan WebhookEvent, webhookQueue)
+		h.done = make(chan struct{})
+		go h.deliver()
+	}
+	event.Time = time.Now().UTC()
+	select {
+	case h.events <- event:
+	default:
+		h.mu.Lock()
+		h.dropped++
+		h.mu.Unlock()
+	}
+}
+
+// deliver posts the queued events until the queue is closed.
+func (h *Webhook) deliver() {
+	defer close(h.done)
+	for event := range h.events {
+		if err := h.send(event); err != nil {
+			h.mu.Lock()
+			if h.err == nil {
+				h.err = err
+			}
+			h.mu.Unlock()
+		}
+	}
+}
+
+// send posts event to URL.
+func (h *Webhook) send(event WebhookEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, h.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	for name, values := range h.Header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := h.Client
+	if client == nil {
+		client = webhookClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook %s: %w", event.Event, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s: %s: %s", event.Event, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// copyCounts returns a copy of counts, or nil when it is empty.
+func copyCounts(counts map[string]int) map[string]int {
+	if len(counts) == 0 {
+		return nil
+	}
+	c := make(map[string]int, len(counts))
+	for k, n := range counts {
+		c[k] = n
+	}
+	return c
+}